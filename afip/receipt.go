@@ -0,0 +1,119 @@
+// Package afip reads the QR code AFIP asks to print on electronic invoices and receipts in Argentina.
+// The code is a link to the AFIP site with the data of the receipt as base64 JSON in the p parameter
+package afip
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotReceipt = errors.New("not a link of an AFIP receipt")
+	errNoAmount   = errors.New("receipt has no amount")
+)
+
+// Receipt is what the QR code tells about an invoice or a ticket. CUIT is the tax id of the seller
+type Receipt struct {
+	Date        time.Time
+	Amount      float32
+	Currency    string
+	CUIT        string
+	PointOfSale int
+	Type        int
+	Number      int64
+}
+
+// currencies are AFIP codes of currencies which differ from ISO ones
+var currencies = map[string]string{
+	"PES": "ARS",
+	"DOL": "USD",
+	"060": "EUR",
+	"012": "BRL",
+	"021": "GBP",
+}
+
+// value is a number which some issuers write as a JSON string
+type value string
+
+func (v *value) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*v = value(strings.TrimSpace(text))
+		return nil
+	}
+	var number json.Number
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&number); err != nil {
+		return err
+	}
+	*v = value(number)
+	return nil
+}
+
+type content struct {
+	Date        string `json:"fecha"`
+	CUIT        value  `json:"cuit"`
+	PointOfSale value  `json:"ptoVta"`
+	Type        value  `json:"tipoCmp"`
+	Number      value  `json:"nroCmp"`
+	Amount      value  `json:"importe"`
+	Currency    string `json:"moneda"`
+}
+
+// Parse reads the receipt from the text of the QR code, a link like https://www.afip.gob.ar/fe/qr/?p=...
+func Parse(text string) (Receipt, error) {
+	link, err := url.Parse(strings.TrimSpace(text))
+	if err != nil || !strings.HasSuffix(strings.ToLower(link.Hostname()), "afip.gob.ar") {
+		return Receipt{}, ErrNotReceipt
+	}
+	encoded := link.Query().Get("p")
+	if encoded == "" {
+		return Receipt{}, ErrNotReceipt
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return Receipt{}, fmt.Errorf("error decoding data of the receipt: %v", err)
+	}
+	var fields content
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return Receipt{}, fmt.Errorf("error reading data of the receipt: %v", err)
+	}
+	amount, err := strconv.ParseFloat(string(fields.Amount), 64)
+	if err != nil || amount <= 0 {
+		return Receipt{}, errNoAmount
+	}
+	date, err := time.ParseInLocation(time.DateOnly, fields.Date, time.Local)
+	if err != nil {
+		return Receipt{}, fmt.Errorf("error reading date of the receipt '%s': %v", fields.Date, err)
+	}
+	currency := strings.ToUpper(strings.TrimSpace(fields.Currency))
+	if code, ok := currencies[currency]; ok {
+		currency = code
+	} else if currency == "" {
+		currency = "ARS"
+	}
+	receipt := Receipt{Date: date, Amount: float32(amount), Currency: currency, CUIT: string(fields.CUIT)}
+	receipt.PointOfSale, _ = strconv.Atoi(string(fields.PointOfSale))
+	receipt.Type, _ = strconv.Atoi(string(fields.Type))
+	receipt.Number, _ = strconv.ParseInt(string(fields.Number), 10, 64)
+	return receipt, nil
+}
+
+// decodeBase64 accepts standard and URL alphabets with or without padding, issuers use all of them
+func decodeBase64(encoded string) ([]byte, error) {
+	encoded = strings.TrimRight(strings.TrimSpace(encoded), "=")
+	// a plus of the standard alphabet turns into a space when the link isn't escaped
+	encoded = strings.ReplaceAll(encoded, " ", "+")
+	if strings.ContainsAny(encoded, "-_") {
+		return base64.RawURLEncoding.DecodeString(encoded)
+	}
+	return base64.RawStdEncoding.DecodeString(encoded)
+}
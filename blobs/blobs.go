@@ -0,0 +1,108 @@
+// Package blobs keeps files users attach to expenses, like photos of receipts and PDF invoices.
+// Storage of the files is pluggable: every backend is a [Store] made by [Open] from a location,
+// the local filesystem is the only one for now
+package blobs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	errBadKey     = errors.New("blob key must be a relative path without dots")
+	errNoLocation = errors.New("location of blobs is not set")
+)
+
+// Store saves and gives back files by keys like "123/receipt.jpg". Keys are chosen by callers
+type Store interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+}
+
+// Open makes the store for the location. A path or a file:// URL is a directory of the local filesystem
+func Open(location string) (Store, error) {
+	if location == "" {
+		return nil, errNoLocation
+	}
+	// a one letter scheme is a drive of a Windows path
+	if parsed, err := url.Parse(location); err == nil && len(parsed.Scheme) > 1 {
+		if parsed.Scheme != "file" {
+			return nil, fmt.Errorf("unknown storage of blobs '%s'", parsed.Scheme)
+		}
+		location = parsed.Path
+	}
+	return NewLocal(location)
+}
+
+// Local keeps every blob as a file in the directory
+type Local struct {
+	Dir string
+}
+
+// NewLocal creates the directory when there is none
+func NewLocal(dir string) (Local, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return Local{}, fmt.Errorf("error creating directory of blobs %s: %v", dir, err)
+	}
+	return Local{Dir: dir}, nil
+}
+
+// path is the file of the key. Keys can't leave the directory
+func (store Local) path(key string) (string, error) {
+	cleaned := filepath.Clean(filepath.FromSlash(key))
+	if key == "" || filepath.IsAbs(cleaned) || cleaned == "." || strings.HasPrefix(cleaned, "..") {
+		return "", errBadKey
+	}
+	return filepath.Join(store.Dir, cleaned), nil
+}
+
+func (store Local) Put(key string, data []byte) error {
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("error creating directory for blob %s: %v", key, err)
+	}
+	// the file appears under its name only when it is written completely
+	temporary := path + ".part"
+	if err = os.WriteFile(temporary, data, 0o640); err != nil {
+		return fmt.Errorf("error writing blob %s: %v", key, err)
+	}
+	if err = os.Rename(temporary, path); err != nil {
+		return fmt.Errorf("error saving blob %s: %v", key, err)
+	}
+	return nil
+}
+
+func (store Local) Get(key string) ([]byte, error) {
+	path, err := store.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading blob %s: %v", key, err)
+	}
+	return data, nil
+}
+
+func (store Local) Delete(key string) error {
+	path, err := store.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting blob %s: %v", key, err)
+	}
+	return nil
+}
@@ -9,9 +9,17 @@ import (
 
 type Bot interface {
 	Send(recipient BotRecipient, messages []Message) error
+	// Notify sends messages the bot sends on its own without deleting earlier messages, like Send does
+	Notify(recipient BotRecipient, messages []Message) error
 	ListenToCommand(command string, action func(recipient BotRecipient) ([]Message, error))
+	// ListenToCommandWithArguments is like ListenToCommand but gives the action the text typed after the command
+	ListenToCommandWithArguments(command string, action func(recipient BotRecipient, arguments string) ([]Message, error))
 	ListenToInput(action func(recipient BotRecipient, text string) ([]Message, error))
-	ListenToInlineActions(action func(recipient BotRecipient, inlineAction string) ([]Message, error))
+	// ListenToDocuments handles files user sends, the action gets the file and the text sent with it
+	ListenToDocuments(action func(recipient BotRecipient, document File, caption string) ([]Message, error))
+	// ListenToPhotos handles pictures user sends, the action gets the picture and the text sent with it
+	ListenToPhotos(action func(recipient BotRecipient, photo File, caption string) ([]Message, error))
+	ListenToInlineActions(action func(recipient BotRecipient, callback Callback) ([]Message, error))
 }
 
 type BotRecipient struct {
@@ -23,28 +31,88 @@ func (user BotRecipient) Recipient() string {
 	return strconv.Itoa(int(user.UserID))
 }
 
+// Message is a text with options for user. A message with Photo or Document shows the file with the text as its caption.
+// Messages with files stay in the chat, other messages are replaced by the next ones.
+// Reference tells what the message is about, like "expense 42", a file sent in reply to the message gets it back
 type Message struct {
-	Text    string
-	Id      string
-	Options []Option
+	Text      string
+	Id        string
+	Options   []Option
+	Layout    Layout
+	Photo     *File
+	Document  *File
+	Reference string
 }
 
+// File is a named piece of data sent to user, like a chart or a statement. Its type is known by the extension of the Name.
+// A file user sends in reply to a message has ReplyTo set to the Reference of that message
+type File struct {
+	Name    string
+	Data    []byte
+	ReplyTo string
+}
+
+// Keyboard gives options of the message together with their layout
+func (message Message) Keyboard() Keyboard {
+	return Keyboard{Layout: message.Layout, Options: message.Options}
+}
+
+// Option is a button. When pressed it gives back [Callback] with its Action, Id as the value and State.
+// FullWidth option takes a row of its own
 type Option struct {
-	Id   string
-	Text string
+	Id        string
+	Text      string
+	Action    string
+	State     string
+	FullWidth bool
 }
 
 const (
-	StateCreateTags   = "tag_create"
-	StateModifyBudget = "tag_budget"
-	StateSpending     = "tag_spending"
-	StateFeedback     = "tag_spending"
-
-	CommandCancel       = "cancel"
-	CommandStart        = "start"
-	CommandHelp         = "help"
-	CommandDefineTags   = "define_tags"
-	CommandDefineBudget = "define_budget"
-	CommandStatistics   = "view_statistics"
-	CommandFeedback     = "feedback"
+	StateCreateTags      = "tag_create"
+	StateModifyBudget    = "tag_budget"
+	StateSpending        = "tag_spending"
+	StateFeedback        = "feedback"
+	StateCreateRule      = "tag_rule"
+	StateChangeTag       = "tag_change"
+	StateRenameTag       = "tag_rename"
+	StateMergeTags       = "tag_merge"
+	StateArchiveTag      = "tag_archive"
+	StateEditTag         = "tag_edit"
+	StateTagEmoji        = "tag_emoji"
+	StateTagColor        = "tag_color"
+	StateEditExpense     = "expense_edit"
+	StateJournalAccounts = "journal_accounts"
+	StateImportColumns   = "import_columns"
+	StateNotification    = "notified"
+	StateReceipt         = "receipt"
+	StateReconcile       = "reconcile"
+
+	CommandCancel          = "cancel"
+	CommandStart           = "start"
+	CommandHelp            = "help"
+	CommandDefineTags      = "define_tags"
+	CommandDefineBudget    = "define_budget"
+	CommandStatistics      = "view_statistics"
+	CommandFeedback        = "feedback"
+	CommandRules           = "rules"
+	CommandRenameTag       = "rename_tag"
+	CommandMergeTags       = "merge_tags"
+	CommandArchiveTag      = "archive_tag"
+	CommandCharts          = "charts"
+	CommandStatement       = "statement"
+	CommandExport          = "export"
+	CommandJournal         = "journal"
+	CommandJournalAccounts = "journal_accounts"
+	CommandCards           = "cards"
+	CommandBalances        = "balances"
+	CommandTransfer        = "transfer"
+	CommandReconcile       = "reconcile"
 )
+
+// Commands lists all the commands the bot understands
+var Commands = []string{
+	CommandCancel, CommandStart, CommandHelp, CommandDefineTags, CommandDefineBudget, CommandStatistics,
+	CommandFeedback, CommandRules, CommandRenameTag, CommandMergeTags, CommandArchiveTag,
+	CommandCharts, CommandStatement, CommandExport, CommandJournal, CommandJournalAccounts, CommandCards,
+	CommandBalances, CommandTransfer, CommandReconcile,
+}
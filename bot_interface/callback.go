@@ -0,0 +1,142 @@
+package bot_interface
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Actions tell what a pressed button means. They are kept one letter long to save space in callback data
+const (
+	ActionCommand    = "c"
+	ActionTag        = "t"
+	ActionOpenTag    = "o"
+	ActionDeleteRule = "r"
+	ActionChangeTag  = "x"
+	ActionEditTag    = "e"
+	ActionColor      = "k"
+	// ActionStatistics shows statistics, its value is the same as arguments of the statistics command
+	ActionStatistics = "s"
+	// ActionCharts draws charts for the period in its value
+	ActionCharts = "g"
+	// ActionExpenses lists expenses of a tag, its value is "<period> <tag> <page>"
+	ActionExpenses      = "d"
+	ActionEditExpense   = "v"
+	ActionDeleteExpense = "z"
+	// ActionAttachments sends files attached to the expense with the id in its value
+	ActionAttachments = "f"
+	// ActionCardStatement lists expenses of a card statement, its value is "<card id> <closing day>"
+	ActionCardStatement = "n"
+	// ActionReconcile chooses an account to check, or with value "<account id> <real balance>" records the difference
+	ActionReconcile = "u"
+	// ActionImport confirms or cancels the import of a file, or lets user choose its columns
+	ActionImport = "i"
+	// ActionPage shows another page of a keyboard. It is handled by messenger adapter itself
+	ActionPage = "p"
+	// ActionInput takes the text in its value as typed by user, like a new tag name which was searched among options
+	ActionInput = "y"
+)
+
+const (
+	callbackVersion   = "1"
+	callbackSeparator = "|"
+	// storedValueMark starts a value which is kept in [CallbackStore] instead of callback data
+	storedValueMark = "~"
+	// MaxCallbackLength is the limit of callback data in Telegram
+	MaxCallbackLength = 64
+	signatureLength   = 8
+)
+
+var (
+	ErrCallbackFormat    = errors.New("wrong callback data format")
+	ErrCallbackSignature = errors.New("wrong callback signature")
+)
+
+// Callback is what a button tells the bot when it is pressed: the Action to do and the Value to do it with.
+// State is an optional piece of data signed by the bot, so a client can't change it
+type Callback struct {
+	Action string
+	Value  string
+	State  string
+}
+
+// CallbackStore keeps values which are too long for callback data and gives short keys for them
+type CallbackStore interface {
+	SaveCallbackValue(value string) (string, error)
+	GetCallbackValue(key string) (string, error)
+}
+
+// CallbackCodec turns [Callback] to a short string for a button and back. Data looks like
+//
+//	1t|Food
+//	1x||42|<signature>
+//
+// where the first symbol is the version of the format followed by an action, then go the value,
+// the state and the signature of all the previous fields
+type CallbackCodec struct {
+	Secret []byte
+	Store  CallbackStore
+}
+
+func (codec CallbackCodec) Encode(callback Callback) (string, error) {
+	if callback.Action == "" || strings.Contains(callback.Action, callbackSeparator) {
+		return "", fmt.Errorf("can't encode callback action '%s': %w", callback.Action, ErrCallbackFormat)
+	}
+	if strings.Contains(callback.State, callbackSeparator) {
+		return "", fmt.Errorf("can't encode callback state '%s': %w", callback.State, ErrCallbackFormat)
+	}
+	value := callback.Value
+	if len(codec.join(callback.Action, value, callback.State)) > MaxCallbackLength ||
+		strings.Contains(value, callbackSeparator) || strings.HasPrefix(value, storedValueMark) {
+		key, err := codec.Store.SaveCallbackValue(value)
+		if err != nil {
+			return "", fmt.Errorf("error saving long callback value: %v", err)
+		}
+		value = storedValueMark + key
+	}
+	data := codec.join(callback.Action, value, callback.State)
+	if len(data) > MaxCallbackLength {
+		return "", fmt.Errorf("callback '%s' is longer than %d bytes: %w", data, MaxCallbackLength, ErrCallbackFormat)
+	}
+	return data, nil
+}
+
+func (codec CallbackCodec) Decode(data string) (Callback, error) {
+	fields := strings.Split(data, callbackSeparator)
+	if (len(fields) != 2 && len(fields) != 4) || !strings.HasPrefix(fields[0], callbackVersion) || len(fields[0]) < 2 {
+		return Callback{}, fmt.Errorf("can't decode callback '%s': %w", data, ErrCallbackFormat)
+	}
+	callback := Callback{Action: strings.TrimPrefix(fields[0], callbackVersion), Value: fields[1]}
+	if len(fields) == 4 {
+		if !hmac.Equal([]byte(codec.sign(strings.Join(fields[:3], callbackSeparator))), []byte(fields[3])) {
+			return Callback{}, fmt.Errorf("can't decode callback '%s': %w", data, ErrCallbackSignature)
+		}
+		callback.State = fields[2]
+	}
+	if strings.HasPrefix(callback.Value, storedValueMark) {
+		value, err := codec.Store.GetCallbackValue(strings.TrimPrefix(callback.Value, storedValueMark))
+		if err != nil {
+			return Callback{}, fmt.Errorf("error getting long callback value: %v", err)
+		}
+		callback.Value = value
+	}
+	return callback, nil
+}
+
+func (codec CallbackCodec) join(action, value, state string) string {
+	data := callbackVersion + action + callbackSeparator + value
+	if state == "" {
+		return data
+	}
+	data += callbackSeparator + state
+	return data + callbackSeparator + codec.sign(data)
+}
+
+func (codec CallbackCodec) sign(data string) string {
+	mac := hmac.New(sha256.New, codec.Secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLength])
+}
@@ -0,0 +1,100 @@
+package bot_interface
+
+import (
+	"strings"
+)
+
+const (
+	DefaultColumns  = 3
+	DefaultPageSize = 18
+)
+
+// Layout hints how to arrange options of a [Message]. The zero value gives a keyboard of [DefaultColumns]
+// buttons per row split to pages of [DefaultPageSize] options without "Finish action" button
+type Layout struct {
+	Columns          int
+	PageSize         int
+	Searchable       bool
+	WithFinishOption bool
+}
+
+// Keyboard is the whole list of options of a [Message] with its layout. Messenger shows it page by page
+type Keyboard struct {
+	Layout  Layout
+	Options []Option
+}
+
+func (keyboard Keyboard) columns() int {
+	if keyboard.Layout.Columns > 0 {
+		return keyboard.Layout.Columns
+	}
+	return DefaultColumns
+}
+
+func (keyboard Keyboard) pageSize() int {
+	if keyboard.Layout.PageSize > 0 {
+		return keyboard.Layout.PageSize
+	}
+	return DefaultPageSize
+}
+
+// Pages is how many pages the keyboard takes, there is always at least one
+func (keyboard Keyboard) Pages() int {
+	pages := (len(keyboard.Options) + keyboard.pageSize() - 1) / keyboard.pageSize()
+	if pages == 0 {
+		return 1
+	}
+	return pages
+}
+
+// Rows gives options of the page arranged by rows. Full width options take a row of their own
+func (keyboard Keyboard) Rows(page int) [][]Option {
+	start := page * keyboard.pageSize()
+	if page < 0 || start >= len(keyboard.Options) {
+		return nil
+	}
+	end := start + keyboard.pageSize()
+	if end > len(keyboard.Options) {
+		end = len(keyboard.Options)
+	}
+	var rows [][]Option
+	var row []Option
+	for _, option := range keyboard.Options[start:end] {
+		if option.FullWidth {
+			if len(row) > 0 {
+				rows = append(rows, row)
+				row = nil
+			}
+			rows = append(rows, []Option{option})
+			continue
+		}
+		row = append(row, option)
+		if len(row) == keyboard.columns() {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Search leaves only options with the text inside, ignoring case. Full width options like "back" always stay
+func (keyboard Keyboard) Search(text string) Keyboard {
+	text = strings.ToLower(strings.TrimSpace(text))
+	found := Keyboard{Layout: keyboard.Layout}
+	matches := 0
+	for _, option := range keyboard.Options {
+		if strings.Contains(strings.ToLower(option.Text), text) {
+			found.Options = append(found.Options, option)
+			matches++
+		} else if option.FullWidth {
+			found.Options = append(found.Options, option)
+		}
+	}
+	if matches == 0 {
+		return Keyboard{Layout: keyboard.Layout}
+	}
+	return found
+}
@@ -0,0 +1,76 @@
+// Package cards counts statement cycles of credit cards. A statement takes purchases from the day after
+// the previous closing till the closing day and is paid on the due day. When the due day comes after
+// the closing day in a month, the statement is due in the same month, otherwise in the next one
+package cards
+
+import (
+	"time"
+)
+
+// Cycle is one statement of a card: purchases of days [Start, End) are paid on Due.
+// The statement closes on the day before End
+type Cycle struct {
+	ClosingDay int
+	DueDay     int
+	Start      time.Time
+	End        time.Time
+	Due        time.Time
+}
+
+// dayOf is the day of the month or its last day when the month is shorter
+func dayOf(year int, month time.Month, day int, location *time.Location) time.Time {
+	lastDay := time.Date(year, month+1, 0, 0, 0, 0, 0, location).Day()
+	return time.Date(year, month, min(day, lastDay), 0, 0, 0, 0, location)
+}
+
+// CycleOf is the statement a purchase of the moment lands on
+func CycleOf(closingDay, dueDay int, moment time.Time) Cycle {
+	year, month, day := moment.Date()
+	location := moment.Location()
+	closing := dayOf(year, month, closingDay, location)
+	if day > closing.Day() {
+		closing = dayOf(year, month+1, closingDay, location)
+	}
+	closingYear, closingMonth, _ := closing.Date()
+	previous := dayOf(closingYear, closingMonth-1, closingDay, location)
+	dueMonth := closingMonth
+	if dueDay <= closingDay {
+		dueMonth++
+	}
+	return Cycle{
+		ClosingDay: closingDay,
+		DueDay:     dueDay,
+		Start:      previous.AddDate(0, 0, 1),
+		End:        closing.AddDate(0, 0, 1),
+		Due:        dayOf(closingYear, dueMonth, dueDay, location),
+	}
+}
+
+// Closing is the day the statement closes
+func (cycle Cycle) Closing() time.Time {
+	return cycle.End.AddDate(0, 0, -1)
+}
+
+func (cycle Cycle) Next() Cycle {
+	return CycleOf(cycle.ClosingDay, cycle.DueDay, cycle.End)
+}
+
+func (cycle Cycle) Previous() Cycle {
+	return CycleOf(cycle.ClosingDay, cycle.DueDay, cycle.Start.AddDate(0, 0, -1))
+}
+
+// Contains tells if a purchase of the moment lands on the statement
+func (cycle Cycle) Contains(moment time.Time) bool {
+	return !moment.Before(cycle.Start) && moment.Before(cycle.End)
+}
+
+// NextDue is the statement paid next after the day: the last closed one while it isn't due yet, otherwise the open one
+func NextDue(closingDay, dueDay int, now time.Time) Cycle {
+	open := CycleOf(closingDay, dueDay, now)
+	closed := open.Previous()
+	year, month, day := now.Date()
+	if today := time.Date(year, month, day, 0, 0, 0, 0, now.Location()); !closed.Due.Before(today) {
+		return closed
+	}
+	return open
+}
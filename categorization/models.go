@@ -0,0 +1,61 @@
+package categorization
+
+import (
+	"sync"
+	"time"
+)
+
+// Models keeps a [Suggester] for every user, so history of the user is learned once and then the model
+// follows expenses as they are saved, changed and deleted. A model older than maxAge is learned again,
+// so expenses which became too old are forgotten
+type Models struct {
+	lock   sync.Mutex
+	maxAge time.Duration
+	users  map[int64]model
+}
+
+type model struct {
+	suggester *Suggester
+	learned   time.Time
+}
+
+func NewModels(maxAge time.Duration) *Models {
+	return &Models{maxAge: maxAge, users: make(map[int64]model)}
+}
+
+// Rank orders tags for the expense by the model of the user like [Suggester.Rank]. When there is no fresh model
+// it is made by learn. It tells false when the model didn't learn anything yet and the order means nothing
+func (models *Models) Rank(userID int64, learn func() (*Suggester, error), tags []string, amount float32, comment string, moment time.Time) ([]string, bool, error) {
+	models.lock.Lock()
+	defer models.lock.Unlock()
+	kept, ok := models.users[userID]
+	if !ok || moment.Sub(kept.learned) > models.maxAge {
+		suggester, err := learn()
+		if err != nil {
+			return tags, false, err
+		}
+		kept = model{suggester: suggester, learned: moment}
+		models.users[userID] = kept
+	}
+	if kept.suggester.Empty() {
+		return tags, false, nil
+	}
+	return kept.suggester.Rank(tags, amount, comment, moment), true, nil
+}
+
+// Update changes the model of the user when it is kept. Without a model nothing is done,
+// it is learned from history when it is needed
+func (models *Models) Update(userID int64, change func(suggester *Suggester)) {
+	models.lock.Lock()
+	defer models.lock.Unlock()
+	if kept, ok := models.users[userID]; ok {
+		change(kept.suggester)
+	}
+}
+
+// Forget drops the model of the user, like when tags are renamed or nested and learned names mean other tags
+func (models *Models) Forget(userID int64) {
+	models.lock.Lock()
+	defer models.lock.Unlock()
+	delete(models.users, userID)
+}
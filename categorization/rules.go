@@ -0,0 +1,222 @@
+// Package categorization decides which tag an expense belongs to when the user didn't name one.
+// Rules are written by users in a small text language, for example:
+//
+//	comment contains subte -> Transport
+//	amount < 2000 and comment matches /cafe|coffee/ -> Cafe
+package categorization
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	FieldAmount  = "amount"
+	FieldComment = "comment"
+
+	OperatorContains = "contains"
+	OperatorMatches  = "matches"
+)
+
+var amountOperators = []string{"<=", ">=", "<", ">", "="}
+
+// Condition is a single check of an expense field, like "amount < 2000"
+type Condition struct {
+	Field    string
+	Operator string
+	Value    string
+	number   float64
+	pattern  *regexp.Regexp
+}
+
+// Rule assigns [Rule.Tag] to an expense when all of its conditions are met
+type Rule struct {
+	ID         int
+	Conditions []Condition
+	Tag        string
+}
+
+// Expression gives back the conditions part of the rule in the same form users type it
+func (rule Rule) Expression() string {
+	var parts []string
+	for _, condition := range rule.Conditions {
+		parts = append(parts, condition.String())
+	}
+	return strings.Join(parts, " and ")
+}
+
+func (rule Rule) String() string {
+	return rule.Expression() + " → " + rule.Tag
+}
+
+func (condition Condition) String() string {
+	if condition.Operator == OperatorMatches {
+		return fmt.Sprintf("%s %s /%s/", condition.Field, condition.Operator, condition.Value)
+	}
+	return fmt.Sprintf("%s %s %s", condition.Field, condition.Operator, condition.Value)
+}
+
+// ParseRule reads a full rule typed by user: conditions, an arrow ("->" or "→") and a tag
+func ParseRule(text string) (Rule, error) {
+	text = strings.ReplaceAll(text, "→", "->")
+	idx := strings.LastIndex(text, "->")
+	if idx == -1 {
+		return Rule{}, errors.New("rule must have an arrow '->' followed by a tag")
+	}
+	tag := strings.TrimSpace(text[idx+2:])
+	if tag == "" || strings.Contains(tag, " ") {
+		return Rule{}, errors.New("rule must end with a single tag")
+	}
+	conditions, err := ParseConditions(text[:idx])
+	if err != nil {
+		return Rule{}, err
+	}
+	return Rule{Conditions: conditions, Tag: tag}, nil
+}
+
+// ParseConditions reads conditions joined with "and", like "amount < 2000 and comment contains cafe"
+func ParseConditions(expression string) ([]Condition, error) {
+	var conditions []Condition
+	for _, part := range splitByAnd(expression) {
+		condition, err := parseCondition(part)
+		if err != nil {
+			return nil, err
+		}
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) == 0 {
+		return nil, errors.New("rule must have at least one condition")
+	}
+	return conditions, nil
+}
+
+// splitByAnd cuts the expression at words "and" which are outside of /.../ patterns, so a condition like
+// "comment matches /rock and roll/" stays whole and keeps spaces of its pattern
+func splitByAnd(expression string) []string {
+	var parts []string
+	start, previous, inPattern := 0, "", false
+	for i := 0; i < len(expression); {
+		if expression[i] == ' ' || expression[i] == '\t' || expression[i] == '\n' {
+			i++
+			continue
+		}
+		wordStart := i
+		for i < len(expression) && expression[i] != ' ' && expression[i] != '\t' && expression[i] != '\n' {
+			i++
+		}
+		word := expression[wordStart:i]
+		switch {
+		case inPattern:
+			inPattern = !closesPattern(word)
+		case strings.EqualFold(previous, OperatorMatches) && strings.HasPrefix(word, "/"):
+			inPattern = !closesPattern(word[1:])
+		case strings.EqualFold(word, "and"):
+			parts = append(parts, strings.TrimSpace(expression[start:wordStart]))
+			start = i
+		}
+		previous = word
+	}
+	if last := strings.TrimSpace(expression[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// closesPattern tells if the word ends a /.../ pattern with a slash which isn't escaped
+func closesPattern(word string) bool {
+	return strings.HasSuffix(word, "/") && !strings.HasSuffix(word, `\/`)
+}
+
+func parseCondition(text string) (Condition, error) {
+	text = strings.TrimSpace(text)
+	field, rest, _ := strings.Cut(text, " ")
+	field = strings.ToLower(field)
+	rest = strings.TrimSpace(rest)
+	switch field {
+	case FieldAmount:
+		for _, operator := range amountOperators {
+			if strings.HasPrefix(rest, operator) {
+				value := strings.TrimSpace(strings.TrimPrefix(rest, operator))
+				number, err := strconv.ParseFloat(value, 32)
+				if err != nil {
+					return Condition{}, fmt.Errorf("can't read number '%s' in condition '%s'", value, text)
+				}
+				return Condition{Field: field, Operator: operator, Value: value, number: number}, nil
+			}
+		}
+		return Condition{}, fmt.Errorf("amount must be compared with one of %s in condition '%s'", strings.Join(amountOperators, " "), text)
+	case FieldComment:
+		operator, value, _ := strings.Cut(rest, " ")
+		operator = strings.ToLower(operator)
+		value = strings.TrimSpace(value)
+		switch operator {
+		case OperatorContains:
+			value = strings.ToLower(strings.Trim(value, `'"`))
+			if value == "" {
+				return Condition{}, fmt.Errorf("nothing to look for in condition '%s'", text)
+			}
+			return Condition{Field: field, Operator: operator, Value: value}, nil
+		case OperatorMatches:
+			value = strings.TrimSuffix(strings.TrimPrefix(value, "/"), "/")
+			pattern, err := regexp.Compile("(?i)" + value)
+			if err != nil || value == "" {
+				return Condition{}, fmt.Errorf("wrong pattern '%s' in condition '%s'", value, text)
+			}
+			return Condition{Field: field, Operator: operator, Value: value, pattern: pattern}, nil
+		default:
+			return Condition{}, fmt.Errorf("comment can be checked only with '%s' or '%s' in condition '%s'", OperatorContains, OperatorMatches, text)
+		}
+	default:
+		return Condition{}, fmt.Errorf("unknown field '%s', use '%s' or '%s'", field, FieldAmount, FieldComment)
+	}
+}
+
+func (condition Condition) matches(amount float32, comment string) bool {
+	switch condition.Field {
+	case FieldAmount:
+		value := float64(amount)
+		switch condition.Operator {
+		case "<":
+			return value < condition.number
+		case "<=":
+			return value <= condition.number
+		case ">":
+			return value > condition.number
+		case ">=":
+			return value >= condition.number
+		case "=":
+			return value == condition.number
+		}
+	case FieldComment:
+		switch condition.Operator {
+		case OperatorContains:
+			return strings.Contains(strings.ToLower(comment), condition.Value)
+		case OperatorMatches:
+			return condition.pattern.MatchString(comment)
+		}
+	}
+	return false
+}
+
+// Matches tells if the expense fits all conditions of the rule
+func (rule Rule) Matches(amount float32, comment string) bool {
+	for _, condition := range rule.Conditions {
+		if !condition.matches(amount, comment) {
+			return false
+		}
+	}
+	return len(rule.Conditions) > 0
+}
+
+// FindRule returns the first rule the expense fits. Rules are checked in the given order
+func FindRule(rules []Rule, amount float32, comment string) (Rule, bool) {
+	for _, rule := range rules {
+		if rule.Matches(amount, comment) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
@@ -0,0 +1,50 @@
+package categorization
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRuleKeepsAndInsidePatterns(t *testing.T) {
+	tests := []struct {
+		text       string
+		expression string
+	}{
+		{"amount < 2000 and comment contains cafe -> Cafe", "amount < 2000 and comment contains cafe"},
+		{"comment matches /rock and roll/ -> Music", "comment matches /rock and roll/"},
+		{"comment matches /rock  and   roll/ and amount > 100 -> Music", "comment matches /rock  and   roll/ and amount > 100"},
+		{"comment matches /a\\/ and b/ -> Other", "comment matches /a\\/ and b/"},
+		{"comment contains km/h and amount < 10 → Transport", "comment contains km/h and amount < 10"},
+	}
+	for _, test := range tests {
+		rule, err := ParseRule(test.text)
+		if err != nil {
+			t.Errorf("ParseRule(%q): %v", test.text, err)
+			continue
+		}
+		if got := rule.Expression(); got != test.expression {
+			t.Errorf("ParseRule(%q) gives %q, want %q", test.text, got, test.expression)
+		}
+	}
+}
+
+func TestRuleMatchesPatternWithAnd(t *testing.T) {
+	rule, err := ParseRule("comment matches /rock and roll/ -> Music")
+	if err != nil {
+		t.Fatalf("ParseRule: %v", err)
+	}
+	if !rule.Matches(100, "Rock and Roll tickets") {
+		t.Error("rule doesn't match a comment with its pattern")
+	}
+	if rule.Matches(100, "rock concert") {
+		t.Error("rule matches a comment without its pattern")
+	}
+}
+
+func TestSplitByAnd(t *testing.T) {
+	got := splitByAnd(" amount > 1 AND comment matches /x and y/  and comment contains z ")
+	want := []string{"amount > 1", "comment matches /x and y/", "comment contains z"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("splitByAnd = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package categorization
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Suggester learns from user's own expenses which tag fits a new expense best.
+// It is a naive Bayes classifier over comment words, amount range, weekday and time of day.
+// Learning is incremental: every [Suggester.Learn] call adds one more expense to the model and
+// [Suggester.Forget] takes it back. Nothing is random, so the same history always gives the same suggestions
+type Suggester struct {
+	examples      int
+	tagExamples   map[string]int
+	tagFeatures   map[string]int
+	featureCounts map[string]map[string]int
+	// vocabulary counts how many times every feature was learned
+	vocabulary map[string]int
+}
+
+func NewSuggester() *Suggester {
+	return &Suggester{
+		tagExamples:   make(map[string]int),
+		tagFeatures:   make(map[string]int),
+		featureCounts: make(map[string]map[string]int),
+		vocabulary:    make(map[string]int),
+	}
+}
+
+// Learn adds an expense recorded with the tag to the model
+func (suggester *Suggester) Learn(tag string, amount float32, comment string, moment time.Time) {
+	tag = strings.ToLower(tag)
+	suggester.examples++
+	suggester.tagExamples[tag]++
+	if suggester.featureCounts[tag] == nil {
+		suggester.featureCounts[tag] = make(map[string]int)
+	}
+	for _, feature := range features(amount, comment, moment) {
+		suggester.featureCounts[tag][feature]++
+		suggester.tagFeatures[tag]++
+		suggester.vocabulary[feature]++
+	}
+}
+
+// Forget takes back an expense learned with the tag, like when the expense is deleted or moved to another tag
+func (suggester *Suggester) Forget(tag string, amount float32, comment string, moment time.Time) {
+	tag = strings.ToLower(tag)
+	if suggester.tagExamples[tag] == 0 {
+		return
+	}
+	suggester.examples--
+	if suggester.tagExamples[tag]--; suggester.tagExamples[tag] == 0 {
+		delete(suggester.tagExamples, tag)
+	}
+	for _, feature := range features(amount, comment, moment) {
+		if suggester.featureCounts[tag][feature] == 0 {
+			continue
+		}
+		if suggester.featureCounts[tag][feature]--; suggester.featureCounts[tag][feature] == 0 {
+			delete(suggester.featureCounts[tag], feature)
+		}
+		suggester.tagFeatures[tag]--
+		if suggester.vocabulary[feature]--; suggester.vocabulary[feature] == 0 {
+			delete(suggester.vocabulary, feature)
+		}
+	}
+}
+
+// Empty tells that the model didn't learn anything yet, so its ranking means nothing
+func (suggester *Suggester) Empty() bool {
+	return suggester.examples == 0
+}
+
+// Rank orders tags from the most to the least likely for the expense.
+// Tags with equal chances keep the order they were given in
+func (suggester *Suggester) Rank(tags []string, amount float32, comment string, moment time.Time) []string {
+	expenseFeatures := features(amount, comment, moment)
+	scores := make([]float64, len(tags))
+	for i, tag := range tags {
+		scores[i] = suggester.score(strings.ToLower(tag), expenseFeatures, len(tags))
+	}
+	indexes := make([]int, len(tags))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return scores[indexes[a]] > scores[indexes[b]]
+	})
+	ranked := make([]string, len(tags))
+	for i, index := range indexes {
+		ranked[i] = tags[index]
+	}
+	return ranked
+}
+
+func (suggester *Suggester) score(tag string, expenseFeatures []string, tagsCount int) float64 {
+	score := math.Log(float64(suggester.tagExamples[tag]+1) / float64(suggester.examples+tagsCount))
+	vocabularySize := len(suggester.vocabulary) + 1
+	for _, feature := range expenseFeatures {
+		count := suggester.featureCounts[tag][feature]
+		score += math.Log(float64(count+1) / float64(suggester.tagFeatures[tag]+vocabularySize))
+	}
+	return score
+}
+
+// features describe an expense for the model: comment words, order of magnitude of the amount,
+// day of the week and part of the day
+func features(amount float32, comment string, moment time.Time) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(comment), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) > 1 {
+			result = append(result, "word:"+word)
+		}
+	}
+	if amount > 0 {
+		result = append(result, "amount:"+strconv.Itoa(int(math.Floor(2*math.Log10(float64(amount))))))
+	}
+	result = append(result, "weekday:"+moment.Weekday().String())
+	result = append(result, "time:"+partOfDay(moment))
+	return result
+}
+
+func partOfDay(moment time.Time) string {
+	switch hour := moment.Hour(); {
+	case hour < 6:
+		return "night"
+	case hour < 12:
+		return "morning"
+	case hour < 18:
+		return "afternoon"
+	default:
+		return "evening"
+	}
+}
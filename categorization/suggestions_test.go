@@ -0,0 +1,156 @@
+package categorization
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// monday is a fixed moment, so weekday and part of the day features don't depend on when tests run
+var monday = time.Date(2024, time.March, 4, 13, 0, 0, 0, time.UTC)
+
+func TestRankPutsLearnedTagFirst(t *testing.T) {
+	suggester := NewSuggester()
+	for i := 0; i < 3; i++ {
+		suggester.Learn("Food", 1500, "coffee", monday)
+		suggester.Learn("Transport", 2000, "taxi home", monday)
+	}
+	tests := []struct {
+		comment string
+		want    []string
+	}{
+		{"coffee", []string{"Food", "Transport", "Home"}},
+		{"taxi", []string{"Transport", "Food", "Home"}},
+	}
+	for _, test := range tests {
+		got := suggester.Rank([]string{"Home", "Food", "Transport"}, 1500, test.comment, monday)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Rank for %q = %v, want %v", test.comment, got, test.want)
+		}
+	}
+}
+
+func TestRankIgnoresCaseOfTags(t *testing.T) {
+	suggester := NewSuggester()
+	suggester.Learn("food", 1500, "coffee", monday)
+	got := suggester.Rank([]string{"Home", "Food"}, 1500, "coffee", monday)
+	if want := []string{"Food", "Home"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank = %v, want %v", got, want)
+	}
+}
+
+func TestRankKeepsGivenOrderOfEqualTags(t *testing.T) {
+	tags := []string{"Home", "Food", "Transport", "Fun"}
+	empty := NewSuggester()
+	if got := empty.Rank(tags, 100, "anything", monday); !reflect.DeepEqual(got, tags) {
+		t.Errorf("Rank of an empty model = %v, want %v", got, tags)
+	}
+
+	// Food and Fun learned the same, so they are equal and keep their order after the learned ones
+	suggester := NewSuggester()
+	suggester.Learn("Food", 500, "lunch", monday)
+	suggester.Learn("Fun", 500, "lunch", monday)
+	got := suggester.Rank(tags, 500, "lunch", monday)
+	if want := []string{"Food", "Fun", "Home", "Transport"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank with a tie = %v, want %v", got, want)
+	}
+}
+
+func TestRankIsDeterministic(t *testing.T) {
+	learn := func() *Suggester {
+		suggester := NewSuggester()
+		suggester.Learn("Food", 1500, "coffee", monday)
+		suggester.Learn("Transport", 900, "subte", monday.Add(-18*time.Hour))
+		suggester.Learn("Home", 90000, "rent", monday.AddDate(0, 0, -3))
+		return suggester
+	}
+	tags := []string{"Home", "Food", "Transport"}
+	first := learn().Rank(tags, 1000, "coffee subte", monday)
+	for i := 0; i < 20; i++ {
+		if got := learn().Rank(tags, 1000, "coffee subte", monday); !reflect.DeepEqual(got, first) {
+			t.Fatalf("Rank = %v, earlier it was %v", got, first)
+		}
+	}
+}
+
+func TestForgetTakesBackLearn(t *testing.T) {
+	base := NewSuggester()
+	base.Learn("Food", 1500, "coffee", monday)
+	base.Learn("Transport", 900, "subte", monday)
+
+	changed := NewSuggester()
+	changed.Learn("Food", 1500, "coffee", monday)
+	changed.Learn("Transport", 900, "subte", monday)
+	changed.Learn("Transport", 1500, "coffee to go", monday)
+	changed.Forget("Transport", 1500, "coffee to go", monday)
+	if !reflect.DeepEqual(base, changed) {
+		t.Errorf("model after Learn and Forget = %+v, want %+v", changed, base)
+	}
+
+	changed.Forget("Home", 100, "never learned", monday)
+	if !reflect.DeepEqual(base, changed) {
+		t.Errorf("forgetting an unknown tag changed the model: %+v", changed)
+	}
+
+	changed.Forget("Food", 1500, "coffee", monday)
+	changed.Forget("Transport", 900, "subte", monday)
+	if !changed.Empty() {
+		t.Errorf("model is not empty after forgetting everything: %+v", changed)
+	}
+}
+
+func TestModelsLearnOnceAndFollowUpdates(t *testing.T) {
+	models := NewModels(24 * time.Hour)
+	learned := 0
+	learn := func() (*Suggester, error) {
+		learned++
+		suggester := NewSuggester()
+		for i := 0; i < 3; i++ {
+			suggester.Learn("Food", 1500, "coffee", monday)
+		}
+		return suggester, nil
+	}
+	tags := []string{"Transport", "Food"}
+	got, ok, err := models.Rank(1, learn, tags, 1500, "subte", monday)
+	if err != nil || !ok || !reflect.DeepEqual(got, []string{"Food", "Transport"}) {
+		t.Fatalf("Rank = %v, %v, %v", got, ok, err)
+	}
+	models.Update(1, func(suggester *Suggester) {
+		for i := 0; i < 5; i++ {
+			suggester.Learn("Transport", 1500, "subte", monday)
+		}
+	})
+	got, _, _ = models.Rank(1, learn, tags, 1500, "subte", monday.Add(time.Hour))
+	if want := []string{"Transport", "Food"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Rank after update = %v, want %v", got, want)
+	}
+	if learned != 1 {
+		t.Errorf("history is learned %d times, want once", learned)
+	}
+
+	models.Rank(1, learn, tags, 900, "subte", monday.Add(25*time.Hour))
+	if learned != 2 {
+		t.Errorf("an old model is not learned again: learned %d times", learned)
+	}
+	models.Forget(1)
+	models.Rank(1, learn, tags, 900, "subte", monday.Add(25*time.Hour))
+	if learned != 3 {
+		t.Errorf("a forgotten model is not learned again: learned %d times", learned)
+	}
+}
+
+func TestModelsUpdateWithoutModelDoesNothing(t *testing.T) {
+	models := NewModels(time.Hour)
+	models.Update(7, func(*Suggester) { t.Error("update is called without a model") })
+
+	failure := errors.New("no history")
+	got, ok, err := models.Rank(7, func() (*Suggester, error) { return nil, failure }, []string{"Food"}, 1, "", monday)
+	if !errors.Is(err, failure) || ok || !reflect.DeepEqual(got, []string{"Food"}) {
+		t.Errorf("Rank with failing history = %v, %v, %v", got, ok, err)
+	}
+	_, ok, err = models.Rank(7, func() (*Suggester, error) { return NewSuggester(), nil }, []string{"Food"}, 1, "", monday)
+	if ok || err != nil {
+		t.Errorf("Rank with an empty model = %v, %v, want false and no error", ok, err)
+	}
+}
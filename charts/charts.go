@@ -0,0 +1,276 @@
+// Package charts draws spending reports as PNG images with the standard library only
+package charts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	width     = 800
+	height    = 500
+	margin    = 30
+	textScale = 2
+	lineScale = textScale * (glyphHeight + 3)
+)
+
+var (
+	background = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	foreground = color.RGBA{R: 0x21, G: 0x21, B: 0x21, A: 0xff}
+	muted      = color.RGBA{R: 0xbd, G: 0xbd, B: 0xbd, A: 0xff}
+	overBudget = color.RGBA{R: 0xe5, G: 0x39, B: 0x35, A: 0xff}
+	// palette colors tags without their own color
+	palette = []color.RGBA{
+		{R: 0x1e, G: 0x88, B: 0xe5, A: 0xff},
+		{R: 0x43, G: 0xa0, B: 0x47, A: 0xff},
+		{R: 0xfb, G: 0x8c, B: 0x00, A: 0xff},
+		{R: 0x8e, G: 0x24, B: 0xaa, A: 0xff},
+		{R: 0x00, G: 0xac, B: 0xc1, A: 0xff},
+		{R: 0xf4, G: 0x51, B: 0x1e, A: 0xff},
+		{R: 0x6d, G: 0x4c, B: 0x41, A: 0xff},
+		{R: 0xd8, G: 0x1b, B: 0x60, A: 0xff},
+		{R: 0x54, G: 0x6e, B: 0x7a, A: 0xff},
+		{R: 0xc0, G: 0xca, B: 0x33, A: 0xff},
+	}
+)
+
+var ErrNoData = errors.New("nothing to draw")
+
+// Slice is a part of a pie. Color is like "#1e88e5", an empty one is taken from the palette
+type Slice struct {
+	Label string
+	Value float32
+	Color string
+}
+
+// Bar compares Actual spending of a tag with its Budget
+type Bar struct {
+	Label  string
+	Actual float32
+	Budget float32
+	Color  string
+}
+
+// Pie draws shares of the slices in a circle with a legend on the right. Slices without value are skipped
+func Pie(title string, slices []Slice) ([]byte, error) {
+	var total float64
+	var visible []Slice
+	for _, slice := range slices {
+		if slice.Value > 0 {
+			visible = append(visible, slice)
+			total += float64(slice.Value)
+		}
+	}
+	if total == 0 {
+		return nil, ErrNoData
+	}
+	img := newCanvas(title)
+	radius := (height - 2*margin - lineScale) / 2
+	centerX, centerY := margin+radius, margin+lineScale+radius
+	colors := make([]color.RGBA, len(visible))
+	bounds := make([]float64, len(visible))
+	var cumulative float64
+	for i, slice := range visible {
+		colors[i] = sliceColor(slice.Color, i)
+		cumulative += float64(slice.Value) / total
+		bounds[i] = cumulative
+	}
+	for y := -radius; y <= radius; y++ {
+		for x := -radius; x <= radius; x++ {
+			if x*x+y*y > radius*radius {
+				continue
+			}
+			// angles go clockwise from the top
+			share := math.Atan2(float64(x), float64(-y)) / (2 * math.Pi)
+			if share < 0 {
+				share++
+			}
+			for i, bound := range bounds {
+				if share <= bound || i == len(bounds)-1 {
+					img.SetRGBA(centerX+x, centerY+y, colors[i])
+					break
+				}
+			}
+		}
+	}
+	legendX, legendY := centerX+radius+margin, margin+lineScale
+	for i, slice := range visible {
+		if legendY+lineScale > height-margin {
+			break
+		}
+		fillRect(img, legendX, legendY, lineScale-4, lineScale-4, colors[i])
+		label := fmt.Sprintf("%s %s (%.0f%%)", slice.Label, formatAmount(slice.Value), 100*float64(slice.Value)/total)
+		drawText(img, legendX+lineScale, legendY+2, fitText(label, width-margin-legendX-lineScale), foreground, textScale)
+		legendY += lineScale + 4
+	}
+	return encode(img)
+}
+
+// BudgetBars draws a gray budget bar for every tag with the actual spending over it. Spending above the budget is red
+func BudgetBars(title string, bars []Bar) ([]byte, error) {
+	if len(bars) == 0 {
+		return nil, ErrNoData
+	}
+	var maximum float32
+	for _, bar := range bars {
+		maximum = float32(math.Max(float64(maximum), math.Max(float64(bar.Actual), float64(bar.Budget))))
+	}
+	if maximum <= 0 {
+		return nil, ErrNoData
+	}
+	img := newCanvas(title)
+	rowHeight := (height - 2*margin - lineScale) / len(bars)
+	if rowHeight > 3*lineScale {
+		rowHeight = 3 * lineScale
+	}
+	barHeight := rowHeight - lineScale - 6
+	if barHeight < 2 {
+		barHeight = 2
+	}
+	scale := float32(width-2*margin) / maximum
+	y := margin + lineScale
+	for i, bar := range bars {
+		if y+rowHeight > height-margin+1 {
+			break
+		}
+		label := fmt.Sprintf("%s %s / %s", bar.Label, formatAmount(bar.Actual), formatAmount(bar.Budget))
+		drawText(img, margin, y, fitText(label, width-2*margin), foreground, textScale)
+		barY := y + lineScale
+		fillRect(img, margin, barY, int(bar.Budget*scale), barHeight, muted)
+		within := bar.Actual
+		if within > bar.Budget {
+			within = bar.Budget
+		}
+		fillRect(img, margin, barY, int(within*scale), barHeight, sliceColor(bar.Color, i))
+		if bar.Actual > bar.Budget {
+			fillRect(img, margin+int(bar.Budget*scale), barY, int((bar.Actual-bar.Budget)*scale), barHeight, overBudget)
+		}
+		y += rowHeight
+	}
+	return encode(img)
+}
+
+// PaceLine draws cumulative spending day by day against the straight line of spending the budget evenly over
+// all the days of the period. Without a budget there is no pace line
+func PaceLine(title string, cumulative []float32, days int, budget float32) ([]byte, error) {
+	if len(cumulative) == 0 || days <= 0 {
+		return nil, ErrNoData
+	}
+	maximum := budget
+	for _, value := range cumulative {
+		if value > maximum {
+			maximum = value
+		}
+	}
+	if maximum <= 0 {
+		return nil, ErrNoData
+	}
+	img := newCanvas(title)
+	left, top := margin+textWidth("000000", textScale), margin+2*lineScale
+	right, bottom := width-margin, height-margin-lineScale
+	point := func(day int, value float32) (int, int) {
+		return left + (right-left)*day/days, bottom - int(float32(bottom-top)*value/maximum)
+	}
+	drawLine(img, left, bottom, right, bottom, foreground, 1)
+	drawLine(img, left, top, left, bottom, foreground, 1)
+	drawText(img, margin, top, formatAmount(maximum), foreground, textScale)
+	drawText(img, margin, bottom-glyphHeight*textScale, "0", foreground, textScale)
+	drawText(img, left, bottom+6, "1", foreground, textScale)
+	lastDay := strconv.Itoa(days)
+	drawText(img, right-textWidth(lastDay, textScale), bottom+6, lastDay, foreground, textScale)
+	legendY := margin + lineScale
+	if budget > 0 {
+		x0, y0 := point(0, 0)
+		x1, y1 := point(days, budget)
+		drawDashedLine(img, x0, y0, x1, y1, muted, 2)
+		fillRect(img, right-textWidth("PACE", textScale)-lineScale, legendY, lineScale-4, lineScale-4, muted)
+		drawText(img, right-textWidth("PACE", textScale), legendY+2, "PACE", foreground, textScale)
+	}
+	lineColor := palette[0]
+	if budget > 0 && cumulative[len(cumulative)-1] > budget*float32(len(cumulative))/float32(days) {
+		lineColor = overBudget
+	}
+	previousX, previousY := point(0, 0)
+	for day, value := range cumulative {
+		x, y := point(day+1, value)
+		drawLine(img, previousX, previousY, x, y, lineColor, 3)
+		previousX, previousY = x, y
+	}
+	fillRect(img, left+margin, legendY, lineScale-4, lineScale-4, lineColor)
+	drawText(img, left+margin+lineScale, legendY+2, "SPENT "+formatAmount(cumulative[len(cumulative)-1]), foreground, textScale)
+	return encode(img)
+}
+
+func newCanvas(title string) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+	drawText(img, margin, margin/2, fitText(title, width-2*margin), foreground, textScale)
+	return img
+}
+
+func encode(img image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return nil, fmt.Errorf("error encoding chart: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+// sliceColor parses a color like "#1e88e5" or takes the color from the palette by index
+func sliceColor(hex string, index int) color.RGBA {
+	if value, err := strconv.ParseUint(strings.TrimPrefix(hex, "#"), 16, 32); err == nil && len(hex) == 7 && hex[0] == '#' {
+		return color.RGBA{R: uint8(value >> 16), G: uint8(value >> 8), B: uint8(value), A: 0xff}
+	}
+	return palette[index%len(palette)]
+}
+
+func formatAmount(amount float32) string {
+	return strconv.FormatFloat(math.Round(float64(amount)), 'f', 0, 64)
+}
+
+// fitText cuts the text to fit the width in pixels
+func fitText(text string, maxWidth int) string {
+	runes := []rune(text)
+	maxRunes := maxWidth / ((glyphWidth + glyphSpacing) * textScale)
+	if len(runes) > maxRunes && maxRunes > 0 {
+		return string(runes[:maxRunes])
+	}
+	return text
+}
+
+func fillRect(img *image.RGBA, x, y, w, h int, fillColor color.Color) {
+	draw.Draw(img, image.Rect(x, y, x+w, y+h), &image.Uniform{C: fillColor}, image.Point{}, draw.Src)
+}
+
+// drawLine draws a line of the thickness in pixels from x0, y0 to x1, y1
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, lineColor color.Color, thickness int) {
+	steps := int(math.Max(math.Abs(float64(x1-x0)), math.Abs(float64(y1-y0))))
+	for step := 0; step <= steps; step++ {
+		x, y := x0, y0
+		if steps > 0 {
+			x = x0 + (x1-x0)*step/steps
+			y = y0 + (y1-y0)*step/steps
+		}
+		fillRect(img, x-thickness/2, y-thickness/2, thickness, thickness, lineColor)
+	}
+}
+
+func drawDashedLine(img *image.RGBA, x0, y0, x1, y1 int, lineColor color.Color, thickness int) {
+	const dash = 10
+	steps := int(math.Max(math.Abs(float64(x1-x0)), math.Abs(float64(y1-y0))))
+	for step := 0; step < steps; step += 2 * dash {
+		end := step + dash
+		if end > steps {
+			end = steps
+		}
+		drawLine(img, x0+(x1-x0)*step/steps, y0+(y1-y0)*step/steps, x0+(x1-x0)*end/steps, y0+(y1-y0)*end/steps, lineColor, thickness)
+	}
+}
@@ -0,0 +1,160 @@
+// Package cli lets the binary do one job from the command line instead of running the bot, like
+//
+//	ingresos_gastos journal -user 12345 -format beancount -period 2024
+//	ingresos_gastos import -user 12345 statement.ofx
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"ingresos_gastos/importing"
+	"ingresos_gastos/ledger"
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+)
+
+var ErrUnknownCommand = errors.New("unknown command")
+
+type command func(storage storage_interface.ActualStorage, args []string, output io.Writer) error
+
+var commands = map[string]command{
+	"journal": journal,
+	"import":  importFile,
+}
+
+// Run does the command named by the first argument with the rest of arguments
+func Run(args []string, storage storage_interface.ActualStorage, output io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command, use one of %s: %w", strings.Join(names(), ", "), ErrUnknownCommand)
+	}
+	run, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("'%s', use one of %s: %w", args[0], strings.Join(names(), ", "), ErrUnknownCommand)
+	}
+	return run(storage, args[1:], output)
+}
+
+func names() []string {
+	var result []string
+	for name := range commands {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// journal writes user's expenses as a plain-text accounting journal
+func journal(storage storage_interface.ActualStorage, args []string, output io.Writer) error {
+	flags := flag.NewFlagSet("journal", flag.ContinueOnError)
+	userID := flags.Int64("user", 0, "telegram id of the user")
+	format := flags.String("format", ledger.FormatLedger, "journal format: "+strings.Join(ledger.Formats, ", "))
+	periodText := flags.String("period", "", "period like 2024-03, 2024 or 2024-01-01..2024-06-30, the current month by default")
+	accountsFile := flags.String("accounts", "", "file with lines like 'Food = Expenses:Groceries' applied over the user's saved accounts")
+	outputFile := flags.String("o", "", "file to write the journal to, standard output by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == 0 {
+		return errors.New("-user is required")
+	}
+	period, err := reports.ParsePeriod(*periodText, time.Now())
+	if err != nil {
+		return err
+	}
+	var overrides string
+	if *accountsFile != "" {
+		content, errReading := os.ReadFile(*accountsFile)
+		if errReading != nil {
+			return fmt.Errorf("error reading accounts: %v", errReading)
+		}
+		overrides = string(content)
+	}
+	content, err := ledger.Export(storage, *userID, *format, period.Start, period.End, overrides)
+	if err != nil {
+		return err
+	}
+	if *outputFile != "" {
+		return os.WriteFile(*outputFile, content, 0o644)
+	}
+	_, err = output.Write(content)
+	return err
+}
+
+// importFile records expenses of a CSV, OFX or QIF file skipping the ones which are already recorded
+func importFile(storage storage_interface.ActualStorage, args []string, output io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	userID := flags.Int64("user", 0, "telegram id of the user")
+	columns := flags.String("columns", "", "columns of a CSV file like '"+importing.RoleDate+"=1, "+importing.RoleAmount+"=3, "+importing.RoleDescription+"=2', saved or guessed ones by default")
+	dryRun := flags.Bool("dry-run", false, "only show what would be imported")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *userID == 0 {
+		return errors.New("-user is required")
+	}
+	if flags.NArg() != 1 {
+		return errors.New("one file to import is required")
+	}
+	fileName := flags.Arg(0)
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("error reading file: %v", err)
+	}
+	format, err := importing.FormatOf(fileName)
+	if err != nil {
+		return err
+	}
+	if format == importing.FormatCSV && *columns == "" {
+		*columns, err = csvColumns(storage, *userID, content)
+		if err != nil {
+			return err
+		}
+	}
+	events, problems, err := importing.ReadEvents(fileName, content, *columns)
+	if err != nil {
+		return err
+	}
+	plan, err := importing.NewPlan(storage, *userID, events)
+	if err != nil {
+		return err
+	}
+	for _, event := range plan.Fresh {
+		fmt.Fprintf(output, "%s %10.2f %s [%s] %s\n", event.Created.Format(time.DateOnly), event.Amount, event.Currency, event.Tag, event.Comment)
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(output, "not imported: %s\n", problem)
+	}
+	if !*dryRun {
+		if err = storage.CreateMoneyEvents(plan.Fresh, *userID); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(output, "new: %d (tagged: %d), already recorded: %d, not imported: %d\n", len(plan.Fresh), plan.Tagged(), len(plan.Duplicates), len(problems))
+	return nil
+}
+
+// csvColumns gives columns the user saved for files like this one or guesses them
+func csvColumns(storage storage_interface.ActualStorage, userID int64, content []byte) (string, error) {
+	table, err := importing.ReadCSV(content)
+	if err != nil {
+		return "", err
+	}
+	profile, err := storage.GetImportProfile(userID, table.Signature())
+	if err != nil {
+		return "", err
+	}
+	if profile != "" {
+		return profile, nil
+	}
+	if columns, complete := importing.DetectColumns(table); complete {
+		return columns.String(), nil
+	}
+	return "", fmt.Errorf("use -columns, file has columns %s: %w", strings.Join(table.Header, ", "), importing.ErrUnknownColumns)
+}
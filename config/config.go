@@ -3,6 +3,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 )
 
@@ -13,6 +14,12 @@ type Config struct {
 	PGPass     string
 	PGDbname   string
 	TgBotToken string
+	// CallbackSecret signs state kept in buttons and statement download links
+	CallbackSecret string
+	// PublicURL is the address of the HTTP server for users, like https://bot.example.com. Without it there are no download links
+	PublicURL string
+	// BlobStore is where attachments of expenses are kept, a directory or a URL like file:///var/lib/bot/attachments
+	BlobStore string
 }
 
 func GetConfigFromEnv() Config {
@@ -23,6 +30,24 @@ func GetConfigFromEnv() Config {
 		PGAdmin:    os.Getenv("PGADMIN"),
 		PGPass:     os.Getenv("PGPASS"),
 		TgBotToken: os.Getenv("TGTOKEN"),
+
+		CallbackSecret: os.Getenv("CALLBACK_SECRET"),
+		PublicURL:      os.Getenv("PUBLIC_URL"),
+		BlobStore:      os.Getenv("BLOB_STORE"),
 	}
 	return cfg
 }
+
+// String shows the settings without secrets: the database password, the bot token and the callback secret
+func (cfg Config) String() string {
+	return fmt.Sprintf("{PGHost:%s PGPort:%s PGAdmin:%s PGPass:%s PGDbname:%s TgBotToken:%s CallbackSecret:%s PublicURL:%s BlobStore:%s}",
+		cfg.PGHost, cfg.PGPort, cfg.PGAdmin, redacted(cfg.PGPass), cfg.PGDbname, redacted(cfg.TgBotToken), redacted(cfg.CallbackSecret), cfg.PublicURL, cfg.BlobStore)
+}
+
+// redacted tells only if the secret is set
+func redacted(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "***"
+}
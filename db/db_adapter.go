@@ -7,13 +7,15 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"ingresos_gastos/config"
 	"ingresos_gastos/storage_interface"
+	"ingresos_gastos/tagpolicy"
 
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresAdapter struct {
@@ -47,6 +49,23 @@ func (db PostgresAdapter) CreateUser(userID int64, name string) error {
 	return nil
 }
 
+func (db PostgresAdapter) GetUsers() ([]storage_interface.User, error) {
+	rows, err := db.dbInside.Query("SELECT id, name, COALESCE(status, ''), created FROM users ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error selecting users: %v", err)
+	}
+	defer rows.Close()
+	var users []storage_interface.User
+	for rows.Next() {
+		var user storage_interface.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.State, &user.Created); err != nil {
+			return nil, fmt.Errorf("error unwrapping user in GetUsers: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
 func (db PostgresAdapter) UserExists(userID int64) (bool, error) {
 	row := db.dbInside.QueryRow("SELECT name FROM users WHERE id = $1", userID)
 	var name string
@@ -77,21 +96,74 @@ func (db PostgresAdapter) GetUserState(userID int64) (string, error) {
 	return state, nil
 }
 
+// maxEmojiLength is the size of tags.emoji
+const maxEmojiLength = 16
+
+// nextTagPosition puts new tags to the end of the user's list
+const nextTagPosition = "(SELECT COALESCE(MAX(sort_order) + 1, 0) FROM tags WHERE user_id = $2)"
+
+// tagID finds the tag of the user by name
+func (db PostgresAdapter) tagID(tag string, userID int64) (int, error) {
+	var id int
+	err := db.dbInside.QueryRow("SELECT id FROM tags WHERE LOWER(name) = LOWER($1) AND user_id = $2", tag, userID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("error getting id of tag '%s' for user %d: no such tag", tag, userID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error getting id of tag '%s' for user %d: %v", tag, userID, err)
+	}
+	return id, nil
+}
+
+// rowQuerier is the database or a transaction, so tags can be found or created by the transaction which uses them
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// historyTagID finds the tag of the user by name or creates it archived, so money events, targets and rules
+// can point at tags user never defined, like default or imported ones, without them replacing defaults in keyboards
+func historyTagID(querier rowQuerier, tag string, userID int64) (int, error) {
+	var id int
+	err := querier.QueryRow("INSERT INTO tags (name, archived, user_id, sort_order) VALUES ($1, TRUE, $2, "+nextTagPosition+") ON CONFLICT (user_id, LOWER(name)) DO UPDATE SET name = tags.name RETURNING id", tag, userID).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error getting id of tag '%s' for user %d: %v", tag, userID, err)
+	}
+	return id, nil
+}
+
+// nullableTagID is the same as historyTagID but gives NULL for an empty tag
+func nullableTagID(querier rowQuerier, tag string, userID int64) (sql.NullInt64, error) {
+	if tag == "" {
+		return sql.NullInt64{}, nil
+	}
+	id, err := historyTagID(querier, tag, userID)
+	if err != nil {
+		return sql.NullInt64{}, err
+	}
+	return sql.NullInt64{Int64: int64(id), Valid: true}, nil
+}
+
 func (db PostgresAdapter) CreateTarget(tag string, amount float32, periodStart, periodEnd time.Time, userID int64) error {
-	_, errGettingExistingUser := db.dbInside.Exec("DELETE FROM targets WHERE tag = $1 AND period_start = $2 AND user_id = $3", tag, periodStart, userID)
+	tagID, err := historyTagID(db.dbInside, tag, userID)
+	if err != nil {
+		return err
+	}
+	_, errGettingExistingUser := db.dbInside.Exec("DELETE FROM targets WHERE tag_id = $1 AND period_start = $2 AND user_id = $3", tagID, periodStart, userID)
 	if errGettingExistingUser != nil {
 		return fmt.Errorf("error deleting possibly existing previous target: %v", errGettingExistingUser)
 	}
-	_, err := db.dbInside.Exec("INSERT INTO targets (tag, amount, period_start, period_end, user_id) VALUES ($1, $2, $3, $4, $5) RETURNING id", tag, amount, periodStart, periodEnd, userID)
+	_, err = db.dbInside.Exec("INSERT INTO targets (tag_id, amount, period_start, period_end, user_id) VALUES ($1, $2, $3, $4, $5) RETURNING id", tagID, amount, periodStart, periodEnd, userID)
 	if err != nil {
 		return fmt.Errorf("error creating target for tag '%s' and user %d: %v", tag, userID, err)
 	}
 	return nil
 }
 
+// GetTargets gives targets overlapping the period [periodStart, periodEnd). A target which is only partly inside
+// the period, like a month budget seen in a week, has its amount prorated by the time inside the period
 func (db PostgresAdapter) GetTargets(periodStart time.Time, periodEnd time.Time, userID int64) ([]storage_interface.Target, error) {
 	var targets []storage_interface.Target
-	rows, err := db.dbInside.Query("SELECT id, tag, amount, period_start, period_end, user_id FROM targets WHERE user_id = $1 AND period_start = $2 AND period_end = $3 ", userID, periodStart, periodEnd)
+	rows, err := db.dbInside.Query("SELECT targets.id, tags.name, targets.amount, targets.period_start, targets.period_end, targets.user_id FROM targets JOIN tags ON tags.id = targets.tag_id WHERE targets.user_id = $1 AND targets.period_start < $3 AND targets.period_end > $2 ", userID, periodStart, periodEnd)
 	if err != nil {
 		return nil, fmt.Errorf("error selecting targets in GetTargets: %v", err)
 	}
@@ -101,17 +173,128 @@ func (db PostgresAdapter) GetTargets(periodStart time.Time, periodEnd time.Time,
 		if err := rows.Scan(&target.ID, &target.Tag, &target.Amount, &target.PeriodStart, &target.PeriodEnd, &target.UserID); err != nil {
 			return nil, fmt.Errorf("error unwrapping targets in GetTargets: %v", err)
 		}
+		target.Amount = prorate(target, periodStart, periodEnd)
 		targets = append(targets, target)
 	}
 
 	return targets, nil
 }
 
-// CreateMoneyEvent creates a new money event in the database
-func (db PostgresAdapter) CreateMoneyEvent(amount float32, currency, comment, tag string, userID int64) error {
-	_, err := db.dbInside.Exec("INSERT INTO money_events (amount, currency, comment, tag, created, user_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id", amount, currency, comment, tag, time.Now(), userID)
+// prorate gives the part of the target amount which falls inside the period
+func prorate(target storage_interface.Target, periodStart, periodEnd time.Time) float32 {
+	length := target.PeriodEnd.Sub(target.PeriodStart)
+	start, end := target.PeriodStart, target.PeriodEnd
+	if periodStart.After(start) {
+		start = periodStart
+	}
+	if periodEnd.Before(end) {
+		end = periodEnd
+	}
+	if length <= 0 || !start.Before(end) || end.Sub(start) >= length {
+		return target.Amount
+	}
+	return float32(float64(target.Amount) * float64(end.Sub(start)) / float64(length))
+}
+
+// CreateMoneyEvents saves all the events with their dates at once, like when they are imported from a file.
+// IDs of the created events are set in the slice
+func (db PostgresAdapter) CreateMoneyEvents(events []storage_interface.MoneyEvent, userID int64) error {
+	tx, err := db.dbInside.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction in CreateMoneyEvents: %v", err)
+	}
+	if err = db.insertMoneyEvents(tx, events, userID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing money events for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// CreatePurchase saves the purchase and its installments together. IDs of the installments are set in the slice
+func (db PostgresAdapter) CreatePurchase(purchase storage_interface.Purchase, events []storage_interface.MoneyEvent, userID int64) (int, error) {
+	tx, err := db.dbInside.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction in CreatePurchase: %v", err)
+	}
+	var id int
+	err = tx.QueryRow("INSERT INTO purchases (user_id, amount, currency, comment, installments, created) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id", userID, purchase.Amount, purchase.Currency, purchase.Comment, purchase.Installments, purchase.Created).Scan(&id)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, fmt.Errorf("error creating purchase for user %d: %v", userID, err)
+	}
+	for i := range events {
+		events[i].PurchaseID = id
+	}
+	if err = db.insertMoneyEvents(tx, events, userID); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing purchase for user %d: %v", userID, err)
+	}
+	return id, nil
+}
+
+func (db PostgresAdapter) GetPurchase(purchaseID int, userID int64) (storage_interface.Purchase, error) {
+	var purchase storage_interface.Purchase
+	err := db.dbInside.QueryRow("SELECT id, amount, currency, COALESCE(comment, ''), installments, created, user_id FROM purchases WHERE id = $1 AND user_id = $2", purchaseID, userID).
+		Scan(&purchase.ID, &purchase.Amount, &purchase.Currency, &purchase.Comment, &purchase.Installments, &purchase.Created, &purchase.UserID)
+	if err != nil {
+		return purchase, fmt.Errorf("error selecting purchase %d: %v", purchaseID, err)
+	}
+	return purchase, nil
+}
+
+func (db PostgresAdapter) GetPurchaseInstallments(purchaseID int, userID int64) ([]storage_interface.MoneyEvent, error) {
+	rows, err := db.dbInside.Query("SELECT money_events.id, money_events.amount, money_events.currency, money_events.comment, COALESCE(tags.name, ''), money_events.created, money_events.user_id, COALESCE(money_events.external_id, ''), COALESCE(money_events.merchant_id, ''), COALESCE(money_events.purchase_id, 0), COALESCE(money_events.account_id, 0) FROM money_events LEFT JOIN tags ON tags.id = money_events.tag_id WHERE money_events.purchase_id = $1 AND money_events.user_id = $2 ORDER BY money_events.created", purchaseID, userID)
 	if err != nil {
-		return fmt.Errorf("error creating movey event: %v", err)
+		return nil, fmt.Errorf("error selecting installments of purchase %d: %v", purchaseID, err)
+	}
+	defer rows.Close()
+	var events []storage_interface.MoneyEvent
+	for rows.Next() {
+		var event storage_interface.MoneyEvent
+		if err := rows.Scan(&event.ID, &event.Amount, &event.Currency, &event.Comment, &event.Tag, &event.Created, &event.UserID, &event.ExternalID, &event.MerchantID, &event.PurchaseID, &event.AccountID); err != nil {
+			return nil, fmt.Errorf("error unwrapping money event in GetPurchaseInstallments: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeletePurchase deletes the purchase, its installments go with it by the foreign key
+func (db PostgresAdapter) DeletePurchase(purchaseID int, userID int64) error {
+	_, err := db.dbInside.Exec("DELETE FROM purchases WHERE id = $1 AND user_id = $2", purchaseID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting purchase %d: %v", purchaseID, err)
+	}
+	return nil
+}
+
+func (db PostgresAdapter) insertMoneyEvents(tx *sql.Tx, events []storage_interface.MoneyEvent, userID int64) error {
+	tagIDs := make(map[string]sql.NullInt64)
+	for _, event := range events {
+		if _, known := tagIDs[event.Tag]; known {
+			continue
+		}
+		tagID, err := nullableTagID(tx, event.Tag, userID)
+		if err != nil {
+			return err
+		}
+		tagIDs[event.Tag] = tagID
+	}
+	for i, event := range events {
+		externalID := sql.NullString{String: event.ExternalID, Valid: event.ExternalID != ""}
+		merchantID := sql.NullString{String: event.MerchantID, Valid: event.MerchantID != ""}
+		purchaseID := sql.NullInt64{Int64: int64(event.PurchaseID), Valid: event.PurchaseID != 0}
+		accountID := sql.NullInt64{Int64: int64(event.AccountID), Valid: event.AccountID != 0}
+		err := tx.QueryRow("INSERT INTO money_events (amount, currency, comment, tag_id, created, user_id, external_id, merchant_id, purchase_id, account_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id", event.Amount, event.Currency, event.Comment, tagIDs[event.Tag], event.Created, userID, externalID, merchantID, purchaseID, accountID).Scan(&events[i].ID)
+		if err != nil {
+			return fmt.Errorf("error creating money events for user %d: %v", userID, err)
+		}
 	}
 	return nil
 }
@@ -119,14 +302,14 @@ func (db PostgresAdapter) CreateMoneyEvent(amount float32, currency, comment, ta
 func (db PostgresAdapter) GetMoneyEventsByDateInterval(startDate, endDate time.Time, userID int64) ([]storage_interface.MoneyEvent, error) {
 	var events []storage_interface.MoneyEvent
 
-	rows, err := db.dbInside.Query("SELECT id, amount, currency, comment, tag, created, user_id FROM money_events WHERE created >= $1 AND created <= $2 AND user_id = $3 ORDER BY created ", startDate, endDate, userID)
+	rows, err := db.dbInside.Query("SELECT money_events.id, money_events.amount, money_events.currency, money_events.comment, COALESCE(tags.name, ''), money_events.created, money_events.user_id, COALESCE(money_events.external_id, ''), COALESCE(money_events.merchant_id, ''), COALESCE(money_events.purchase_id, 0), COALESCE(money_events.account_id, 0) FROM money_events LEFT JOIN tags ON tags.id = money_events.tag_id WHERE money_events.created >= $1 AND money_events.created <= $2 AND money_events.user_id = $3 ORDER BY money_events.created ", startDate, endDate, userID)
 	if err != nil {
 		return nil, fmt.Errorf("error selecting money events: %v", err)
 	}
 
 	for rows.Next() {
 		var event storage_interface.MoneyEvent
-		if err := rows.Scan(&event.ID, &event.Amount, &event.Currency, &event.Comment, &event.Tag, &event.Created, &event.UserID); err != nil {
+		if err := rows.Scan(&event.ID, &event.Amount, &event.Currency, &event.Comment, &event.Tag, &event.Created, &event.UserID, &event.ExternalID, &event.MerchantID, &event.PurchaseID, &event.AccountID); err != nil {
 			return nil, fmt.Errorf("error unwrapping money event in GetMoneyEventsByDateInterval: %v", err)
 		}
 		events = append(events, event)
@@ -134,26 +317,222 @@ func (db PostgresAdapter) GetMoneyEventsByDateInterval(startDate, endDate time.T
 	return events, nil
 }
 
+func (db PostgresAdapter) UpdateMoneyEventTag(eventID int, tag string, userID int64) error {
+	tagID, err := nullableTagID(db.dbInside, tag, userID)
+	if err != nil {
+		return err
+	}
+	_, err = db.dbInside.Exec("UPDATE money_events SET tag_id = $1 WHERE id = $2 AND user_id = $3", tagID, eventID, userID)
+	if err != nil {
+		return fmt.Errorf("error updating tag of money event %d: %v", eventID, err)
+	}
+	return nil
+}
+
+func (db PostgresAdapter) GetMoneyEvent(eventID int, userID int64) (storage_interface.MoneyEvent, error) {
+	var event storage_interface.MoneyEvent
+	err := db.dbInside.QueryRow("SELECT money_events.id, money_events.amount, money_events.currency, money_events.comment, COALESCE(tags.name, ''), money_events.created, money_events.user_id, COALESCE(money_events.external_id, ''), COALESCE(money_events.merchant_id, ''), COALESCE(money_events.purchase_id, 0), COALESCE(money_events.account_id, 0) FROM money_events LEFT JOIN tags ON tags.id = money_events.tag_id WHERE money_events.id = $1 AND money_events.user_id = $2", eventID, userID).
+		Scan(&event.ID, &event.Amount, &event.Currency, &event.Comment, &event.Tag, &event.Created, &event.UserID, &event.ExternalID, &event.MerchantID, &event.PurchaseID, &event.AccountID)
+	if err != nil {
+		return event, fmt.Errorf("error selecting money event %d: %v", eventID, err)
+	}
+	return event, nil
+}
+
+// UpdateMoneyEvent changes amount and comment of the money event keeping its tag and date
+func (db PostgresAdapter) UpdateMoneyEvent(eventID int, amount float32, comment string, userID int64) error {
+	_, err := db.dbInside.Exec("UPDATE money_events SET amount = $1, comment = $2 WHERE id = $3 AND user_id = $4", amount, comment, eventID, userID)
+	if err != nil {
+		return fmt.Errorf("error updating money event %d: %v", eventID, err)
+	}
+	return nil
+}
+
+func (db PostgresAdapter) DeleteMoneyEvent(eventID int, userID int64) error {
+	_, err := db.dbInside.Exec("DELETE FROM money_events WHERE id = $1 AND user_id = $2", eventID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting money event %d: %v", eventID, err)
+	}
+	return nil
+}
+
+// AddTagForUser creates a new tag or brings back the archived one
 func (db PostgresAdapter) AddTagForUser(tag string, userID int64) error {
-	_, err := db.dbInside.Query("INSERT INTO accepted_tags (tag, user_id) VALUES ($1, $2) RETURNING id", tag, userID)
+	_, err := db.dbInside.Exec("INSERT INTO tags (name, user_id, sort_order) VALUES ($1, $2, "+nextTagPosition+") ON CONFLICT (user_id, LOWER(name)) DO UPDATE SET archived = FALSE", tag, userID)
 	if err != nil {
 		return fmt.Errorf("error adding tag '%s' for user %d: %v", tag, userID, err)
 	}
 	return nil
 }
 
-func (db PostgresAdapter) RemoveTagForUser(tag string, userID int64) error {
-	_, err := db.dbInside.Exec("DELETE FROM accepted_tags WHERE tag = $1 AND user_id = $2", tag, userID)
+// ArchiveTagForUser hides the tag from keyboards. Money events and targets keep pointing at it
+func (db PostgresAdapter) ArchiveTagForUser(tag string, userID int64) error {
+	_, err := db.dbInside.Exec("UPDATE tags SET archived = TRUE WHERE LOWER(name) = LOWER($1) AND user_id = $2", tag, userID)
+	if err != nil {
+		return fmt.Errorf("error archiving tag '%s' for user %d: %v", tag, userID, err)
+	}
+	return nil
+}
+
+// RenameTag changes the name of the tag, so all history of the tag gets the new name too
+func (db PostgresAdapter) RenameTag(oldName, newName string, userID int64) error {
+	_, err := db.dbInside.Exec("UPDATE tags SET name = $1 WHERE LOWER(name) = LOWER($2) AND user_id = $3", newName, oldName, userID)
+	if err != nil {
+		return fmt.Errorf("error renaming tag '%s' to '%s' for user %d: %v", oldName, newName, userID, err)
+	}
+	return nil
+}
+
+// SetTagParent puts the tag under the parent tag. Empty parent makes the tag a top level one
+func (db PostgresAdapter) SetTagParent(tag, parent string, userID int64) error {
+	_, err := db.dbInside.Exec("UPDATE tags SET parent_id = (SELECT id FROM tags WHERE LOWER(name) = LOWER($2) AND user_id = $3) WHERE LOWER(name) = LOWER($1) AND user_id = $3", tag, parent, userID)
+	if err != nil {
+		return fmt.Errorf("error setting parent '%s' for tag '%s' of user %d: %v", parent, tag, userID, err)
+	}
+	return nil
+}
+
+// UpdateTagAppearance saves how the tag is shown: its emoji, color for charts and position in lists
+func (db PostgresAdapter) UpdateTagAppearance(tag, emoji, color string, sortOrder int, userID int64) error {
+	_, err := db.dbInside.Exec("UPDATE tags SET emoji = $1, color = $2, sort_order = $3 WHERE LOWER(name) = LOWER($4) AND user_id = $5", emoji, color, sortOrder, tag, userID)
+	if err != nil {
+		return fmt.Errorf("error updating appearance of tag '%s' for user %d: %v", tag, userID, err)
+	}
+	return nil
+}
+
+// MergeTags moves money events, targets and rules of fromTag to intoTag and deletes fromTag.
+// Targets for the same period are summed up, children of fromTag become children of intoTag
+func (db PostgresAdapter) MergeTags(fromTag, intoTag string, userID int64) error {
+	fromID, err := db.tagID(fromTag, userID)
+	if err != nil {
+		return err
+	}
+	intoID, err := db.tagID(intoTag, userID)
+	if err != nil {
+		return err
+	}
+	if fromID == intoID {
+		return fmt.Errorf("error merging tag '%s' of user %d into itself", fromTag, userID)
+	}
+	tx, err := db.dbInside.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction in MergeTags: %v", err)
+	}
+	if err := mergeTag(tx, fromID, intoID); err != nil {
+		_ = tx.Rollback()
+		return fmt.Errorf("error merging tag '%s' into '%s' for user %d: %v", fromTag, intoTag, userID, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing merge of tag '%s' into '%s': %v", fromTag, intoTag, err)
+	}
+	return nil
+}
+
+// mergeTag moves everything of the tag fromID to the tag intoID and deletes fromID
+func mergeTag(tx *sql.Tx, fromID, intoID int) error {
+	statements := []string{
+		"UPDATE tags SET parent_id = (SELECT parent_id FROM tags WHERE id = $1) WHERE id = $2 AND parent_id = $1",
+		"UPDATE tags SET parent_id = $2 WHERE parent_id = $1",
+		"UPDATE money_events SET tag_id = $2 WHERE tag_id = $1",
+		"UPDATE targets SET amount = targets.amount + merged.amount FROM targets merged WHERE targets.tag_id = $2 AND merged.tag_id = $1 AND merged.period_start = targets.period_start AND merged.period_end = targets.period_end",
+		"DELETE FROM targets merged WHERE merged.tag_id = $1 AND EXISTS (SELECT 1 FROM targets WHERE targets.tag_id = $2 AND targets.period_start = merged.period_start AND targets.period_end = merged.period_end)",
+		"UPDATE targets SET tag_id = $2 WHERE tag_id = $1",
+		"UPDATE categorization_rules SET tag_id = $2 WHERE tag_id = $1",
+		"DELETE FROM tags WHERE id = $1",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, fromID, intoID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NormalizeTagNames gives every tag the name tagpolicy.Normalize makes, so tags saved before names were checked
+// can be found by names users type. Emoji of an old name become the emoji of the tag when it has none.
+// Tags which get the same name are merged into the oldest of them, which stays active when any of them was active.
+// It changes nothing when all names are canonical already, so it is safe to run on every start
+func (db PostgresAdapter) NormalizeTagNames() error {
+	rows, err := db.dbInside.Query("SELECT id, user_id, name, emoji, archived FROM tags ORDER BY user_id, id")
 	if err != nil {
-		return fmt.Errorf("error deleting tag '%s' for user %d: %v", tag, userID, err)
+		return fmt.Errorf("error selecting tags in NormalizeTagNames: %v", err)
 	}
+	var tags []storage_interface.Tag
+	for rows.Next() {
+		var tag storage_interface.Tag
+		if err := rows.Scan(&tag.ID, &tag.UserID, &tag.Name, &tag.Emoji, &tag.Archived); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("error unwrapping tag in NormalizeTagNames: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error reading tags in NormalizeTagNames: %v", err)
+	}
+
+	type key struct {
+		userID int
+		name   string
+	}
+	kept := make(map[key]storage_interface.Tag)
+	var merges [][2]int
+	var renames []storage_interface.Tag
+	for _, tag := range tags {
+		name, emoji := tagpolicy.Canonical(tag.Name, "tag-"+strconv.Itoa(tag.ID))
+		canonical := key{tag.UserID, strings.ToLower(name)}
+		if into, found := kept[canonical]; found {
+			merges = append(merges, [2]int{tag.ID, into.ID})
+			if !tag.Archived && into.Archived {
+				into.Archived = false
+				kept[canonical] = into
+				renames = append(renames, into)
+			}
+			continue
+		}
+		changed := name != tag.Name
+		if tag.Emoji == "" && emoji != "" && len(emoji) <= maxEmojiLength {
+			tag.Emoji, changed = emoji, true
+		}
+		tag.Name = name
+		kept[canonical] = tag
+		if changed {
+			renames = append(renames, tag)
+		}
+	}
+	if len(merges) == 0 && len(renames) == 0 {
+		return nil
+	}
+
+	tx, err := db.dbInside.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction in NormalizeTagNames: %v", err)
+	}
+	for _, merge := range merges {
+		if err := mergeTag(tx, merge[0], merge[1]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error merging tag %d into %d in NormalizeTagNames: %v", merge[0], merge[1], err)
+		}
+	}
+	for _, tag := range renames {
+		if _, err := tx.Exec("UPDATE tags SET name = $1, emoji = $2, archived = archived AND $3 WHERE id = $4", tag.Name, tag.Emoji, tag.Archived, tag.ID); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("error renaming tag %d to '%s' in NormalizeTagNames: %v", tag.ID, tag.Name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing normalized tag names: %v", err)
+	}
+	log.Printf("normalized tag names: %d tags renamed, %d merged", len(renames), len(merges))
 	return nil
 }
 
+// GetUserTags returns names of active tags, the ones to show in keyboards
 func (db PostgresAdapter) GetUserTags(userID int64) ([]string, error) {
 	var tags []string
 
-	rows, err := db.dbInside.Query("SELECT tag FROM accepted_tags WHERE user_id = $1", userID)
+	rows, err := db.dbInside.Query("SELECT name FROM tags WHERE user_id = $1 AND NOT archived ORDER BY sort_order, id", userID)
 	if err != nil {
 		return nil, fmt.Errorf("error querring user tags: %v", err)
 	}
@@ -174,6 +553,76 @@ func (db PostgresAdapter) GetUserTags(userID int64) ([]string, error) {
 	return tags, nil
 }
 
+// GetTags returns all tags of the user including archived ones
+func (db PostgresAdapter) GetTags(userID int64) ([]storage_interface.Tag, error) {
+	var tags []storage_interface.Tag
+
+	rows, err := db.dbInside.Query("SELECT id, name, archived, COALESCE(parent_id, 0), emoji, color, sort_order, user_id FROM tags WHERE user_id = $1 ORDER BY sort_order, id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querring tags: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag storage_interface.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Archived, &tag.ParentID, &tag.Emoji, &tag.Color, &tag.SortOrder, &tag.UserID); err != nil {
+			return nil, fmt.Errorf("error unwrapping tags in GetTags: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+func (db PostgresAdapter) CreateCategorizationRule(expression, tag string, userID int64) error {
+	tagID, err := historyTagID(db.dbInside, tag, userID)
+	if err != nil {
+		return err
+	}
+	_, err = db.dbInside.Exec("INSERT INTO categorization_rules (expression, tag_id, user_id) VALUES ($1, $2, $3)", expression, tagID, userID)
+	if err != nil {
+		return fmt.Errorf("error creating categorization rule for user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// GetCategorizationRules returns rules in the order they were created, which is the order they are checked in
+func (db PostgresAdapter) GetCategorizationRules(userID int64) ([]storage_interface.CategorizationRule, error) {
+	var rules []storage_interface.CategorizationRule
+
+	rows, err := db.dbInside.Query("SELECT categorization_rules.id, categorization_rules.expression, tags.name, categorization_rules.user_id FROM categorization_rules JOIN tags ON tags.id = categorization_rules.tag_id WHERE categorization_rules.user_id = $1 ORDER BY categorization_rules.id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querring categorization rules: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule storage_interface.CategorizationRule
+		if err := rows.Scan(&rule.ID, &rule.Expression, &rule.Tag, &rule.UserID); err != nil {
+			return nil, fmt.Errorf("error unwrapping categorization rules in GetCategorizationRules: %v", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (db PostgresAdapter) DeleteCategorizationRule(ruleID int, userID int64) error {
+	_, err := db.dbInside.Exec("DELETE FROM categorization_rules WHERE id = $1 AND user_id = $2", ruleID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting categorization rule %d for user %d: %v", ruleID, userID, err)
+	}
+	return nil
+}
+
 func (db PostgresAdapter) SaveFeedback(userID int64, message string) error {
 	_, err := db.dbInside.Query("INSERT INTO feedback (message, user_id) VALUES ($1, $2) RETURNING id", message, userID)
 	if err != nil {
@@ -183,7 +632,8 @@ func (db PostgresAdapter) SaveFeedback(userID int64, message string) error {
 }
 
 func (db PostgresAdapter) SaveMessage(message storage_interface.Message) error {
-	_, err := db.dbInside.Query("INSERT INTO messages (id, userid) VALUES ($1, $2) RETURNING id", message.ID, message.UserID)
+	reference := sql.NullString{String: message.Reference, Valid: message.Reference != ""}
+	_, err := db.dbInside.Exec("INSERT INTO messages (id, userid, reference) VALUES ($1, $2, $3)", message.ID, message.UserID, reference)
 	if err != nil {
 		return fmt.Errorf("error saving message: %v", err)
 	}
@@ -214,6 +664,19 @@ func (db PostgresAdapter) GetMessages(userId int64) ([]storage_interface.Message
 	return result, nil
 }
 
+// GetMessageReference gives what the message sent to the user is about, it is empty for unknown messages
+func (db PostgresAdapter) GetMessageReference(messageID string, userID int64) (string, error) {
+	var reference string
+	err := db.dbInside.QueryRow("SELECT COALESCE(reference, '') FROM messages WHERE id = $1 AND userid = $2", messageID, strconv.FormatInt(userID, 10)).Scan(&reference)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error selecting reference of message %s: %v", messageID, err)
+	}
+	return reference, nil
+}
+
 func (db PostgresAdapter) ClearOutgoingMessagesForUser(userID int64) error {
 	_, err := db.dbInside.Exec("DELETE FROM messages WHERE userid = $1", userID)
 	if err != nil {
@@ -229,3 +692,239 @@ func (db PostgresAdapter) SaveUsageLog(userId int64, replyType string) error {
 	}
 	return nil
 }
+
+// SaveCallbackValue keeps a value too long for a button and gives back a short key for it.
+// The same value always gets the same key
+func (db PostgresAdapter) SaveCallbackValue(value string) (string, error) {
+	var id int64
+	err := db.dbInside.QueryRow("INSERT INTO callback_values (value) VALUES ($1) ON CONFLICT (MD5(value)) DO UPDATE SET value = EXCLUDED.value RETURNING id", value).Scan(&id)
+	if err != nil {
+		return "", fmt.Errorf("error saving callback value: %v", err)
+	}
+	return strconv.FormatInt(id, 36), nil
+}
+
+func (db PostgresAdapter) GetCallbackValue(key string) (string, error) {
+	id, err := strconv.ParseInt(key, 36, 64)
+	if err != nil {
+		return "", fmt.Errorf("error parsing callback value key '%s': %v", key, err)
+	}
+	var value string
+	err = db.dbInside.QueryRow("SELECT value FROM callback_values WHERE id = $1", id).Scan(&value)
+	if err != nil {
+		return "", fmt.Errorf("error selecting callback value %d: %v", id, err)
+	}
+	return value, nil
+}
+
+// StatementDelivered tells if the statement of the period starting at periodStart was already sent to the user
+func (db PostgresAdapter) StatementDelivered(userID int64, periodStart time.Time) (bool, error) {
+	var delivered bool
+	err := db.dbInside.QueryRow("SELECT EXISTS (SELECT 1 FROM statement_deliveries WHERE user_id = $1 AND period_start = $2)", userID, periodStart).Scan(&delivered)
+	if err != nil {
+		return false, fmt.Errorf("error checking statement delivery: %v", err)
+	}
+	return delivered, nil
+}
+
+func (db PostgresAdapter) SaveStatementDelivery(userID int64, periodStart time.Time) error {
+	_, err := db.dbInside.Exec("INSERT INTO statement_deliveries (user_id, period_start) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, periodStart)
+	if err != nil {
+		return fmt.Errorf("error saving statement delivery: %v", err)
+	}
+	return nil
+}
+
+// GetLedgerMapping gives the text of user's tag to account mapping, it is empty when user didn't set it
+func (db PostgresAdapter) GetLedgerMapping(userID int64) (string, error) {
+	var mapping string
+	err := db.dbInside.QueryRow("SELECT mapping FROM ledger_mappings WHERE user_id = $1", userID).Scan(&mapping)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error selecting ledger mapping: %v", err)
+	}
+	return mapping, nil
+}
+
+func (db PostgresAdapter) SaveLedgerMapping(userID int64, mapping string) error {
+	_, err := db.dbInside.Exec("INSERT INTO ledger_mappings (user_id, mapping) VALUES ($1, $2) ON CONFLICT (user_id) DO UPDATE SET mapping = EXCLUDED.mapping, updated = CURRENT_TIMESTAMP", userID, mapping)
+	if err != nil {
+		return fmt.Errorf("error saving ledger mapping: %v", err)
+	}
+	return nil
+}
+
+// SavePendingImport keeps the file until the user confirms the import, a new file replaces the previous one
+func (db PostgresAdapter) SavePendingImport(pending storage_interface.PendingImport) error {
+	_, err := db.dbInside.Exec("INSERT INTO pending_imports (user_id, file_name, content, columns, created) VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP) ON CONFLICT (user_id) DO UPDATE SET file_name = EXCLUDED.file_name, content = EXCLUDED.content, columns = EXCLUDED.columns, created = EXCLUDED.created", pending.UserID, pending.FileName, pending.Content, pending.Columns)
+	if err != nil {
+		return fmt.Errorf("error saving pending import: %v", err)
+	}
+	return nil
+}
+
+// GetPendingImport gives the file waiting for import, its content is empty when there is no such file
+func (db PostgresAdapter) GetPendingImport(userID int64) (storage_interface.PendingImport, error) {
+	pending := storage_interface.PendingImport{UserID: userID}
+	err := db.dbInside.QueryRow("SELECT file_name, content, columns, created FROM pending_imports WHERE user_id = $1", userID).Scan(&pending.FileName, &pending.Content, &pending.Columns, &pending.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pending, nil
+	}
+	if err != nil {
+		return pending, fmt.Errorf("error selecting pending import: %v", err)
+	}
+	return pending, nil
+}
+
+func (db PostgresAdapter) DeletePendingImport(userID int64) error {
+	_, err := db.dbInside.Exec("DELETE FROM pending_imports WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("error deleting pending import: %v", err)
+	}
+	return nil
+}
+
+// GetImportProfile gives columns the user chose for files with the signature, it is empty for new kinds of files
+func (db PostgresAdapter) GetImportProfile(userID int64, signature string) (string, error) {
+	var columns string
+	err := db.dbInside.QueryRow("SELECT columns FROM import_profiles WHERE user_id = $1 AND signature = $2", userID, signature).Scan(&columns)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error selecting import profile: %v", err)
+	}
+	return columns, nil
+}
+
+func (db PostgresAdapter) SaveImportProfile(userID int64, signature, columns string) error {
+	_, err := db.dbInside.Exec("INSERT INTO import_profiles (user_id, signature, columns) VALUES ($1, $2, $3) ON CONFLICT (user_id, signature) DO UPDATE SET columns = EXCLUDED.columns, updated = CURRENT_TIMESTAMP", userID, signature, columns)
+	if err != nil {
+		return fmt.Errorf("error saving import profile: %v", err)
+	}
+	return nil
+}
+
+func (db PostgresAdapter) CreateAccount(account storage_interface.Account) (int, error) {
+	closingDay := sql.NullInt64{Int64: int64(account.ClosingDay), Valid: account.ClosingDay != 0}
+	dueDay := sql.NullInt64{Int64: int64(account.DueDay), Valid: account.DueDay != 0}
+	var id int
+	err := db.dbInside.QueryRow("INSERT INTO accounts (user_id, name, kind, currency, closing_day, due_day, opening) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", account.UserID, account.Name, account.Kind, account.Currency, closingDay, dueDay, account.Opening).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error creating account '%s' for user %d: %v", account.Name, account.UserID, err)
+	}
+	return id, nil
+}
+
+// GetAccounts gives accounts of the user in the order they were created
+func (db PostgresAdapter) GetAccounts(userID int64) ([]storage_interface.Account, error) {
+	rows, err := db.dbInside.Query("SELECT id, name, kind, currency, COALESCE(closing_day, 0), COALESCE(due_day, 0), opening, created, user_id FROM accounts WHERE user_id = $1 ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting accounts: %v", err)
+	}
+	defer rows.Close()
+	var accounts []storage_interface.Account
+	for rows.Next() {
+		var account storage_interface.Account
+		if err := rows.Scan(&account.ID, &account.Name, &account.Kind, &account.Currency, &account.ClosingDay, &account.DueDay, &account.Opening, &account.Created, &account.UserID); err != nil {
+			return nil, fmt.Errorf("error unwrapping account in GetAccounts: %v", err)
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (db PostgresAdapter) CreateTransfer(transfer storage_interface.Transfer) (int, error) {
+	fromAccountID := sql.NullInt64{Int64: int64(transfer.FromAccountID), Valid: transfer.FromAccountID != 0}
+	toAccountID := sql.NullInt64{Int64: int64(transfer.ToAccountID), Valid: transfer.ToAccountID != 0}
+	var id int
+	err := db.dbInside.QueryRow("INSERT INTO transfers (user_id, from_account_id, to_account_id, amount, received, comment, created) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id", transfer.UserID, fromAccountID, toAccountID, transfer.Amount, transfer.Received, transfer.Comment, transfer.Created).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("error creating transfer for user %d: %v", transfer.UserID, err)
+	}
+	return id, nil
+}
+
+func (db PostgresAdapter) GetTransfersByDateInterval(startDate, endDate time.Time, userID int64) ([]storage_interface.Transfer, error) {
+	rows, err := db.dbInside.Query("SELECT id, COALESCE(from_account_id, 0), COALESCE(to_account_id, 0), amount, received, COALESCE(comment, ''), created, user_id FROM transfers WHERE created >= $1 AND created <= $2 AND user_id = $3 ORDER BY created", startDate, endDate, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting transfers: %v", err)
+	}
+	defer rows.Close()
+	var transfers []storage_interface.Transfer
+	for rows.Next() {
+		var transfer storage_interface.Transfer
+		if err := rows.Scan(&transfer.ID, &transfer.FromAccountID, &transfer.ToAccountID, &transfer.Amount, &transfer.Received, &transfer.Comment, &transfer.Created, &transfer.UserID); err != nil {
+			return nil, fmt.Errorf("error unwrapping transfer in GetTransfersByDateInterval: %v", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, rows.Err()
+}
+
+func (db PostgresAdapter) SaveAttachment(attachment storage_interface.Attachment) (int, error) {
+	var id int
+	err := db.dbInside.QueryRow("INSERT INTO attachments (money_event_id, user_id, file_name, blob_key) SELECT id, user_id, $3, $4 FROM money_events WHERE id = $1 AND user_id = $2 RETURNING id", attachment.EventID, attachment.UserID, attachment.FileName, attachment.BlobKey).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("error attaching file to money event %d: no such event", attachment.EventID)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error saving attachment of money event %d: %v", attachment.EventID, err)
+	}
+	return id, nil
+}
+
+func (db PostgresAdapter) GetAttachment(attachmentID int, userID int64) (storage_interface.Attachment, error) {
+	var attachment storage_interface.Attachment
+	err := db.dbInside.QueryRow("SELECT id, money_event_id, file_name, blob_key, created, user_id FROM attachments WHERE id = $1 AND user_id = $2", attachmentID, userID).
+		Scan(&attachment.ID, &attachment.EventID, &attachment.FileName, &attachment.BlobKey, &attachment.Created, &attachment.UserID)
+	if err != nil {
+		return attachment, fmt.Errorf("error selecting attachment %d: %v", attachmentID, err)
+	}
+	return attachment, nil
+}
+
+// GetAttachments gives files of the money event in the order they were attached
+func (db PostgresAdapter) GetAttachments(eventID int, userID int64) ([]storage_interface.Attachment, error) {
+	rows, err := db.dbInside.Query("SELECT id, money_event_id, file_name, blob_key, created, user_id FROM attachments WHERE money_event_id = $1 AND user_id = $2 ORDER BY id", eventID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting attachments of money event %d: %v", eventID, err)
+	}
+	defer rows.Close()
+	var attachments []storage_interface.Attachment
+	for rows.Next() {
+		var attachment storage_interface.Attachment
+		if err := rows.Scan(&attachment.ID, &attachment.EventID, &attachment.FileName, &attachment.BlobKey, &attachment.Created, &attachment.UserID); err != nil {
+			return nil, fmt.Errorf("error unwrapping attachment in GetAttachments: %v", err)
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+// CountAttachments tells how many files every money event has, events without files are not in the map
+func (db PostgresAdapter) CountAttachments(eventIDs []int, userID int64) (map[int]int, error) {
+	counts := make(map[int]int)
+	if len(eventIDs) == 0 {
+		return counts, nil
+	}
+	ids := make([]int64, len(eventIDs))
+	for i, id := range eventIDs {
+		ids[i] = int64(id)
+	}
+	rows, err := db.dbInside.Query("SELECT money_event_id, COUNT(*) FROM attachments WHERE money_event_id = ANY($1) AND user_id = $2 GROUP BY money_event_id", pq.Array(ids), userID)
+	if err != nil {
+		return nil, fmt.Errorf("error counting attachments: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var eventID, count int
+		if err := rows.Scan(&eventID, &count); err != nil {
+			return nil, fmt.Errorf("error unwrapping attachments count in CountAttachments: %v", err)
+		}
+		counts[eventID] = count
+	}
+	return counts, rows.Err()
+}
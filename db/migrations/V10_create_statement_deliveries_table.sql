@@ -0,0 +1,6 @@
+CREATE TABLE statement_deliveries (
+                         user_id INT NOT NULL REFERENCES users (id),
+                         period_start DATE NOT NULL,
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                         PRIMARY KEY (user_id, period_start)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE ledger_mappings (
+                         user_id INT PRIMARY KEY REFERENCES users (id),
+                         mapping TEXT NOT NULL DEFAULT '',
+                         updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,15 @@
+CREATE TABLE pending_imports (
+                         user_id INT PRIMARY KEY REFERENCES users (id),
+                         file_name TEXT NOT NULL,
+                         content BYTEA NOT NULL,
+                         columns TEXT NOT NULL DEFAULT '',
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE import_profiles (
+                         user_id INT NOT NULL REFERENCES users (id),
+                         signature TEXT NOT NULL,
+                         columns TEXT NOT NULL,
+                         updated TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                         PRIMARY KEY (user_id, signature)
+);
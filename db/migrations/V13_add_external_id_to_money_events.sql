@@ -0,0 +1,3 @@
+ALTER TABLE money_events ADD COLUMN external_id TEXT;
+
+CREATE INDEX money_events_external_id ON money_events (user_id, external_id) WHERE external_id IS NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE money_events ADD COLUMN merchant_id TEXT;
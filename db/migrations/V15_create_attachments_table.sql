@@ -0,0 +1,12 @@
+CREATE TABLE attachments (
+                         id SERIAL PRIMARY KEY,
+                         money_event_id INT NOT NULL REFERENCES money_events (id) ON DELETE CASCADE,
+                         user_id INT NOT NULL REFERENCES users (id),
+                         file_name TEXT NOT NULL,
+                         blob_key TEXT NOT NULL,
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX attachments_money_event ON attachments (money_event_id);
+
+ALTER TABLE messages ADD COLUMN reference TEXT;
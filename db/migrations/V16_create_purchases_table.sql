@@ -0,0 +1,13 @@
+CREATE TABLE purchases (
+                         id SERIAL PRIMARY KEY,
+                         user_id INT NOT NULL REFERENCES users (id),
+                         amount FLOAT NOT NULL,
+                         currency VARCHAR(3) NOT NULL,
+                         comment TEXT,
+                         installments INT NOT NULL,
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE money_events ADD COLUMN purchase_id INT REFERENCES purchases (id) ON DELETE CASCADE;
+
+CREATE INDEX money_events_purchase ON money_events (purchase_id) WHERE purchase_id IS NOT NULL;
@@ -0,0 +1,13 @@
+CREATE TABLE accounts (
+                         id SERIAL PRIMARY KEY,
+                         user_id INT NOT NULL REFERENCES users (id),
+                         name VARCHAR(50) NOT NULL,
+                         kind VARCHAR(20) NOT NULL,
+                         currency VARCHAR(3) NOT NULL DEFAULT 'ARS',
+                         closing_day INT,
+                         due_day INT,
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                         UNIQUE (user_id, name)
+);
+
+ALTER TABLE money_events ADD COLUMN account_id INT REFERENCES accounts (id);
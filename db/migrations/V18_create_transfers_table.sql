@@ -0,0 +1,14 @@
+ALTER TABLE accounts ADD COLUMN opening FLOAT NOT NULL DEFAULT 0;
+
+CREATE TABLE transfers (
+                         id SERIAL PRIMARY KEY,
+                         user_id INT NOT NULL REFERENCES users (id),
+                         from_account_id INT REFERENCES accounts (id),
+                         to_account_id INT REFERENCES accounts (id),
+                         amount FLOAT NOT NULL,
+                         received FLOAT NOT NULL,
+                         comment TEXT,
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX transfers_user_created ON transfers (user_id, created);
@@ -0,0 +1,8 @@
+CREATE TABLE categorization_rules (
+                         id SERIAL PRIMARY KEY,
+                         expression TEXT NOT NULL,
+                         tag VARCHAR(50) NOT NULL,
+                         user_id INTEGER NOT NULL,
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                         FOREIGN KEY (user_id) REFERENCES users(id)
+);
\ No newline at end of file
@@ -0,0 +1,35 @@
+CREATE TABLE tags (
+                         id SERIAL PRIMARY KEY,
+                         name VARCHAR(50) NOT NULL,
+                         archived BOOLEAN NOT NULL DEFAULT FALSE,
+                         user_id INTEGER NOT NULL,
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+                         FOREIGN KEY (user_id) REFERENCES users(id),
+                         UNIQUE (user_id, name)
+);
+
+-- accepted tags stay active, tags which are only found in history were removed by users, so they are archived
+INSERT INTO tags (name, user_id) SELECT DISTINCT tag, user_id FROM accepted_tags;
+INSERT INTO tags (name, archived, user_id)
+SELECT DISTINCT used.tag, TRUE, used.user_id FROM (
+    SELECT tag, user_id FROM money_events WHERE tag IS NOT NULL AND tag <> ''
+    UNION SELECT tag, user_id FROM targets
+    UNION SELECT tag, user_id FROM categorization_rules
+) used
+WHERE NOT EXISTS (SELECT 1 FROM tags WHERE tags.user_id = used.user_id AND tags.name = used.tag);
+
+ALTER TABLE money_events ADD COLUMN tag_id INTEGER REFERENCES tags(id);
+UPDATE money_events SET tag_id = tags.id FROM tags WHERE tags.user_id = money_events.user_id AND tags.name = money_events.tag;
+ALTER TABLE money_events DROP COLUMN tag;
+
+ALTER TABLE targets ADD COLUMN tag_id INTEGER REFERENCES tags(id);
+UPDATE targets SET tag_id = tags.id FROM tags WHERE tags.user_id = targets.user_id AND tags.name = targets.tag;
+ALTER TABLE targets ALTER COLUMN tag_id SET NOT NULL;
+ALTER TABLE targets DROP COLUMN tag;
+
+ALTER TABLE categorization_rules ADD COLUMN tag_id INTEGER REFERENCES tags(id);
+UPDATE categorization_rules SET tag_id = tags.id FROM tags WHERE tags.user_id = categorization_rules.user_id AND tags.name = categorization_rules.tag;
+ALTER TABLE categorization_rules ALTER COLUMN tag_id SET NOT NULL;
+ALTER TABLE categorization_rules DROP COLUMN tag;
+
+DROP TABLE accepted_tags;
\ No newline at end of file
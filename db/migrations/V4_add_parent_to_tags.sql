@@ -0,0 +1 @@
+ALTER TABLE tags ADD COLUMN parent_id INTEGER REFERENCES tags(id) ON DELETE SET NULL;
\ No newline at end of file
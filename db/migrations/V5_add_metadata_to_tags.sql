@@ -0,0 +1,7 @@
+ALTER TABLE tags ADD COLUMN emoji VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE tags ADD COLUMN color VARCHAR(7) NOT NULL DEFAULT '';
+ALTER TABLE tags ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
+
+UPDATE tags SET sort_order = ordered.position
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY id) AS position FROM tags) ordered
+WHERE tags.id = ordered.id;
\ No newline at end of file
@@ -0,0 +1,32 @@
+-- tags which differ only in case or spaces become one tag: the oldest of them
+CREATE TEMPORARY TABLE tag_duplicates AS
+SELECT tags.id AS duplicate_id, canonical.id AS canonical_id
+FROM tags
+JOIN (
+    SELECT user_id, LOWER(REGEXP_REPLACE(BTRIM(name), '\s+', '-', 'g')) AS normalized, MIN(id) AS id
+    FROM tags GROUP BY user_id, LOWER(REGEXP_REPLACE(BTRIM(name), '\s+', '-', 'g'))
+) canonical ON canonical.user_id = tags.user_id AND canonical.normalized = LOWER(REGEXP_REPLACE(BTRIM(tags.name), '\s+', '-', 'g'))
+WHERE tags.id <> canonical.id;
+
+UPDATE money_events SET tag_id = tag_duplicates.canonical_id FROM tag_duplicates WHERE money_events.tag_id = tag_duplicates.duplicate_id;
+UPDATE targets SET amount = targets.amount + duplicate.amount
+FROM targets duplicate JOIN tag_duplicates ON tag_duplicates.duplicate_id = duplicate.tag_id
+WHERE targets.tag_id = tag_duplicates.canonical_id AND targets.period_start = duplicate.period_start AND targets.period_end = duplicate.period_end;
+DELETE FROM targets USING tag_duplicates
+WHERE targets.tag_id = tag_duplicates.duplicate_id AND EXISTS (
+    SELECT 1 FROM targets kept WHERE kept.tag_id = tag_duplicates.canonical_id AND kept.period_start = targets.period_start AND kept.period_end = targets.period_end
+);
+UPDATE targets SET tag_id = tag_duplicates.canonical_id FROM tag_duplicates WHERE targets.tag_id = tag_duplicates.duplicate_id;
+UPDATE categorization_rules SET tag_id = tag_duplicates.canonical_id FROM tag_duplicates WHERE categorization_rules.tag_id = tag_duplicates.duplicate_id;
+UPDATE tags SET parent_id = tag_duplicates.canonical_id FROM tag_duplicates WHERE tags.parent_id = tag_duplicates.duplicate_id;
+UPDATE tags SET parent_id = NULL WHERE parent_id = id;
+UPDATE tags SET archived = FALSE
+FROM tag_duplicates JOIN tags duplicate ON duplicate.id = tag_duplicates.duplicate_id
+WHERE tags.id = tag_duplicates.canonical_id AND NOT duplicate.archived;
+DELETE FROM tags USING tag_duplicates WHERE tags.id = tag_duplicates.duplicate_id;
+DROP TABLE tag_duplicates;
+
+-- names get the canonical form of tagpolicy.Normalize, like "food court" becoming "Food-court", from
+-- db.NormalizeTagNames on start of the bot, SQL can't tell emoji and letters apart the same way
+
+CREATE UNIQUE INDEX tags_user_id_lower_name_key ON tags (user_id, LOWER(name));
\ No newline at end of file
@@ -0,0 +1,5 @@
+CREATE TABLE callback_values (
+                         id SERIAL PRIMARY KEY,
+                         value TEXT NOT NULL UNIQUE,
+                         created TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE callback_values DROP CONSTRAINT callback_values_value_key;
+CREATE UNIQUE INDEX callback_values_value_hash ON callback_values (MD5(value));
@@ -0,0 +1,109 @@
+// Package export gives user's money events, targets and tags out of the storage as files
+package export
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+	FormatXLSX = "xlsx"
+)
+
+// Formats are all the formats data can be exported to
+var Formats = []string{FormatCSV, FormatJSON, FormatXLSX}
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Data is everything user has for the period: tags are all of them, events and targets are those of the period
+type Data struct {
+	Period  reports.Period
+	Tags    []storage_interface.Tag
+	Events  []storage_interface.MoneyEvent
+	Targets []storage_interface.Target
+}
+
+// Load reads data of the user for the period. Targets are set for months, so they are read month by month
+func Load(storage storage_interface.ActualStorage, userID int64, period reports.Period) (Data, error) {
+	data := Data{Period: period}
+	var err error
+	data.Tags, err = storage.GetTags(userID)
+	if err != nil {
+		return data, fmt.Errorf("error getting tags for export: %v", err)
+	}
+	data.Events, err = storage.GetMoneyEventsByDateInterval(period.Start, period.End, userID)
+	if err != nil {
+		return data, fmt.Errorf("error getting money events for export: %v", err)
+	}
+	for month := reports.MonthPeriod(period.Start); month.Start.Before(period.End); month = month.Next() {
+		targets, errTargets := storage.GetTargets(month.Start, month.End, userID)
+		if errTargets != nil {
+			return data, fmt.Errorf("error getting targets for export: %v", errTargets)
+		}
+		data.Targets = append(data.Targets, targets...)
+	}
+	return data, nil
+}
+
+// Write gives the data in the format together with the file name for it
+func Write(data Data, format string) (string, []byte, error) {
+	name := "expenses-" + data.Period.String()
+	var content []byte
+	var err error
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		name += ".zip"
+		content, err = writeCSV(data)
+	case FormatJSON:
+		name += ".json"
+		content, err = writeJSON(data)
+	case FormatXLSX:
+		name += ".xlsx"
+		content, err = writeXLSX(data)
+	default:
+		return "", nil, fmt.Errorf("can't export to '%s': %w", format, ErrUnknownFormat)
+	}
+	return name, content, err
+}
+
+// table is a sheet of data with a header, formats of tables share it
+type table struct {
+	name   string
+	header []string
+	rows   [][]string
+}
+
+func (data Data) tables() []table {
+	tagNames := make(map[int]string)
+	for _, tag := range data.Tags {
+		tagNames[tag.ID] = tag.Name
+	}
+	events := table{name: "events", header: []string{"id", "date", "amount", "currency", "tag", "comment"}}
+	for _, event := range data.Events {
+		events.rows = append(events.rows, []string{strconv.Itoa(event.ID), event.Created.Format(time.RFC3339),
+			formatAmount(event.Amount), event.Currency, event.Tag, event.Comment})
+	}
+	targets := table{name: "targets", header: []string{"id", "period_start", "period_end", "amount", "tag"}}
+	for _, target := range data.Targets {
+		targets.rows = append(targets.rows, []string{strconv.Itoa(target.ID), target.PeriodStart.Format(time.DateOnly),
+			target.PeriodEnd.Format(time.DateOnly), formatAmount(target.Amount), target.Tag})
+	}
+	tags := table{name: "tags", header: []string{"id", "name", "parent", "emoji", "color", "sort_order", "archived"}}
+	for _, tag := range data.Tags {
+		tags.rows = append(tags.rows, []string{strconv.Itoa(tag.ID), tag.Name, tagNames[tag.ParentID], tag.Emoji, tag.Color,
+			strconv.Itoa(tag.SortOrder), strconv.FormatBool(tag.Archived)})
+	}
+	return []table{events, targets, tags}
+}
+
+func formatAmount(amount float32) string {
+	return strconv.FormatFloat(float64(amount), 'f', 2, 32)
+}
@@ -0,0 +1,199 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeCSV puts every table to its own CSV file and packs them to a zip archive
+func writeCSV(data Data) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, sheet := range data.tables() {
+		file, err := archive.Create(sheet.name + ".csv")
+		if err != nil {
+			return nil, fmt.Errorf("error adding %s to archive: %v", sheet.name, err)
+		}
+		writer := csv.NewWriter(file)
+		if err = writer.WriteAll(append([][]string{sheet.header}, sheet.rows...)); err != nil {
+			return nil, fmt.Errorf("error writing %s as CSV: %v", sheet.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("error closing archive: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+type jsonEvent struct {
+	ID       int       `json:"id"`
+	Date     time.Time `json:"date"`
+	Amount   float32   `json:"amount"`
+	Currency string    `json:"currency"`
+	Tag      string    `json:"tag"`
+	Comment  string    `json:"comment"`
+}
+
+type jsonTarget struct {
+	ID          int     `json:"id"`
+	PeriodStart string  `json:"period_start"`
+	PeriodEnd   string  `json:"period_end"`
+	Amount      float32 `json:"amount"`
+	Tag         string  `json:"tag"`
+}
+
+type jsonTag struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Parent    string `json:"parent,omitempty"`
+	Emoji     string `json:"emoji,omitempty"`
+	Color     string `json:"color,omitempty"`
+	SortOrder int    `json:"sort_order"`
+	Archived  bool   `json:"archived"`
+}
+
+type jsonExport struct {
+	PeriodStart string       `json:"period_start"`
+	PeriodEnd   string       `json:"period_end"`
+	Events      []jsonEvent  `json:"events"`
+	Targets     []jsonTarget `json:"targets"`
+	Tags        []jsonTag    `json:"tags"`
+}
+
+func writeJSON(data Data) ([]byte, error) {
+	result := jsonExport{
+		PeriodStart: data.Period.Start.Format(time.DateOnly),
+		PeriodEnd:   data.Period.End.AddDate(0, 0, -1).Format(time.DateOnly),
+		Events:      []jsonEvent{},
+		Targets:     []jsonTarget{},
+		Tags:        []jsonTag{},
+	}
+	tagNames := make(map[int]string)
+	for _, tag := range data.Tags {
+		tagNames[tag.ID] = tag.Name
+	}
+	for _, event := range data.Events {
+		result.Events = append(result.Events, jsonEvent{ID: event.ID, Date: event.Created, Amount: event.Amount,
+			Currency: event.Currency, Tag: event.Tag, Comment: event.Comment})
+	}
+	for _, target := range data.Targets {
+		result.Targets = append(result.Targets, jsonTarget{ID: target.ID, PeriodStart: target.PeriodStart.Format(time.DateOnly),
+			PeriodEnd: target.PeriodEnd.Format(time.DateOnly), Amount: target.Amount, Tag: target.Tag})
+	}
+	for _, tag := range data.Tags {
+		result.Tags = append(result.Tags, jsonTag{ID: tag.ID, Name: tag.Name, Parent: tagNames[tag.ParentID], Emoji: tag.Emoji,
+			Color: tag.Color, SortOrder: tag.SortOrder, Archived: tag.Archived})
+	}
+	content, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("error writing JSON: %v", err)
+	}
+	return content, nil
+}
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+%s</Types>`
+	xlsxSheetContentType = `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+`
+	xlsxRootRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets>%s</sheets>
+</workbook>`
+	xlsxWorkbookRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+%s</Relationships>`
+)
+
+// writeXLSX makes a workbook with a sheet for every table. Amounts and ids are numbers, everything else is text
+func writeXLSX(data Data) ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	tables := data.tables()
+	var contentTypes, sheets, relationships strings.Builder
+	for i, sheet := range tables {
+		number := i + 1
+		fmt.Fprintf(&contentTypes, xlsxSheetContentType, number)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, sheet.name, number, number)
+		fmt.Fprintf(&relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>
+`, number, number)
+	}
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, contentTypes.String())},
+		{"_rels/.rels", xlsxRootRelationships},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, sheets.String())},
+		{"xl/_rels/workbook.xml.rels", fmt.Sprintf(xlsxWorkbookRelationships, relationships.String())},
+	}
+	for i, sheet := range tables {
+		files = append(files, struct {
+			name    string
+			content string
+		}{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), worksheet(sheet)})
+	}
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return nil, fmt.Errorf("error adding %s to workbook: %v", file.name, err)
+		}
+		if _, err = writer.Write([]byte(file.content)); err != nil {
+			return nil, fmt.Errorf("error writing %s to workbook: %v", file.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("error closing workbook: %v", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func worksheet(sheet table) string {
+	var result strings.Builder
+	result.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range append([][]string{sheet.header}, sheet.rows...) {
+		fmt.Fprintf(&result, `<row r="%d">`, i+1)
+		for j, value := range row {
+			reference := columnName(j) + strconv.Itoa(i+1)
+			if _, err := strconv.ParseFloat(value, 64); err == nil && i > 0 && isNumericColumn(sheet.header[j]) {
+				fmt.Fprintf(&result, `<c r="%s"><v>%s</v></c>`, reference, value)
+				continue
+			}
+			var escaped bytes.Buffer
+			_ = xml.EscapeText(&escaped, []byte(value))
+			fmt.Fprintf(&result, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, reference, escaped.String())
+		}
+		result.WriteString(`</row>`)
+	}
+	result.WriteString(`</sheetData></worksheet>`)
+	return result.String()
+}
+
+func isNumericColumn(name string) bool {
+	return name == "id" || name == "amount" || name == "sort_order"
+}
+
+// columnName is the spreadsheet name of the column by its index: A, B, ... Z, AA, AB...
+func columnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,364 @@
+package importing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+const (
+	RoleDate        = "date"
+	RoleAmount      = "amount"
+	RoleDescription = "description"
+	RoleCurrency    = "currency"
+	// RoleExpenses tells the sign of expenses in the file: "positive" or "negative". Banks usually write expenses
+	// as negative amounts, and the bot keeps them positive
+	RoleExpenses     = "expenses"
+	expensesNegative = "negative"
+	expensesPositive = "positive"
+	noColumn         = -1
+	defaultCurrency  = "ARS"
+)
+
+// Roles are the columns an import needs, currency is optional
+var Roles = []string{RoleDate, RoleAmount, RoleDescription, RoleCurrency}
+
+// headerWords are parts of column names which tell the role of the column in files of banks and apps
+var headerWords = map[string][]string{
+	RoleDate:        {"fecha", "date", "dia", "fch"},
+	RoleAmount:      {"importe", "monto", "amount", "valor", "debito", "value"},
+	RoleDescription: {"descripcion", "description", "concepto", "detalle", "payee", "memo", "comercio", "referencia", "operacion"},
+	RoleCurrency:    {"moneda", "currency", "divisa"},
+}
+
+// Columns tells which column of a [Table] has which role. Numbers start from 0, a missing column is -1
+type Columns struct {
+	Date        int
+	Amount      int
+	Description int
+	Currency    int
+	// NegativeExpenses is true when expenses are written with minus in the file
+	NegativeExpenses bool
+}
+
+// DetectColumns guesses columns by names in the header and checks the guess with values of the rows.
+// It tells if all the needed columns are found
+func DetectColumns(table Table) (Columns, bool) {
+	columns := Columns{Date: noColumn, Amount: noColumn, Description: noColumn, Currency: noColumn}
+	for _, role := range Roles {
+		for i, name := range table.Header {
+			if columns.taken(i) || !matchesRole(name, role) {
+				continue
+			}
+			columns.set(role, i)
+			break
+		}
+	}
+	if columns.Date == noColumn || !columns.datesReadable(table) {
+		columns.Date = columns.guessDate(table)
+	}
+	if columns.Amount == noColumn {
+		columns.Amount = columns.guessAmount(table)
+	}
+	if columns.Description == noColumn {
+		columns.Description = columns.guessDescription(table)
+	}
+	columns.NegativeExpenses = mostlyNegative(table, columns.Amount)
+	return columns, columns.Complete()
+}
+
+// Complete tells if there are columns for date, amount and description
+func (columns Columns) Complete() bool {
+	return columns.Date != noColumn && columns.Amount != noColumn && columns.Description != noColumn
+}
+
+// ParseColumns reads columns typed like "date=1, amount=Importe, description=3, expenses=negative".
+// Columns can be given by their number starting from 1 or by name. Lines or semicolons can separate them too
+func ParseColumns(text string, header []string) (Columns, error) {
+	columns := Columns{Date: noColumn, Amount: noColumn, Description: noColumn, Currency: noColumn}
+	pairs := strings.FieldsFunc(text, func(r rune) bool { return r == ',' || r == ';' || r == '\n' })
+	for _, pair := range pairs {
+		role, value, found := strings.Cut(pair, "=")
+		if !found {
+			return columns, fmt.Errorf("'%s' is not like 'date=1'", strings.TrimSpace(pair))
+		}
+		role, value = strings.ToLower(strings.TrimSpace(role)), strings.TrimSpace(value)
+		if role == RoleExpenses {
+			switch strings.ToLower(value) {
+			case expensesNegative:
+				columns.NegativeExpenses = true
+			case expensesPositive:
+				columns.NegativeExpenses = false
+			default:
+				return columns, fmt.Errorf("expenses can be %s or %s", expensesNegative, expensesPositive)
+			}
+			continue
+		}
+		if !isRole(role) {
+			return columns, fmt.Errorf("there is no '%s' column, use %s", role, strings.Join(Roles, ", "))
+		}
+		column, err := findColumn(value, header)
+		if err != nil {
+			return columns, err
+		}
+		columns.set(role, column)
+	}
+	if !columns.Complete() {
+		return columns, fmt.Errorf("%s, %s and %s are needed", RoleDate, RoleAmount, RoleDescription)
+	}
+	return columns, nil
+}
+
+// String gives columns in the form [ParseColumns] understands with column numbers
+func (columns Columns) String() string {
+	parts := []string{
+		fmt.Sprintf("%s=%d", RoleDate, columns.Date+1),
+		fmt.Sprintf("%s=%d", RoleAmount, columns.Amount+1),
+		fmt.Sprintf("%s=%d", RoleDescription, columns.Description+1),
+	}
+	if columns.Currency != noColumn {
+		parts = append(parts, fmt.Sprintf("%s=%d", RoleCurrency, columns.Currency+1))
+	}
+	expenses := expensesPositive
+	if columns.NegativeExpenses {
+		expenses = expensesNegative
+	}
+	return strings.Join(append(parts, RoleExpenses+"="+expenses), ", ")
+}
+
+// Describe tells which column of the header has which role, like "date: Fecha"
+func (columns Columns) Describe(header []string) string {
+	var lines []string
+	for _, role := range Roles {
+		column := columns.get(role)
+		if column == noColumn || column >= len(header) {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", role, header[column]))
+	}
+	expenses := expensesPositive
+	if columns.NegativeExpenses {
+		expenses = expensesNegative
+	}
+	return strings.Join(append(lines, RoleExpenses+": "+expenses), "\n")
+}
+
+// Events reads a money event from every row. Rows which can't be read are described in problems.
+// Incomes of the file become negative expenses like the bot keeps them
+func Events(table Table, columns Columns) (events []storage_interface.MoneyEvent, problems []string) {
+	if !columns.Complete() || !columns.inside(len(table.Header)) {
+		return nil, []string{"columns don't fit the file"}
+	}
+	var dates []string
+	for _, row := range table.Rows {
+		dates = append(dates, row[columns.Date])
+	}
+	layout, found := DateLayout(dates)
+	if !found {
+		return nil, []string{fmt.Sprintf("dates like '%s' are not known", table.Sample(columns.Date))}
+	}
+	for i, row := range table.Rows {
+		created, err := time.ParseInLocation(layout, row[columns.Date], time.Local)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: no date", i+1))
+			continue
+		}
+		amount, err := ParseAmount(row[columns.Amount])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: %v", i+1, err))
+			continue
+		}
+		if columns.NegativeExpenses {
+			amount = -amount
+		}
+		currency := defaultCurrency
+		if columns.Currency != noColumn && len(row[columns.Currency]) == 3 {
+			currency = strings.ToUpper(row[columns.Currency])
+		}
+		events = append(events, storage_interface.MoneyEvent{
+			Amount:   amount,
+			Currency: currency,
+			Comment:  strings.Join(strings.Fields(row[columns.Description]), " "),
+			Created:  created,
+		})
+	}
+	return events, problems
+}
+
+func (columns *Columns) set(role string, column int) {
+	switch role {
+	case RoleDate:
+		columns.Date = column
+	case RoleAmount:
+		columns.Amount = column
+	case RoleDescription:
+		columns.Description = column
+	case RoleCurrency:
+		columns.Currency = column
+	}
+}
+
+func (columns Columns) get(role string) int {
+	switch role {
+	case RoleDate:
+		return columns.Date
+	case RoleAmount:
+		return columns.Amount
+	case RoleDescription:
+		return columns.Description
+	case RoleCurrency:
+		return columns.Currency
+	}
+	return noColumn
+}
+
+func (columns Columns) taken(column int) bool {
+	for _, role := range Roles {
+		if columns.get(role) == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (columns Columns) inside(width int) bool {
+	for _, role := range Roles {
+		if columns.get(role) >= width {
+			return false
+		}
+	}
+	return true
+}
+
+func (columns Columns) datesReadable(table Table) bool {
+	_, found := DateLayout(columnValues(table, columns.Date))
+	return found
+}
+
+// guessDate takes the first free column where all values are dates
+func (columns Columns) guessDate(table Table) int {
+	for i := range table.Header {
+		if !columns.taken(i) {
+			if _, found := DateLayout(columnValues(table, i)); found {
+				return i
+			}
+		}
+	}
+	return noColumn
+}
+
+// guessAmount takes the first free column where all values are numbers with decimals
+func (columns Columns) guessAmount(table Table) int {
+	for i := range table.Header {
+		if !columns.taken(i) && amountsOnly(columnValues(table, i)) {
+			return i
+		}
+	}
+	return noColumn
+}
+
+func amountsOnly(values []string) bool {
+	for _, value := range values {
+		if _, err := ParseAmount(value); err != nil || !strings.ContainsAny(value, ".,") {
+			return false
+		}
+	}
+	return len(values) > 0
+}
+
+// guessDescription takes the free column with the longest texts which are not amounts
+func (columns Columns) guessDescription(table Table) int {
+	best, bestLength := noColumn, 0
+	for i := range table.Header {
+		if columns.taken(i) || amountsOnly(columnValues(table, i)) {
+			continue
+		}
+		length := 0
+		for _, value := range columnValues(table, i) {
+			length += len(value)
+		}
+		if length > bestLength {
+			best, bestLength = i, length
+		}
+	}
+	return best
+}
+
+func mostlyNegative(table Table, column int) bool {
+	if column == noColumn {
+		return false
+	}
+	negative, positive := 0, 0
+	for _, value := range columnValues(table, column) {
+		amount, err := ParseAmount(value)
+		switch {
+		case err != nil:
+		case amount < 0:
+			negative++
+		case amount > 0:
+			positive++
+		}
+	}
+	return negative > positive
+}
+
+func columnValues(table Table, column int) []string {
+	if column == noColumn {
+		return nil
+	}
+	var values []string
+	for _, row := range table.Rows {
+		if row[column] != "" {
+			values = append(values, row[column])
+		}
+	}
+	return values
+}
+
+func isRole(role string) bool {
+	for _, known := range Roles {
+		if known == role {
+			return true
+		}
+	}
+	return false
+}
+
+func findColumn(value string, header []string) (int, error) {
+	if number, err := strconv.Atoi(value); err == nil {
+		if number < 1 || number > len(header) {
+			return noColumn, fmt.Errorf("there are columns from 1 to %d", len(header))
+		}
+		return number - 1, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(name, value) {
+			return i, nil
+		}
+	}
+	return noColumn, fmt.Errorf("there is no column '%s'", value)
+}
+
+// matchesRole tells if the column name has a word of the role and no words of other roles: "Fecha valor" is not an amount
+func matchesRole(name, role string) bool {
+	folded := foldAccents(strings.ToLower(name))
+	matched := false
+	for otherRole, words := range headerWords {
+		for _, word := range words {
+			if !strings.Contains(folded, word) {
+				continue
+			}
+			if otherRole != role {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// foldAccents turns "descripción" into "descripcion"
+var foldAccents = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u", "ñ", "n").Replace
@@ -0,0 +1,65 @@
+package importing
+
+import (
+	"fmt"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// Interval gives the days the events happened in as [start, end)
+func Interval(events []storage_interface.MoneyEvent) (time.Time, time.Time) {
+	var start, end time.Time
+	for i, event := range events {
+		if i == 0 || event.Created.Before(start) {
+			start = event.Created
+		}
+		if i == 0 || event.Created.After(end) {
+			end = event.Created
+		}
+	}
+	startYear, startMonth, startDay := start.Date()
+	endYear, endMonth, endDay := end.Date()
+	return time.Date(startYear, startMonth, startDay, 0, 0, 0, 0, start.Location()),
+		time.Date(endYear, endMonth, endDay, 0, 0, 0, 0, end.Location()).AddDate(0, 0, 1)
+}
+
+// SkipDuplicates separates events which are already among existing ones. Events with ExternalID, like FITID of OFX,
+// are the same when their ids are. Otherwise events are the same when they have the same day, amount and description,
+// but an event can't repeat an existing one with another ExternalID. Two equal rows in the file are two events
+// unless there are two of them already
+func SkipDuplicates(events, existing []storage_interface.MoneyEvent) (fresh, duplicates []storage_interface.MoneyEvent) {
+	externalIDs := make(map[string]bool)
+	recorded := make(map[string]int)
+	recordedWithoutID := make(map[string]int)
+	for _, event := range existing {
+		key := duplicateKey(event)
+		recorded[key]++
+		if event.ExternalID == "" {
+			recordedWithoutID[key]++
+		} else {
+			externalIDs[event.ExternalID] = true
+		}
+	}
+	for _, event := range events {
+		key := duplicateKey(event)
+		candidates := recorded
+		if event.ExternalID != "" {
+			candidates = recordedWithoutID
+		}
+		switch {
+		case event.ExternalID != "" && externalIDs[event.ExternalID]:
+			duplicates = append(duplicates, event)
+		case candidates[key] > 0:
+			candidates[key]--
+			duplicates = append(duplicates, event)
+		default:
+			fresh = append(fresh, event)
+		}
+	}
+	return fresh, duplicates
+}
+
+func duplicateKey(event storage_interface.MoneyEvent) string {
+	return fmt.Sprintf("%s|%.2f|%s", event.Created.In(time.Local).Format(time.DateOnly), event.Amount, normalizeDescription(event.Comment))
+}
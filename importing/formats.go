@@ -0,0 +1,69 @@
+package importing
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"ingresos_gastos/storage_interface"
+)
+
+const (
+	FormatCSV = "csv"
+	FormatOFX = "ofx"
+	FormatQIF = "qif"
+	// FormatTelegram is result.json of a chat exported by Telegram Desktop
+	FormatTelegram = "telegram"
+)
+
+var (
+	ErrUnknownFormat  = errors.New("unknown file format")
+	ErrUnknownColumns = errors.New("columns of the file are not known")
+)
+
+// formatsByExtension tells the format of a file by its name, QFX is how Quicken calls OFX
+var formatsByExtension = map[string]string{
+	".csv":  FormatCSV,
+	".txt":  FormatCSV,
+	".ofx":  FormatOFX,
+	".qfx":  FormatOFX,
+	".qif":  FormatQIF,
+	".json": FormatTelegram,
+}
+
+// FormatOf tells the format of the file by its name
+func FormatOf(fileName string) (string, error) {
+	format, ok := formatsByExtension[strings.ToLower(filepath.Ext(fileName))]
+	if !ok {
+		return "", fmt.Errorf("can't import '%s': %w", fileName, ErrUnknownFormat)
+	}
+	return format, nil
+}
+
+// ReadEvents reads money events of the file. CSV files need columns in the form of [Columns.String],
+// other formats know their columns themselves. Chat exports are read by [TelegramEvents] instead
+func ReadEvents(fileName string, content []byte, columns string) (events []storage_interface.MoneyEvent, problems []string, err error) {
+	format, err := FormatOf(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch format {
+	case FormatOFX:
+		return ParseOFX(content)
+	case FormatQIF:
+		return ParseQIF(content)
+	case FormatTelegram:
+		return nil, nil, fmt.Errorf("messages of '%s' are read by TelegramEvents: %w", fileName, ErrUnknownFormat)
+	}
+	table, err := ReadCSV(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	parsedColumns, err := ParseColumns(columns, table.Header)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %w", err, ErrUnknownColumns)
+	}
+	events, problems = Events(table, parsedColumns)
+	return events, problems, nil
+}
@@ -0,0 +1,126 @@
+package importing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// ofxElement is an OFX tag with its value. OFX 1 is SGML where tags with values are not closed, OFX 2 is XML,
+// both look the same for this expression
+var ofxElement = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+// ofxTransaction is a STMTTRN block of the statement
+type ofxTransaction struct {
+	posted, amount, fitID, name, memo, currency string
+}
+
+// ParseOFX reads transactions of OFX and QFX statements. Debits of the statement become expenses and credits
+// become negative expenses. FITID of a transaction is its ExternalID
+func ParseOFX(content []byte) (events []storage_interface.MoneyEvent, problems []string, err error) {
+	text := string(content)
+	if !strings.Contains(strings.ToUpper(text), "<OFX>") {
+		return nil, nil, fmt.Errorf("there is no <OFX> in the file")
+	}
+	var transactions []ofxTransaction
+	var current *ofxTransaction
+	statementCurrency := defaultCurrency
+	for _, match := range ofxElement.FindAllStringSubmatch(text, -1) {
+		closing, tag, value := match[1] == "/", strings.ToUpper(match[2]), strings.TrimSpace(match[3])
+		if tag == "STMTTRN" {
+			if current != nil {
+				transactions = append(transactions, *current)
+				current = nil
+			}
+			if !closing {
+				current = &ofxTransaction{}
+			}
+			continue
+		}
+		if closing {
+			if tag == "BANKTRANLIST" && current != nil {
+				transactions = append(transactions, *current)
+				current = nil
+			}
+			continue
+		}
+		if tag == "CURDEF" && value != "" {
+			statementCurrency = strings.ToUpper(value)
+		}
+		if current == nil {
+			continue
+		}
+		switch tag {
+		case "DTPOSTED":
+			current.posted = value
+		case "TRNAMT":
+			current.amount = value
+		case "FITID":
+			current.fitID = value
+		case "NAME":
+			current.name = unescapeOFX(value)
+		case "MEMO":
+			current.memo = unescapeOFX(value)
+		case "CURSYM":
+			current.currency = strings.ToUpper(value)
+		}
+	}
+	if current != nil {
+		transactions = append(transactions, *current)
+	}
+
+	for i, transaction := range transactions {
+		created, errParsing := parseOFXDate(transaction.posted)
+		if errParsing != nil {
+			problems = append(problems, fmt.Sprintf("transaction %d: %v", i+1, errParsing))
+			continue
+		}
+		amount, errParsing := ParseAmount(transaction.amount)
+		if errParsing != nil {
+			problems = append(problems, fmt.Sprintf("transaction %d: %v", i+1, errParsing))
+			continue
+		}
+		currency := statementCurrency
+		if transaction.currency != "" {
+			currency = transaction.currency
+		}
+		events = append(events, storage_interface.MoneyEvent{
+			Amount:     -amount,
+			Currency:   currency,
+			Comment:    joinDescription(transaction.name, transaction.memo),
+			Created:    created,
+			ExternalID: transaction.fitID,
+		})
+	}
+	return events, problems, nil
+}
+
+// parseOFXDate reads dates like 20240301, 20240301120000 or 20240301120000.000[-3:ART]. The time zone is dropped,
+// only the day matters
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("'%s' is not a date", value)
+	}
+	created, err := time.ParseInLocation("20060102", value[:8], time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("'%s' is not a date", value)
+	}
+	return created, nil
+}
+
+var unescapeOFX = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&apos;", "'").Replace
+
+// joinDescription makes a comment of the payee and the memo, the memo is skipped when it repeats the payee
+func joinDescription(payee, memo string) string {
+	payee, memo = strings.Join(strings.Fields(payee), " "), strings.Join(strings.Fields(memo), " ")
+	switch {
+	case payee == "":
+		return memo
+	case memo == "" || strings.Contains(strings.ToLower(payee), strings.ToLower(memo)):
+		return payee
+	}
+	return payee + " " + memo
+}
@@ -0,0 +1,82 @@
+package importing
+
+import (
+	"strings"
+
+	"ingresos_gastos/categorization"
+	"ingresos_gastos/storage_interface"
+)
+
+// historyYears is how far back earlier events are read to tag imported ones like them
+const historyYears = 1
+
+// Plan is what an import is going to do: Fresh events are new, with tags chosen for them, and Duplicates are recorded already
+type Plan struct {
+	Fresh      []storage_interface.MoneyEvent
+	Duplicates []storage_interface.MoneyEvent
+}
+
+// NewPlan skips events which the user has already recorded and tags the rest by user's categorization rules or,
+// when no rule fits, by the tag of the latest event with the same description
+func NewPlan(storage storage_interface.ActualStorage, userID int64, events []storage_interface.MoneyEvent) (Plan, error) {
+	if len(events) == 0 {
+		return Plan{}, nil
+	}
+	start, end := Interval(events)
+	history, err := storage.GetMoneyEventsByDateInterval(start.AddDate(-historyYears, 0, 0), end, userID)
+	if err != nil {
+		return Plan{}, err
+	}
+	var existing []storage_interface.MoneyEvent
+	for _, event := range history {
+		if !event.Created.Before(start) {
+			existing = append(existing, event)
+		}
+	}
+	var plan Plan
+	plan.Fresh, plan.Duplicates = SkipDuplicates(events, existing)
+
+	storedRules, err := storage.GetCategorizationRules(userID)
+	if err != nil {
+		return Plan{}, err
+	}
+	var rules []categorization.Rule
+	for _, storedRule := range storedRules {
+		conditions, errParsing := categorization.ParseConditions(storedRule.Expression)
+		if errParsing == nil {
+			rules = append(rules, categorization.Rule{ID: storedRule.ID, Conditions: conditions, Tag: storedRule.Tag})
+		}
+	}
+	tagsByDescription := make(map[string]string)
+	for _, event := range history {
+		if event.Tag != "" {
+			tagsByDescription[normalizeDescription(event.Comment)] = event.Tag
+		}
+	}
+	for i, event := range plan.Fresh {
+		if event.Tag != "" {
+			continue
+		}
+		if rule, found := categorization.FindRule(rules, event.Amount, event.Comment); found {
+			plan.Fresh[i].Tag = rule.Tag
+		} else if tag, found := tagsByDescription[normalizeDescription(event.Comment)]; found && event.Comment != "" {
+			plan.Fresh[i].Tag = tag
+		}
+	}
+	return plan, nil
+}
+
+// Tagged is how many fresh events got a tag
+func (plan Plan) Tagged() int {
+	tagged := 0
+	for _, event := range plan.Fresh {
+		if event.Tag != "" {
+			tagged++
+		}
+	}
+	return tagged
+}
+
+func normalizeDescription(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
@@ -0,0 +1,106 @@
+package importing
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// qifDateLayouts are dates of QIF files. Quicken writes month before day, but banks of other countries don't,
+// so the layout which fits most of the dates wins
+var qifDateLayouts = []string{
+	"01/02/2006",
+	"1/2/2006",
+	"01/02/06",
+	"1/2/06",
+	"02/01/2006",
+	"2/1/2006",
+	"02/01/06",
+	"2/1/06",
+	time.DateOnly,
+	"02.01.2006",
+}
+
+// qifRecord is a transaction of the file, it ends with ^
+type qifRecord struct {
+	date, amount, payee, memo string
+}
+
+// ParseQIF reads transactions of a QIF file of a bank or a card account. Payments become expenses
+// and deposits become negative expenses
+func ParseQIF(content []byte) (events []storage_interface.MoneyEvent, problems []string, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(content, []byte("\xEF\xBB\xBF"))))
+	var records []qifRecord
+	var current qifRecord
+	started, investments := false, false
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		code, value := line[0], strings.TrimSpace(line[1:])
+		switch code {
+		case '!':
+			investments = strings.HasPrefix(strings.ToLower(line), "!type:invst")
+		case '^':
+			if started && !investments {
+				records = append(records, current)
+			}
+			current, started = qifRecord{}, false
+		case 'D':
+			current.date, started = normalizeQIFDate(value), true
+		case 'T', 'U':
+			current.amount, started = value, true
+		case 'P':
+			current.payee = value
+		case 'M':
+			current.memo = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error reading QIF: %v", err)
+	}
+	if started && !investments {
+		records = append(records, current)
+	}
+	if len(records) == 0 {
+		return nil, nil, fmt.Errorf("there are no transactions in the file")
+	}
+
+	var dates []string
+	for _, record := range records {
+		dates = append(dates, record.date)
+	}
+	layout, found := bestLayout(dates, qifDateLayouts)
+	if !found {
+		return nil, nil, fmt.Errorf("dates like '%s' are not known", records[0].date)
+	}
+	for i, record := range records {
+		created, errParsing := time.ParseInLocation(layout, record.date, time.Local)
+		if errParsing != nil {
+			problems = append(problems, fmt.Sprintf("transaction %d: no date", i+1))
+			continue
+		}
+		amount, errParsing := ParseAmount(record.amount)
+		if errParsing != nil {
+			problems = append(problems, fmt.Sprintf("transaction %d: %v", i+1, errParsing))
+			continue
+		}
+		events = append(events, storage_interface.MoneyEvent{
+			Amount:   -amount,
+			Currency: defaultCurrency,
+			Comment:  joinDescription(record.payee, record.memo),
+			Created:  created,
+		})
+	}
+	return events, problems, nil
+}
+
+// normalizeQIFDate turns Quicken dates like "3/ 1'24" into "3/1/24"
+func normalizeQIFDate(value string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(value, "'", "/"), " ", "")
+}
@@ -0,0 +1,134 @@
+// Package importing turns files from banks and other apps into money events: it reads the files,
+// finds which columns mean what and skips events which are already recorded
+package importing
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// maxHeaderSearch is how many first rows can be a preamble before the header, banks like to put the account there
+const maxHeaderSearch = 20
+
+var ErrEmptyFile = errors.New("there are no rows in the file")
+
+// Table is a CSV file: the header row and the rows after it. All rows are as long as the header
+type Table struct {
+	Header []string
+	Rows   [][]string
+}
+
+// ReadCSV reads a CSV file separated by commas, semicolons or tabs. Lines before the header, like account number
+// or the name of the bank, are skipped: the header is the first row as wide as most of the rows
+func ReadCSV(content []byte) (Table, error) {
+	content = bytes.TrimPrefix(content, []byte("\xEF\xBB\xBF"))
+	records, err := readRecords(content, detectDelimiter(content))
+	if err != nil {
+		return Table{}, fmt.Errorf("error reading CSV: %v", err)
+	}
+	width, _ := usualWidth(records)
+	if width < 2 {
+		return Table{}, ErrEmptyFile
+	}
+	headerIndex := -1
+	for i := 0; i < len(records) && i < maxHeaderSearch; i++ {
+		if len(records[i]) == width {
+			headerIndex = i
+			break
+		}
+	}
+	if headerIndex < 0 || headerIndex == len(records)-1 {
+		return Table{}, ErrEmptyFile
+	}
+	table := Table{Header: trimAll(records[headerIndex])}
+	for _, record := range records[headerIndex+1:] {
+		if len(record) < width {
+			// totals and notes after the rows are shorter
+			continue
+		}
+		table.Rows = append(table.Rows, trimAll(record[:width]))
+	}
+	if len(table.Rows) == 0 {
+		return Table{}, ErrEmptyFile
+	}
+	return table, nil
+}
+
+// Signature tells files of the same kind apart: files with the same header get the same signature
+func (table Table) Signature() string {
+	var names []string
+	for _, name := range table.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	return strings.Join(names, ";")
+}
+
+// Sample is the first not empty value of the column
+func (table Table) Sample(column int) string {
+	for _, row := range table.Rows {
+		if row[column] != "" {
+			return row[column]
+		}
+	}
+	return ""
+}
+
+func readRecords(content []byte, delimiter rune) ([][]string, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	return withoutEmptyRecords(records), err
+}
+
+// detectDelimiter picks the separator which splits most of the rows into the same number of columns
+func detectDelimiter(content []byte) rune {
+	delimiter, bestRows, bestWidth := ',', 0, 0
+	for _, candidate := range []rune{',', ';', '\t'} {
+		records, err := readRecords(content, candidate)
+		if err != nil {
+			continue
+		}
+		width, rows := usualWidth(records)
+		if width >= 2 && (rows > bestRows || (rows == bestRows && width > bestWidth)) {
+			delimiter, bestRows, bestWidth = candidate, rows, width
+		}
+	}
+	return delimiter
+}
+
+func withoutEmptyRecords(records [][]string) [][]string {
+	var result [][]string
+	for _, record := range records {
+		if strings.TrimSpace(strings.Join(record, "")) != "" {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// usualWidth is the number of fields most of the records have and how many records have it
+func usualWidth(records [][]string) (int, int) {
+	counts := make(map[int]int)
+	width := 0
+	for _, record := range records {
+		counts[len(record)]++
+		if counts[len(record)] > counts[width] || (counts[len(record)] == counts[width] && len(record) > width) {
+			width = len(record)
+		}
+	}
+	return width, counts[width]
+}
+
+func trimAll(values []string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = strings.TrimSpace(value)
+	}
+	return result
+}
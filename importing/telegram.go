@@ -0,0 +1,137 @@
+package importing
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// telegramChat is a chat of the result.json file Telegram Desktop exports. A file of one chat is the chat itself,
+// a file of the whole account keeps chats in its list
+type telegramChat struct {
+	ID       int64             `json:"id"`
+	Messages []telegramMessage `json:"messages"`
+	Chats    struct {
+		List []telegramChat `json:"list"`
+	} `json:"chats"`
+}
+
+type telegramMessage struct {
+	ID           int             `json:"id"`
+	Type         string          `json:"type"`
+	Date         string          `json:"date"`
+	DateUnixtime string          `json:"date_unixtime"`
+	Text         json.RawMessage `json:"text"`
+}
+
+// ChatMessage is a text message of an exported chat
+type ChatMessage struct {
+	ExternalID string
+	Sent       time.Time
+	Text       string
+}
+
+// ParseTelegramExport reads text messages of the result.json file Telegram Desktop exports, service messages
+// and messages without text are skipped
+func ParseTelegramExport(content []byte) ([]ChatMessage, error) {
+	var export telegramChat
+	if err := json.Unmarshal(content, &export); err != nil {
+		return nil, fmt.Errorf("it is not a Telegram export: %v", err)
+	}
+	chats := append([]telegramChat{export}, export.Chats.List...)
+	var messages []ChatMessage
+	for _, chat := range chats {
+		for _, message := range chat.Messages {
+			if message.Type != "" && message.Type != "message" {
+				continue
+			}
+			text := messageText(message.Text)
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			sent, err := messageTime(message)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, ChatMessage{
+				ExternalID: fmt.Sprintf("telegram:%d:%d", chat.ID, message.ID),
+				Sent:       sent,
+				Text:       text,
+			})
+		}
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("there are no text messages in the file")
+	}
+	return messages, nil
+}
+
+// TelegramEvents reads every line of exported messages with parseLine, the way the bot reads typed expenses.
+// Events are dated by their messages, lines which can't be read go to problems
+func TelegramEvents(content []byte, parseLine func(text string) (storage_interface.MoneyEvent, bool)) (events []storage_interface.MoneyEvent, problems []string, err error) {
+	messages, err := ParseTelegramExport(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, message := range messages {
+		lines := strings.Split(message.Text, "\n")
+		for i, line := range lines {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+			event, ok := parseLine(line)
+			if !ok {
+				problems = append(problems, message.Sent.Format("2006-01-02 15:04")+" "+line)
+				continue
+			}
+			event.Created = message.Sent
+			event.ExternalID = message.ExternalID
+			if len(lines) > 1 {
+				event.ExternalID += ":" + strconv.Itoa(i)
+			}
+			events = append(events, event)
+		}
+	}
+	return events, problems, nil
+}
+
+// messageText joins the text of a message, it is a string or a list of strings and entities like links
+func messageText(raw json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	var parts []json.RawMessage
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return ""
+	}
+	var builder strings.Builder
+	for _, part := range parts {
+		var entity struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(part, &text); err == nil {
+			builder.WriteString(text)
+		} else if err = json.Unmarshal(part, &entity); err == nil {
+			builder.WriteString(entity.Text)
+		}
+	}
+	return builder.String()
+}
+
+// messageTime is when the message was sent, exports of newer versions have unix time besides the local one
+func messageTime(message telegramMessage) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(message.DateUnixtime, 10, 64); err == nil {
+		return time.Unix(seconds, 0).In(time.Local), nil
+	}
+	sent, err := time.ParseInLocation("2006-01-02T15:04:05", message.Date, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("message %d has no date: %v", message.ID, err)
+	}
+	return sent, nil
+}
@@ -0,0 +1,105 @@
+package importing
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLayouts are date formats of bank files. Day goes before month as it is usual in Argentina
+var dateLayouts = []string{
+	time.DateOnly,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	time.RFC3339,
+	"02/01/2006",
+	"2/1/2006",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/06",
+	"02-01-2006",
+	"02.01.2006",
+	"2006/01/02",
+	"20060102",
+}
+
+// DateLayout finds the format most of the dates are written in. Some values may be something else, like "Total"
+func DateLayout(values []string) (string, bool) {
+	return bestLayout(values, dateLayouts)
+}
+
+func bestLayout(values []string, layouts []string) (string, bool) {
+	best, bestMatched, total := "", 0, 0
+	for _, value := range values {
+		if value != "" {
+			total++
+		}
+	}
+	for _, layout := range layouts {
+		matched := 0
+		for _, value := range values {
+			if _, err := time.ParseInLocation(layout, value, time.Local); value != "" && err == nil {
+				matched++
+			}
+		}
+		if matched > bestMatched {
+			best, bestMatched = layout, matched
+		}
+	}
+	return best, bestMatched > 0 && bestMatched*2 > total
+}
+
+// ParseAmount reads amounts like "1.234,56", "1,234.56", "$ -350", "(350.00)" or "-1234". When there is only one kind
+// of separator it is decimal if one or two digits follow it, otherwise it separates thousands
+func ParseAmount(text string) (float32, error) {
+	negative := false
+	cleaned := strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',':
+			return r
+		case r == '-', r == '(':
+			negative = true
+		}
+		return -1
+	}, text)
+	if cleaned == "" {
+		return 0, fmt.Errorf("'%s' is not an amount", text)
+	}
+	lastDot, lastComma := strings.LastIndex(cleaned, "."), strings.LastIndex(cleaned, ",")
+	decimal := ""
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastDot > lastComma {
+			decimal = "."
+		} else {
+			decimal = ","
+		}
+	case lastDot >= 0 && isDecimalSeparator(cleaned, "."):
+		decimal = "."
+	case lastComma >= 0 && isDecimalSeparator(cleaned, ","):
+		decimal = ","
+	}
+	integer, fraction := cleaned, ""
+	if decimal != "" {
+		separatorIndex := strings.LastIndex(cleaned, decimal)
+		integer, fraction = cleaned[:separatorIndex], cleaned[separatorIndex+1:]
+	}
+	integer = strings.NewReplacer(".", "", ",", "").Replace(integer)
+	amount, err := strconv.ParseFloat(integer+"."+fraction+"0", 32)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not an amount", text)
+	}
+	if negative {
+		amount = -amount
+	}
+	return float32(amount), nil
+}
+
+func isDecimalSeparator(text, separator string) bool {
+	if strings.Count(text, separator) > 1 {
+		return false
+	}
+	digitsAfter := len(text) - strings.LastIndex(text, separator) - 1
+	return digitsAfter > 0 && digitsAfter <= 2
+}
@@ -0,0 +1,80 @@
+// Package installments splits purchases paid in monthly installments ("cuotas") of credit cards into
+// one expense per month. A purchase typed like "120000 home 12c tv" costs 120000 in total, paid in 12 months
+package installments
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// MaxCount is the longest plan of installments, banks don't give more than 60 months
+const MaxCount = 60
+
+// token is the word telling the number of installments, like "12c" or "12cuotas"
+var token = regexp.MustCompile(`(?i)^(\d{1,2})(?:c|cuotas?)$`)
+
+// Split takes the number of installments out of words typed after the amount. The count is 0 when there is
+// no such word or it asks for less than 2 or more than [MaxCount] installments, then the words stay the same
+func Split(words []string) (int, []string) {
+	for i, word := range words {
+		match := token.FindStringSubmatch(word)
+		if match == nil {
+			continue
+		}
+		count, _ := strconv.Atoi(match[1])
+		if count < 2 || count > MaxCount {
+			return 0, words
+		}
+		rest := append(append([]string{}, words[:i]...), words[i+1:]...)
+		return count, rest
+	}
+	return 0, words
+}
+
+// Token is the word for the number of installments which [Split] understands
+func Token(count int) string {
+	return fmt.Sprintf("%dc", count)
+}
+
+// Plan makes an expense for every installment of the purchase. The first one is on the day of the purchase
+// and others on the same day of the following months, or the last day of shorter months. Amounts are rounded
+// to cents and the first installment takes what rounding leaves, so they sum to the total.
+// Comments end with the number of the installment like "tv 3/12"
+func Plan(purchase storage_interface.Purchase, tag string) []storage_interface.MoneyEvent {
+	count := purchase.Installments
+	if count < 1 {
+		return nil
+	}
+	share := math.Floor(float64(purchase.Amount)*100/float64(count)) / 100
+	first := float64(purchase.Amount) - share*float64(count-1)
+	events := make([]storage_interface.MoneyEvent, count)
+	for i := range events {
+		amount := share
+		if i == 0 {
+			amount = first
+		}
+		events[i] = storage_interface.MoneyEvent{
+			Amount:     float32(math.Round(amount*100) / 100),
+			Currency:   purchase.Currency,
+			Comment:    strings.TrimSpace(fmt.Sprintf("%s %d/%d", purchase.Comment, i+1, count)),
+			Tag:        tag,
+			Created:    addMonths(purchase.Created, i),
+			PurchaseID: purchase.ID,
+		}
+	}
+	return events
+}
+
+// addMonths moves the moment by months keeping its day when the month has it, otherwise it is the last day
+func addMonths(moment time.Time, months int) time.Time {
+	year, month, day := moment.Date()
+	firstDay := time.Date(year, month+time.Month(months), 1, moment.Hour(), moment.Minute(), moment.Second(), moment.Nanosecond(), moment.Location())
+	lastDay := firstDay.AddDate(0, 1, -1).Day()
+	return firstDay.AddDate(0, 0, min(day, lastDay)-1)
+}
@@ -0,0 +1,267 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+)
+
+const (
+	FormatLedger    = "ledger"
+	FormatHledger   = "hledger"
+	FormatBeancount = "beancount"
+	// openDate opens beancount accounts before any possible event
+	openDate = "1970-01-01"
+)
+
+// Formats are all the journal formats
+var Formats = []string{FormatLedger, FormatHledger, FormatBeancount}
+
+var ErrUnknownFormat = errors.New("unknown journal format")
+
+// FileName is how the journal file of the format is called
+func FileName(format, period string) string {
+	extension := "journal"
+	switch format {
+	case FormatLedger:
+		extension = "ledger"
+	case FormatBeancount:
+		extension = "beancount"
+	}
+	return "expenses-" + period + "." + extension
+}
+
+// Records are what a journal is written from: events and transfers of the period [Start, End), all accounts
+// and tags of the user. Accounts added in the period get their opening balances
+type Records struct {
+	Events     []storage_interface.MoneyEvent
+	Transfers  []storage_interface.Transfer
+	Accounts   []storage_interface.Account
+	Tags       []storage_interface.Tag
+	Start, End time.Time
+}
+
+// entry is a transaction of the journal, notes are pairs of a name and a value like "id" and "42"
+type entry struct {
+	date        time.Time
+	description string
+	notes       [][2]string
+	postings    []posting
+}
+
+// posting moves the amount to the account. A posting converting money, like dollars bought with pesos,
+// has the total cost in the other currency
+type posting struct {
+	account      string
+	amount       float32
+	currency     string
+	cost         float32
+	costCurrency string
+}
+
+// Write gives a journal with a transaction for every event, transfer and opening balance. The tag account of
+// an event gets the amount and the user's account paying it gives it, like balances count them. Dates, currencies
+// and comments are kept, the tag and the id of the event go to transaction notes
+func Write(format string, records Records, mapping Mapping) ([]byte, error) {
+	entries := mapping.entries(records)
+	var builder strings.Builder
+	switch format {
+	case FormatLedger, FormatHledger:
+		for _, transaction := range entries {
+			writeLedgerTransaction(&builder, format, transaction)
+		}
+	case FormatBeancount:
+		writeBeancountOpenings(&builder, entries)
+		for _, transaction := range entries {
+			writeBeancountTransaction(&builder, transaction)
+		}
+	default:
+		return nil, fmt.Errorf("can't write journal in '%s': %w", format, ErrUnknownFormat)
+	}
+	return []byte(builder.String()), nil
+}
+
+// entries are transactions of the records ordered by date
+func (mapping Mapping) entries(records Records) []entry {
+	var entries []entry
+	for _, account := range records.Accounts {
+		if account.Opening == 0 || account.Created.Before(records.Start) || !account.Created.Before(records.End) {
+			continue
+		}
+		accountCurrency := currencyCode(account.Currency)
+		entries = append(entries, entry{
+			date:        account.Created,
+			description: "Opening balance of " + account.Name,
+			postings: []posting{
+				{account: mapping.userAccount(account), amount: account.Opening, currency: accountCurrency},
+				{account: OpeningBalances, amount: -account.Opening, currency: accountCurrency},
+			},
+		})
+	}
+	for _, event := range records.Events {
+		notes := [][2]string{{"id", strconv.Itoa(event.ID)}}
+		if event.Tag != "" {
+			notes = append(notes, [2]string{"tag", event.Tag})
+		}
+		entries = append(entries, entry{
+			date:        event.Created,
+			description: description(event),
+			notes:       notes,
+			postings: []posting{
+				{account: mapping.Account(records.Tags, event.Tag), amount: event.Amount, currency: currencyCode(event.Currency)},
+				{account: mapping.paidFrom(records.Accounts, event), amount: -event.Amount, currency: currencyCode(event.Currency)},
+			},
+		})
+	}
+	for _, transfer := range records.Transfers {
+		entries = append(entries, mapping.transferEntry(records.Accounts, transfer))
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].date.Before(entries[j].date)
+	})
+	return entries
+}
+
+// transferEntry moves Amount out of the account it leaves, or out of Income for money coming from outside, and
+// Received into the account it comes to. Between currencies the received money costs the amount
+func (mapping Mapping) transferEntry(accounts []storage_interface.Account, transfer storage_interface.Transfer) entry {
+	to, _ := findAccountByID(accounts, transfer.ToAccountID)
+	from, fromAccount := findAccountByID(accounts, transfer.FromAccountID)
+	fromName, fromCurrency := Income, currencyCode(to.Currency)
+	if fromAccount {
+		fromName, fromCurrency = mapping.userAccount(from), currencyCode(from.Currency)
+	}
+	received := posting{account: mapping.userAccount(to), amount: transfer.Received, currency: currencyCode(to.Currency)}
+	if received.currency != fromCurrency {
+		received.cost, received.costCurrency = transfer.Amount, fromCurrency
+	}
+	text := strings.Join(strings.Fields(transfer.Comment), " ")
+	if text == "" {
+		text = "Transfer to " + to.Name
+		if fromAccount {
+			text = "Transfer from " + from.Name + " to " + to.Name
+		}
+	}
+	return entry{
+		date:        transfer.Created,
+		description: text,
+		notes:       [][2]string{{"transfer", strconv.Itoa(transfer.ID)}},
+		postings:    []posting{received, {account: fromName, amount: -transfer.Amount, currency: fromCurrency}},
+	}
+}
+
+func description(event storage_interface.MoneyEvent) string {
+	text := strings.Join(strings.Fields(event.Comment), " ")
+	if text == "" {
+		text = event.Tag
+	}
+	return text
+}
+
+func currencyCode(code string) string {
+	if code == "" {
+		return reports.Currency
+	}
+	return strings.ToUpper(code)
+}
+
+func writeLedgerTransaction(builder *strings.Builder, format string, transaction entry) {
+	dateLayout := "2006/01/02"
+	if format == FormatHledger {
+		dateLayout = time.DateOnly
+	}
+	// ";" starts a comment in the journal, so it can't stay in the description
+	fmt.Fprintf(builder, "%s * %s\n", transaction.date.Format(dateLayout), strings.ReplaceAll(transaction.description, ";", ","))
+	for _, note := range transaction.notes {
+		fmt.Fprintf(builder, "    ; %s: %s\n", note[0], note[1])
+	}
+	for i, posting := range transaction.postings {
+		// the last posting of a transaction in one currency takes the rest
+		if i == len(transaction.postings)-1 && posting.cost == 0 && transaction.postings[0].cost == 0 {
+			fmt.Fprintf(builder, "    %s\n", posting.account)
+			continue
+		}
+		fmt.Fprintf(builder, "    %-40s  %s\n", posting.account, posting.amountText())
+	}
+	builder.WriteString("\n")
+}
+
+// amountText is the amount with its currency and the total cost when there is one, like "100.00 USD @@ 120000.00 ARS"
+func (posting posting) amountText() string {
+	text := fmt.Sprintf("%.2f %s", posting.amount, posting.currency)
+	if posting.costCurrency != "" {
+		text += fmt.Sprintf(" @@ %.2f %s", posting.cost, posting.costCurrency)
+	}
+	return text
+}
+
+// writeBeancountOpenings opens every account used by the transactions, beancount doesn't allow accounts without it
+func writeBeancountOpenings(builder *strings.Builder, entries []entry) {
+	accounts := make(map[string]bool)
+	for _, transaction := range entries {
+		for _, posting := range transaction.postings {
+			accounts[posting.account] = true
+		}
+	}
+	var sorted []string
+	for account := range accounts {
+		sorted = append(sorted, account)
+	}
+	sort.Strings(sorted)
+	for _, account := range sorted {
+		fmt.Fprintf(builder, "%s open %s\n", openDate, account)
+	}
+	builder.WriteString("\n")
+}
+
+func writeBeancountTransaction(builder *strings.Builder, transaction entry) {
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace
+	fmt.Fprintf(builder, "%s * \"%s\"\n", transaction.date.Format(time.DateOnly), quote(transaction.description))
+	for _, note := range transaction.notes {
+		fmt.Fprintf(builder, "  %s: \"%s\"\n", note[0], quote(note[1]))
+	}
+	for _, posting := range transaction.postings {
+		fmt.Fprintf(builder, "  %-40s  %s\n", posting.account, posting.amountText())
+	}
+	builder.WriteString("\n")
+}
+
+// Export writes the journal of the user's events and transfers in [start, end) with the mapping the user saved.
+// Lines of overrides are applied over the saved mapping
+func Export(storage storage_interface.ActualStorage, userID int64, format string, start, end time.Time, overrides string) ([]byte, error) {
+	savedMapping, err := storage.GetLedgerMapping(userID)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := ParseMapping(savedMapping)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing saved mapping: %v", err)
+	}
+	if err = mapping.Update(overrides); err != nil {
+		return nil, fmt.Errorf("error parsing mapping: %v", err)
+	}
+	events, err := storage.GetMoneyEventsByDateInterval(start, end, userID)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := storage.GetTransfersByDateInterval(start, end, userID)
+	if err != nil {
+		return nil, err
+	}
+	accounts, err := storage.GetAccounts(userID)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := storage.GetTags(userID)
+	if err != nil {
+		return nil, err
+	}
+	records := Records{Events: events, Transfers: transfers, Accounts: accounts, Tags: tags, Start: start, End: end}
+	return Write(format, records, mapping)
+}
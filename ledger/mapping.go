@@ -0,0 +1,201 @@
+// Package ledger writes money events as journals of plain-text accounting tools: ledger, hledger and beancount
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+)
+
+const (
+	// ExpensesRoot is the account tags go to by default, like Expenses:Food
+	ExpensesRoot = "Expenses"
+	// DefaultFunding is the account the money of expenses paid before user added accounts comes from unless the
+	// mapping tells another one
+	DefaultFunding = "Assets:Cash"
+	// Uncategorized is the account of expenses without a tag
+	Uncategorized = "Uncategorized"
+	// AssetsRoot and LiabilitiesRoot keep accounts of the user by their kinds, like Assets:Bank:Galicia and
+	// Liabilities:Card:Visa
+	AssetsRoot      = "Assets"
+	LiabilitiesRoot = "Liabilities"
+	// Income is where money of transfers coming from outside, like a salary, comes from
+	Income = "Income:Outside"
+	// OpeningBalances gives accounts the money they had when they were added
+	OpeningBalances = "Equity:Opening-Balances"
+	// accountMark starts the left side of the mapping line which sets the journal account of user's account:
+	// "@visa = Liabilities:Visa"
+	accountMark = "@"
+	// fundingKey is the left side of the mapping line which sets the funding account: "* = Assets:Bank"
+	fundingKey      = "*"
+	mappingSplitter = "="
+)
+
+// Mapping tells which account every tag goes to. Tags missing in it go to Expenses:<Tag> with parents
+// in between, like Expenses:Food:Delivery. User's accounts are kept with the mark, like "@visa"
+type Mapping struct {
+	Accounts map[string]string
+	Funding  string
+}
+
+// ParseMapping reads lines like "Food = Expenses:Groceries". The line "* = Assets:Bank" sets the funding account
+// of expenses paid before user added accounts, a line like "@visa = Liabilities:Visa" sets the journal account
+// of user's account. A line with an empty account removes the tag from the mapping
+func ParseMapping(text string) (Mapping, error) {
+	mapping := Mapping{Accounts: make(map[string]string)}
+	err := mapping.Update(text)
+	return mapping, err
+}
+
+// Update applies lines of the mapping text over the current mapping
+func (mapping *Mapping) Update(text string) error {
+	if mapping.Accounts == nil {
+		mapping.Accounts = make(map[string]string)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tag, account, found := strings.Cut(line, mappingSplitter)
+		if !found {
+			return fmt.Errorf("line '%s' is not like 'Tag = Account'", line)
+		}
+		tag, account = strings.TrimSpace(tag), strings.TrimSpace(account)
+		if tag == "" {
+			return fmt.Errorf("line '%s' has no tag", line)
+		}
+		if account != "" && !validAccount(account) {
+			return fmt.Errorf("account '%s' is not like Expenses:Food", account)
+		}
+		if strings.HasPrefix(tag, accountMark) {
+			tag = strings.ToLower(tag)
+		}
+		switch {
+		case tag == fundingKey:
+			mapping.Funding = account
+		case account == "":
+			delete(mapping.Accounts, tag)
+		default:
+			mapping.Accounts[tag] = account
+		}
+	}
+	return nil
+}
+
+// String gives the mapping back as lines [ParseMapping] understands, sorted by tag
+func (mapping Mapping) String() string {
+	var lines []string
+	if mapping.Funding != "" {
+		lines = append(lines, fundingKey+" "+mappingSplitter+" "+mapping.Funding)
+	}
+	var tags []string
+	for tag := range mapping.Accounts {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		lines = append(lines, tag+" "+mappingSplitter+" "+mapping.Accounts[tag])
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (mapping Mapping) funding() string {
+	if mapping.Funding != "" {
+		return mapping.Funding
+	}
+	return DefaultFunding
+}
+
+// paidFrom is the journal account the money of the event comes from: the user's account of the event or the main
+// account for events which don't name one, like balances count them. Events made before the account was added
+// come from the funding account
+func (mapping Mapping) paidFrom(accounts []storage_interface.Account, event storage_interface.MoneyEvent) string {
+	accountID := event.AccountID
+	if accountID == 0 {
+		main, _ := reports.MainAccount(accounts)
+		accountID = main.ID
+	}
+	account, found := findAccountByID(accounts, accountID)
+	if !found || event.Created.Before(account.Created) {
+		return mapping.funding()
+	}
+	return mapping.userAccount(account)
+}
+
+// userAccount is the journal account of the user's account: Liabilities:Card:<Name> for cards and
+// Assets:<Kind>:<Name> for the others
+func (mapping Mapping) userAccount(account storage_interface.Account) string {
+	if mapped, ok := mapping.Accounts[accountMark+strings.ToLower(account.Name)]; ok {
+		return mapped
+	}
+	root := AssetsRoot
+	if account.Kind == storage_interface.AccountCard {
+		root = LiabilitiesRoot
+	}
+	return root + ":" + accountPart(account.Kind) + ":" + accountPart(account.Name)
+}
+
+func findAccountByID(accounts []storage_interface.Account, id int) (storage_interface.Account, bool) {
+	for _, account := range accounts {
+		if account.ID == id {
+			return account, true
+		}
+	}
+	return storage_interface.Account{}, false
+}
+
+// Account is where expenses of the tag go
+func (mapping Mapping) Account(tags []storage_interface.Tag, tag string) string {
+	if account, ok := mapping.Accounts[tag]; ok {
+		return account
+	}
+	if tag == "" {
+		return ExpensesRoot + ":" + Uncategorized
+	}
+	path := []string{accountPart(tag)}
+	current, ok := storage_interface.FindTag(tags, tag)
+	for depth := 0; ok && depth < len(tags); depth++ {
+		parent, found := storage_interface.FindTagByID(tags, current.ParentID)
+		if !found || parent.ID == current.ID {
+			break
+		}
+		path = append([]string{accountPart(parent.Name)}, path...)
+		current = parent
+	}
+	return ExpensesRoot + ":" + strings.Join(path, ":")
+}
+
+// accountPart makes a valid part of an account name of the tag: it starts with a capital letter or a digit
+// and has only letters, digits and dashes
+func accountPart(name string) string {
+	var result []rune
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' {
+			result = append(result, r)
+		} else {
+			result = append(result, '-')
+		}
+	}
+	if len(result) == 0 {
+		return Uncategorized
+	}
+	if !unicode.IsLetter(result[0]) && !unicode.IsDigit(result[0]) {
+		result = append([]rune("X"), result...)
+	}
+	result[0] = unicode.ToUpper(result[0])
+	return string(result)
+}
+
+func validAccount(account string) bool {
+	for _, part := range strings.Split(account, ":") {
+		if part == "" || accountPart(part) != part {
+			return false
+		}
+	}
+	return true
+}
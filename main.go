@@ -2,14 +2,28 @@ package main
 
 import (
 	"fmt"
+	"ingresos_gastos/blobs"
+	"ingresos_gastos/categorization"
+	"ingresos_gastos/cli"
 	"ingresos_gastos/config"
 	"ingresos_gastos/db"
 	"ingresos_gastos/speaking"
+	"ingresos_gastos/statement"
 	telegram "ingresos_gastos/telegram_bot_adapter"
 	"log"
 	"net/http"
+	"os"
+	"time"
 )
 
+// runCommand does one job from the command line, like exporting a journal, instead of running the bot
+func runCommand(args []string) {
+	storage := db.NewPostgresAdapter(config.GetConfigFromEnv())
+	if err := cli.Run(args, storage, os.Stdout); err != nil {
+		log.Fatalf("Failed to run %s: %v", args[0], err)
+	}
+}
+
 func healthCheckHandler(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, err := w.Write([]byte("OK"))
@@ -20,6 +34,10 @@ func healthCheckHandler(w http.ResponseWriter, _ *http.Request) {
 
 // t@Gastos_Ingresos_bot
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
 	http.HandleFunc("/health", healthCheckHandler)
 
 	// Start the HTTP server on port 8080
@@ -33,12 +51,30 @@ func main() {
 	fmt.Println(cfg)
 	// Initialize the database
 	storage := db.NewPostgresAdapter(cfg)
+	if err := storage.NormalizeTagNames(); err != nil {
+		log.Printf("Failed to normalize tag names: %v", err)
+	}
 	bot, err := telegram.NewBotAdapter(cfg, storage)
 	if err != nil {
 		log.Fatalf("Failed to init Telegram Bot: %v", err)
 	}
 
-	env := speaking.MessagingPlatform{Storage: storage, Bot: bot}
+	blobStore := cfg.BlobStore
+	if blobStore == "" {
+		blobStore = "attachments"
+	}
+	store, err := blobs.Open(blobStore)
+	if err != nil {
+		log.Fatalf("Failed to open storage of attachments: %v", err)
+	}
+
+	links := statement.Links{BaseURL: cfg.PublicURL, Secret: []byte(cfg.CallbackSecret)}
+	http.HandleFunc(statement.DownloadPath, links.Handler(storage))
+
+	// models of tag suggestions are learned again every day to forget expenses older than a year
+	suggestions := categorization.NewModels(24 * time.Hour)
+	env := speaking.MessagingPlatform{Storage: storage, Bot: bot, Statements: links, Blobs: store, Suggestions: suggestions}
+	env.ScheduleMonthlyStatements()
 	env.ListenToCommands()
 	env.ListenToUserInput()
 	env.ListenToInlineActions()
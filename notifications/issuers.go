@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Parts of patterns. merchant ends before a day or lowercase words like "el" or "con" which start the date or the card,
+// so capitalized words like in "Kiosco El Sol" stay in the merchant
+const (
+	amountPart   = `(?P<currency>U\$S|US\$|USD|ARS|\$)\s*(?P<amount>[\d.,]*\d)`
+	merchantPart = `(?P<merchant>[^.,;\n]+?)`
+	merchantEnd  = `(?:(?-i:\s+(?:el|con|desde|mediante|fue|a las)\b)|\s+(?:el\s+)?\d{1,2}/\d{1,2}|[.,;]|$)`
+)
+
+// pattern builds an expression from a template where {amount} and {merchant} are the parts above. It ignores case
+func pattern(template string) *regexp.Regexp {
+	expression := strings.NewReplacer(
+		"{amount}", amountPart,
+		"{merchant}", merchantPart+merchantEnd,
+	).Replace(template)
+	return regexp.MustCompile("(?i)" + expression)
+}
+
+func init() {
+	Register(PatternParser{
+		Name:    "Galicia",
+		Keyword: regexp.MustCompile(`(?i)galicia`),
+		Patterns: []*regexp.Regexp{
+			pattern(`(?:compra|consumo)\b.*?\bpor\s+{amount}\s+en\s+{merchant}`),
+		},
+	})
+	Register(PatternParser{
+		Name:    "Santander",
+		Keyword: regexp.MustCompile(`(?i)santander`),
+		Patterns: []*regexp.Regexp{
+			pattern(`compra\s+(?:de|por)\s+{amount}\s+en\s+{merchant}`),
+		},
+	})
+	Register(PatternParser{
+		Name:    "BBVA",
+		Keyword: regexp.MustCompile(`(?i)bbva|franc[eé]s`),
+		Patterns: []*regexp.Regexp{
+			pattern(`compra\b.*?\bpor\s+{amount}\s+en\s+{merchant}`),
+		},
+	})
+	Register(PatternParser{
+		Name:    "Naranja X",
+		Keyword: regexp.MustCompile(`(?i)naranja`),
+		Patterns: []*regexp.Regexp{
+			pattern(`(?:compra|consumo)\b.*?\b(?:de|por)\s+{amount}\s+en\s+{merchant}`),
+		},
+	})
+	Register(PatternParser{
+		Name:    "Ualá",
+		Keyword: regexp.MustCompile(`(?i)ual[aá]`),
+		Patterns: []*regexp.Regexp{
+			pattern(`compraste\s+{amount}\s+en\s+{merchant}`),
+		},
+	})
+	Register(PatternParser{
+		Name:    "Brubank",
+		Keyword: regexp.MustCompile(`(?i)brubank`),
+		Patterns: []*regexp.Regexp{
+			pattern(`gastaste\s+{amount}\s+en\s+{merchant}`),
+		},
+	})
+	// Mercado Pago doesn't tell its name in notifications, they are known by their words
+	Register(PatternParser{
+		Name: "Mercado Pago",
+		Patterns: []*regexp.Regexp{
+			pattern(`(?:le\s+)?pagaste\s+{amount}\s+(?:a|en)\s+{merchant}`),
+			pattern(`tu\s+pago\s+de\s+{amount}\s+(?:a|en)\s+{merchant}`),
+			pattern(`enviaste\s+{amount}\s+a\s+{merchant}`),
+			pattern(`compraste\s+{amount}\s+en\s+{merchant}`),
+		},
+	})
+}
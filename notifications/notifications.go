@@ -0,0 +1,128 @@
+// Package notifications reads payments from texts banks and payment apps send, like SMS of a bank
+// or a push notification of Mercado Pago forwarded to the bot
+package notifications
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"ingresos_gastos/importing"
+)
+
+const defaultCurrency = "ARS"
+
+// Notification is a payment a bank or an app told about. Date is zero when the text doesn't tell it
+type Notification struct {
+	Issuer   string
+	Amount   float32
+	Currency string
+	Merchant string
+	Date     time.Time
+}
+
+// Parser reads notifications of one issuer
+type Parser interface {
+	Issuer() string
+	Parse(text string, now time.Time) (Notification, bool)
+}
+
+var parsers []Parser
+
+// Register adds the parser to the ones [Parse] tries, parsers registered first are tried first
+func Register(parser Parser) {
+	parsers = append(parsers, parser)
+}
+
+// Parse tries all the registered parsers on the text and gives the first notification found
+func Parse(text string, now time.Time) (Notification, bool) {
+	text = strings.Join(strings.Fields(text), " ")
+	for _, parser := range parsers {
+		if notification, ok := parser.Parse(text, now); ok {
+			return notification, true
+		}
+	}
+	return Notification{}, false
+}
+
+// dateInText is a day anywhere in the notification, like "el 01/03/2024"
+var dateInText = regexp.MustCompile(`\b\d{1,2}/\d{1,2}(?:/\d{2,4})?\b`)
+
+// PatternParser is a [Parser] made of regular expressions. They have named groups amount and merchant
+// and optional groups currency and date, when there is no date group the first day in the text is taken.
+// Keyword, when it is set, must be in the text, usually it is the name of the bank
+type PatternParser struct {
+	Name     string
+	Keyword  *regexp.Regexp
+	Patterns []*regexp.Regexp
+}
+
+func (parser PatternParser) Issuer() string {
+	return parser.Name
+}
+
+func (parser PatternParser) Parse(text string, now time.Time) (Notification, bool) {
+	if parser.Keyword != nil && !parser.Keyword.MatchString(text) {
+		return Notification{}, false
+	}
+	for _, pattern := range parser.Patterns {
+		match := pattern.FindStringSubmatch(text)
+		if match == nil {
+			continue
+		}
+		groups := make(map[string]string)
+		for i, name := range pattern.SubexpNames() {
+			if name != "" {
+				groups[name] = strings.TrimSpace(match[i])
+			}
+		}
+		if groups["date"] == "" {
+			groups["date"] = dateInText.FindString(text)
+		}
+		amount, err := importing.ParseAmount(groups["amount"])
+		if err != nil || amount <= 0 || groups["merchant"] == "" {
+			continue
+		}
+		return Notification{
+			Issuer:   parser.Name,
+			Amount:   amount,
+			Currency: currency(groups["currency"]),
+			Merchant: groups["merchant"],
+			Date:     date(groups["date"], now),
+		}, true
+	}
+	return Notification{}, false
+}
+
+// currency turns signs of notifications into currency codes: "U$S" is dollars and "$" is pesos
+func currency(sign string) string {
+	switch strings.ToUpper(strings.ReplaceAll(sign, " ", "")) {
+	case "U$S", "US$", "USD", "U$D":
+		return "USD"
+	case "EUR", "€":
+		return "EUR"
+	}
+	return defaultCurrency
+}
+
+// date reads days like 01/03/2024, 1/3/24 or 01/03. A day without a year is in the past year when it is after now
+func date(text string, now time.Time) time.Time {
+	if text == "" {
+		return time.Time{}
+	}
+	for _, layout := range []string{"02/01/2006", "2/1/2006", "02/01/06", "2/1/06"} {
+		if day, err := time.ParseInLocation(layout, text, now.Location()); err == nil {
+			return day
+		}
+	}
+	for _, layout := range []string{"02/01", "2/1"} {
+		if day, err := time.ParseInLocation(layout, text, now.Location()); err == nil {
+			day = day.AddDate(now.Year(), 0, 0)
+			if day.After(now) {
+				day = day.AddDate(-1, 0, 0)
+			}
+			return day
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,142 @@
+// Package pdf writes simple A4 documents of text, lines and gray boxes with the standard Helvetica fonts,
+// which every PDF reader has, so no font files are embedded
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+const (
+	// PageWidth and PageHeight are A4 in points. Coordinates start at the bottom left corner of a page
+	PageWidth  = 595.0
+	PageHeight = 842.0
+)
+
+// helveticaWidths are widths of Helvetica glyphs in thousandths of the font size, others are taken as defaultWidth
+var helveticaWidths = map[rune]float64{
+	' ': 278, '.': 278, ',': 278, ':': 278, '-': 333, '(': 333, ')': 333, '/': 278, '%': 889, '\'': 191,
+	'0': 556, '1': 556, '2': 556, '3': 556, '4': 556, '5': 556, '6': 556, '7': 556, '8': 556, '9': 556,
+	'i': 222, 'j': 222, 'l': 222, 'f': 278, 't': 278, 'r': 333, 'm': 833, 'w': 722, 'I': 278, 'M': 833, 'W': 944,
+}
+
+const defaultWidth = 556
+
+// Document is a PDF being written page by page. It always has at least one page
+type Document struct {
+	pages []*bytes.Buffer
+}
+
+func New() *Document {
+	document := &Document{}
+	document.AddPage()
+	return document
+}
+
+// AddPage starts a new page, everything is drawn on the last page
+func (document *Document) AddPage() {
+	document.pages = append(document.pages, &bytes.Buffer{})
+}
+
+func (document *Document) page() *bytes.Buffer {
+	return document.pages[len(document.pages)-1]
+}
+
+// Text writes the text with its baseline starting at x, y
+func (document *Document) Text(x, y, size float64, bold bool, text string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(document.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, escape(text))
+}
+
+// TextRight writes the text ending at x, like amounts in a column
+func (document *Document) TextRight(x, y, size float64, bold bool, text string) {
+	document.Text(x-TextWidth(text, size), y, size, bold, text)
+}
+
+// Line draws a thin black line
+func (document *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(document.page(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// Box fills a rectangle with the gray level from 0 (black) to 1 (white)
+func (document *Document) Box(x, y, width, height, gray float64) {
+	fmt.Fprintf(document.page(), "q %.2f g %.2f %.2f %.2f %.2f re f Q\n", gray, x, y, width, height)
+}
+
+// TextWidth estimates the width of the text in points
+func TextWidth(text string, size float64) float64 {
+	var width float64
+	for _, r := range text {
+		if glyphWidth, ok := helveticaWidths[r]; ok {
+			width += glyphWidth
+		} else {
+			width += defaultWidth
+		}
+	}
+	return width * size / 1000
+}
+
+// Fit cuts the text to fit the width in points
+func Fit(text string, size, width float64) string {
+	runes := []rune(text)
+	for len(runes) > 0 && TextWidth(string(runes), size) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes)
+}
+
+// escape turns the text to WinAnsi bytes of a PDF string. Runes out of Latin-1 become "?"
+func escape(text string) string {
+	var result strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			result.WriteByte('\\')
+			result.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			result.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&result, "\\%03o", r)
+		default:
+			result.WriteByte('?')
+		}
+	}
+	return result.String()
+}
+
+// Bytes is the whole document in PDF format
+func (document *Document) Bytes() []byte {
+	var output bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, output.Len())
+		fmt.Fprintf(&output, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	output.WriteString("%PDF-1.4\n")
+	// objects 1-4 are the catalog, the page tree and the fonts, then every page takes two objects: itself and its content
+	pageObject := func(i int) int { return 5 + 2*i }
+	var kids []string
+	for i := range document.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObject(i)))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(document.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range document.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, pageObject(i)+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+	xref := output.Len()
+	fmt.Fprintf(&output, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&output, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&output, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return output.Bytes()
+}
@@ -0,0 +1,131 @@
+package qr
+
+import (
+	"image"
+	"image/color"
+)
+
+// bitmap is an image turned into dark and light pixels
+type bitmap struct {
+	width, height int
+	dark          []bool
+}
+
+func (picture *bitmap) at(x, y int) bool {
+	if x < 0 || y < 0 || x >= picture.width || y >= picture.height {
+		return false
+	}
+	return picture.dark[y*picture.width+x]
+}
+
+// luminance is the brightness of every pixel of the image from top to bottom
+func luminance(img image.Image) (values []uint8, width, height int) {
+	bounds := img.Bounds()
+	width, height = bounds.Dx(), bounds.Dy()
+	values = make([]uint8, width*height)
+	if ycbcr, ok := img.(*image.YCbCr); ok {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				values[y*width+x] = ycbcr.Y[ycbcr.YOffset(bounds.Min.X+x, bounds.Min.Y+y)]
+			}
+		}
+		return values, width, height
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			values[y*width+x] = color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray).Y
+		}
+	}
+	return values, width, height
+}
+
+// blockSize is the side of squares the local threshold is counted in
+const blockSize = 8
+
+// minContrast is the smallest difference of brightness around a block which is taken as a drawing,
+// smaller differences are noise of paper or of the camera
+const minContrast = 48
+
+// localThreshold compares every pixel with the average of 5x5 blocks around it, so shadows and uneven
+// light of photos don't hide a part of the code. Where blocks around are of one tone, like paper or the
+// middle of a big dark square, the threshold of the whole image is used
+func localThreshold(values []uint8, width, height int) *bitmap {
+	global := otsu(values)
+	columns, rows := (width+blockSize-1)/blockSize, (height+blockSize-1)/blockSize
+	averages, lows, highs := make([]int, columns*rows), make([]int, columns*rows), make([]int, columns*rows)
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			sum, count, lowest, highest := 0, 0, 255, 0
+			for y := row * blockSize; y < min((row+1)*blockSize, height); y++ {
+				for x := column * blockSize; x < min((column+1)*blockSize, width); x++ {
+					value := int(values[y*width+x])
+					sum += value
+					count++
+					lowest, highest = min(lowest, value), max(highest, value)
+				}
+			}
+			i := row*columns + column
+			averages[i], lows[i], highs[i] = sum/count, lowest, highest
+		}
+	}
+	picture := &bitmap{width: width, height: height, dark: make([]bool, width*height)}
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			sum, lowest, highest := 0, 255, 0
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					i := min(max(row+dy, 0), rows-1)*columns + min(max(column+dx, 0), columns-1)
+					sum += averages[i]
+					lowest, highest = min(lowest, lows[i]), max(highest, highs[i])
+				}
+			}
+			threshold := sum / 25
+			if highest-lowest < minContrast {
+				threshold = global
+			}
+			for y := row * blockSize; y < min((row+1)*blockSize, height); y++ {
+				for x := column * blockSize; x < min((column+1)*blockSize, width); x++ {
+					picture.dark[y*width+x] = int(values[y*width+x]) <= threshold
+				}
+			}
+		}
+	}
+	return picture
+}
+
+// globalThreshold splits pixels into dark and light by one threshold for the whole image
+func globalThreshold(values []uint8, width, height int) *bitmap {
+	threshold := otsu(values)
+	picture := &bitmap{width: width, height: height, dark: make([]bool, width*height)}
+	for i, value := range values {
+		picture.dark[i] = int(value) <= threshold
+	}
+	return picture
+}
+
+// otsu chooses the threshold which splits brightness values into two groups most distant from each other
+func otsu(values []uint8) int {
+	var histogram [256]int
+	total := 0
+	for _, value := range values {
+		histogram[value]++
+		total += int(value)
+	}
+	threshold, best := 0, 0.0
+	darkCount, darkSum := 0, 0
+	for t := 0; t < 256; t++ {
+		darkCount += histogram[t]
+		darkSum += t * histogram[t]
+		lightCount := len(values) - darkCount
+		if darkCount == 0 || lightCount == 0 {
+			continue
+		}
+		darkMean := float64(darkSum) / float64(darkCount)
+		lightMean := float64(total-darkSum) / float64(lightCount)
+		variance := float64(darkCount) * float64(lightCount) * (darkMean - lightMean) * (darkMean - lightMean)
+		if variance > best {
+			threshold, best = t, variance
+		}
+	}
+	return threshold
+}
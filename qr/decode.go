@@ -0,0 +1,384 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	errFormat    = errors.New("format information can't be read")
+	errVersion   = errors.New("version information doesn't match the size")
+	errMode      = errors.New("unsupported data mode")
+	errTruncated = errors.New("data is cut short")
+)
+
+// formatMask is xored with format bits so they are never all light
+const formatMask = 0x5412
+
+// modules are light or dark cells of a code indexed by row and column, dark is true
+type modules [][]bool
+
+// formatCode is the format bits of level and mask with their BCH code
+func formatCode(data int) int {
+	code := data << 10
+	for i := 14; i >= 10; i-- {
+		if code&(1<<i) != 0 {
+			code ^= 0x537 << (i - 10)
+		}
+	}
+	return (data<<10 | code) ^ formatMask
+}
+
+// format reads error correction level and mask from both copies of format bits, allowing up to 3 wrong bits
+func (grid modules) format() (levelIndex int, mask int, err error) {
+	size := len(grid)
+	first, second := 0, 0
+	for i := 0; i < 15; i++ {
+		var row, column int
+		switch {
+		case i < 6:
+			row, column = i, 8
+		case i < 8:
+			row, column = i+1, 8
+		case i < 9:
+			row, column = 8, 7
+		default:
+			row, column = 8, 14-i
+		}
+		if grid[row][column] {
+			first |= 1 << i
+		}
+		if i < 8 {
+			row, column = 8, size-1-i
+		} else {
+			row, column = size-15+i, 8
+		}
+		if grid[row][column] {
+			second |= 1 << i
+		}
+	}
+	best, bestDistance := -1, 4
+	for data := 0; data < 32; data++ {
+		code := formatCode(data)
+		distance := min(bits.OnesCount(uint(code^first)), bits.OnesCount(uint(code^second)))
+		if distance < bestDistance {
+			best, bestDistance = data, distance
+		}
+	}
+	if best < 0 {
+		return 0, 0, errFormat
+	}
+	return best>>3 ^ 1, best & 7, nil
+}
+
+// version is the number of the code by its size, big codes must have version bits telling the same
+func (grid modules) version() (int, error) {
+	size := len(grid)
+	number := (size - 17) / 4
+	if number < 1 || number > 40 || size != 17+4*number {
+		return 0, errVersion
+	}
+	if number < 7 {
+		return number, nil
+	}
+	first, second := 0, 0
+	for i := 0; i < 18; i++ {
+		x, y := i/3, size-11+i%3
+		if grid[y][x] {
+			first |= 1 << i
+		}
+		if grid[x][y] {
+			second |= 1 << i
+		}
+	}
+	for _, candidate := range []int{number - 1, number, number + 1} {
+		if candidate < 7 || candidate > 40 {
+			continue
+		}
+		code := versions[candidate].versionBits
+		if bits.OnesCount(uint(code^first)) <= 3 || bits.OnesCount(uint(code^second)) <= 3 {
+			if candidate != number {
+				return 0, errVersion
+			}
+			return number, nil
+		}
+	}
+	return 0, errVersion
+}
+
+// isFunction tells if the module is a part of patterns, timing or format and version bits rather than data
+func isFunction(number int, row, column int) bool {
+	size := 17 + 4*number
+	switch {
+	case row < 9 && column < 9, row < 9 && column >= size-8, row >= size-8 && column < 9:
+		return true
+	case row == 6 || column == 6:
+		return true
+	case number >= 7 && row < 6 && column >= size-11 && column < size-8:
+		return true
+	case number >= 7 && column < 6 && row >= size-11 && row < size-8:
+		return true
+	}
+	centers := alignmentCenters(number)
+	for _, y := range centers {
+		for _, x := range centers {
+			if (x == 6 && y == 6) || (x == 6 && y == size-7) || (x == size-7 && y == 6) {
+				continue
+			}
+			if row >= y-2 && row <= y+2 && column >= x-2 && column <= x+2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// masked tells if the mask flips the module
+func masked(mask, row, column int) bool {
+	switch mask {
+	case 0:
+		return (row+column)%2 == 0
+	case 1:
+		return row%2 == 0
+	case 2:
+		return column%3 == 0
+	case 3:
+		return (row+column)%3 == 0
+	case 4:
+		return (row/2+column/3)%2 == 0
+	case 5:
+		return row*column%2+row*column%3 == 0
+	case 6:
+		return (row*column%2+row*column%3)%2 == 0
+	default:
+		return ((row+column)%2+row*column%3)%2 == 0
+	}
+}
+
+// codewords reads data modules in pairs of columns going up and down from the bottom right corner
+func (grid modules) codewords(number, mask int) []byte {
+	size := len(grid)
+	result := make([]byte, 0, versions[number].codewords)
+	var current byte
+	count := 0
+	up := true
+	for column := size - 1; column > 0; column -= 2 {
+		if column == 6 {
+			column--
+		}
+		for i := 0; i < size; i++ {
+			row := i
+			if up {
+				row = size - 1 - i
+			}
+			for _, x := range []int{column, column - 1} {
+				if isFunction(number, row, x) {
+					continue
+				}
+				current <<= 1
+				if grid[row][x] != masked(mask, row, x) {
+					current |= 1
+				}
+				count++
+				if count == 8 {
+					if len(result) < cap(result) {
+						result = append(result, current)
+					}
+					current, count = 0, 0
+				}
+			}
+		}
+		up = !up
+	}
+	return result
+}
+
+// decode reads the text of the sampled code
+func (grid modules) decode() (string, error) {
+	levelIndex, mask, err := grid.format()
+	if err != nil {
+		return "", err
+	}
+	number, err := grid.version()
+	if err != nil {
+		return "", err
+	}
+	data, err := deinterleave(grid.codewords(number, mask), number, levelIndex)
+	if err != nil {
+		return "", err
+	}
+	return readSegments(data, number)
+}
+
+// deinterleave splits codewords into blocks, corrects every block and joins their data. The last blocks
+// may have a data byte more than the first ones
+func deinterleave(codewords []byte, number, levelIndex int) ([]byte, error) {
+	info := versions[number]
+	if len(codewords) != info.codewords {
+		return nil, errTruncated
+	}
+	count, check := info.levels[levelIndex].blocks, info.levels[levelIndex].checkBytes
+	dataBytes := info.codewords - count*check
+	short, longer := dataBytes/count, dataBytes%count
+	blocks := make([][]byte, count)
+	for i := range blocks {
+		length := short
+		if i >= count-longer {
+			length++
+		}
+		blocks[i] = make([]byte, 0, length+check)
+	}
+	next := 0
+	for i := 0; i <= short; i++ {
+		for b := range blocks {
+			if i < short || b >= count-longer {
+				blocks[b] = append(blocks[b], codewords[next])
+				next++
+			}
+		}
+	}
+	for i := 0; i < check; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[next])
+			next++
+		}
+	}
+	data := make([]byte, 0, dataBytes)
+	for _, block := range blocks {
+		if err := correct(block, check); err != nil {
+			return nil, err
+		}
+		data = append(data, block[:len(block)-check]...)
+	}
+	return data, nil
+}
+
+// bitReader reads numbers of a few bits from bytes
+type bitReader struct {
+	data     []byte
+	position int
+}
+
+func (reader *bitReader) available() int {
+	return len(reader.data)*8 - reader.position
+}
+
+func (reader *bitReader) read(count int) (int, error) {
+	if count > reader.available() {
+		return 0, errTruncated
+	}
+	value := 0
+	for i := 0; i < count; i++ {
+		bit := reader.data[reader.position/8] >> (7 - reader.position%8) & 1
+		value = value<<1 | int(bit)
+		reader.position++
+	}
+	return value, nil
+}
+
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// readSegments reads numeric, alphanumeric and byte segments until the terminator. ECI designators are skipped
+// and bytes are read as UTF-8 or, when they aren't valid UTF-8, as Latin-1
+func readSegments(data []byte, number int) (string, error) {
+	reader := &bitReader{data: data}
+	sizeIndex := 0
+	if number >= 27 {
+		sizeIndex = 2
+	} else if number >= 10 {
+		sizeIndex = 1
+	}
+	var text strings.Builder
+	for reader.available() >= 4 {
+		mode, _ := reader.read(4)
+		switch mode {
+		case 0:
+			return text.String(), nil
+		case 1:
+			length, err := reader.read([]int{10, 12, 14}[sizeIndex])
+			if err != nil {
+				return "", err
+			}
+			for ; length > 0; length -= 3 {
+				digits := min(length, 3)
+				value, err := reader.read([]int{0, 4, 7, 10}[digits])
+				if err != nil {
+					return "", err
+				}
+				if value >= []int{0, 10, 100, 1000}[digits] {
+					return "", errTruncated
+				}
+				fmt.Fprintf(&text, "%0*d", digits, value)
+			}
+		case 2:
+			length, err := reader.read([]int{9, 11, 13}[sizeIndex])
+			if err != nil {
+				return "", err
+			}
+			for ; length > 1; length -= 2 {
+				value, err := reader.read(11)
+				if err != nil || value >= 45*45 {
+					return "", errTruncated
+				}
+				text.WriteByte(alphanumeric[value/45])
+				text.WriteByte(alphanumeric[value%45])
+			}
+			if length == 1 {
+				value, err := reader.read(6)
+				if err != nil || value >= 45 {
+					return "", errTruncated
+				}
+				text.WriteByte(alphanumeric[value])
+			}
+		case 4:
+			length, err := reader.read([]int{8, 16, 16}[sizeIndex])
+			if err != nil {
+				return "", err
+			}
+			segment := make([]byte, length)
+			for i := range segment {
+				value, err := reader.read(8)
+				if err != nil {
+					return "", err
+				}
+				segment[i] = byte(value)
+			}
+			if utf8.Valid(segment) {
+				text.Write(segment)
+			} else {
+				for _, b := range segment {
+					text.WriteRune(rune(b))
+				}
+			}
+		case 7:
+			first, err := reader.read(8)
+			if err != nil {
+				return "", err
+			}
+			if first&0x80 != 0 {
+				extra := 8
+				if first&0xc0 == 0xc0 {
+					extra = 16
+				}
+				if _, err = reader.read(extra); err != nil {
+					return "", err
+				}
+			}
+		case 3:
+			if _, err := reader.read(16); err != nil {
+				return "", err
+			}
+		case 5:
+		case 9:
+			if _, err := reader.read(8); err != nil {
+				return "", err
+			}
+		default:
+			return "", errMode
+		}
+	}
+	return text.String(), nil
+}
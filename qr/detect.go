@@ -0,0 +1,448 @@
+package qr
+
+import (
+	"math"
+	"sort"
+)
+
+// point is a place in the image, usually a center of a pattern
+type point struct {
+	x, y float64
+}
+
+func distance(a, b point) float64 {
+	return math.Hypot(a.x-b.x, a.y-b.y)
+}
+
+// finder is a candidate of one of three big squares in corners of a code. moduleSize is the width of a module
+// in pixels and count is how many scanned rows crossed it
+type finder struct {
+	point
+	moduleSize float64
+	count      int
+}
+
+// finderRatio tells if runs of dark, light, dark, light and dark pixels have widths 1:1:3:1:1 of a finder pattern
+func finderRatio(runs [5]int) bool {
+	total := 0
+	for _, run := range runs {
+		if run == 0 {
+			return false
+		}
+		total += run
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	variance := module / 1.5
+	return math.Abs(module-float64(runs[0])) < variance &&
+		math.Abs(module-float64(runs[1])) < variance &&
+		math.Abs(3*module-float64(runs[2])) < 3*variance &&
+		math.Abs(module-float64(runs[3])) < variance &&
+		math.Abs(module-float64(runs[4])) < variance
+}
+
+// crossCheck walks from the center both ways along the direction and measures the runs of a finder pattern.
+// It gives the center of the pattern along the direction and its width, or false when the pattern isn't there
+func crossCheck(picture *bitmap, center point, dx, dy int, maxRun int) (float64, int, bool) {
+	x, y := int(center.x), int(center.y)
+	if !picture.at(x, y) {
+		return 0, 0, false
+	}
+	var runs [5]int
+	step := func(i int) (int, int) {
+		return x + i*dx, y + i*dy
+	}
+	i := 0
+	for state := 2; state >= 0; state-- {
+		dark := state != 1
+		for {
+			px, py := step(i)
+			if px < 0 || py < 0 || px >= picture.width || py >= picture.height || picture.at(px, py) != dark {
+				break
+			}
+			runs[state]++
+			i--
+			if state != 2 && runs[state] > maxRun {
+				return 0, 0, false
+			}
+		}
+	}
+	start := i + 1
+	i = 1
+	for state := 2; state <= 4; state++ {
+		dark := state != 3
+		for {
+			px, py := step(i)
+			if px < 0 || py < 0 || px >= picture.width || py >= picture.height || picture.at(px, py) != dark {
+				break
+			}
+			runs[state]++
+			i++
+			if state != 2 && runs[state] > maxRun {
+				return 0, 0, false
+			}
+		}
+	}
+	if !finderRatio(runs) {
+		return 0, 0, false
+	}
+	total := 0
+	for _, run := range runs {
+		total += run
+	}
+	middle := float64(start+runs[0]+runs[1]) + float64(runs[2])/2
+	return middle, total, true
+}
+
+// findFinders scans rows of the image for 1:1:3:1:1 runs and checks them across. Candidates found
+// near each other are joined
+func findFinders(picture *bitmap) []finder {
+	var found []finder
+	add := func(candidate point, moduleSize float64) {
+		for i := range found {
+			existing := &found[i]
+			if distance(existing.point, candidate) <= existing.moduleSize*2 &&
+				math.Abs(existing.moduleSize-moduleSize) <= math.Max(existing.moduleSize, 1) {
+				n := float64(existing.count)
+				existing.x = (existing.x*n + candidate.x) / (n + 1)
+				existing.y = (existing.y*n + candidate.y) / (n + 1)
+				existing.moduleSize = (existing.moduleSize*n + moduleSize) / (n + 1)
+				existing.count++
+				return
+			}
+		}
+		found = append(found, finder{point: candidate, moduleSize: moduleSize, count: 1})
+	}
+	check := func(runs [5]int, end, y int) {
+		total := 0
+		for _, run := range runs {
+			total += run
+		}
+		center := point{float64(end-runs[4]-runs[3]) - float64(runs[2])/2, float64(y)}
+		offset, height, ok := crossCheck(picture, center, 0, 1, runs[2])
+		if !ok || 5*absInt(height-total) >= 2*total {
+			return
+		}
+		center.y = math.Floor(center.y) + offset
+		offset, width, ok := crossCheck(picture, center, 1, 0, runs[2])
+		if !ok || 5*absInt(width-total) >= 2*total {
+			return
+		}
+		center.x = math.Floor(center.x) + offset
+		// patterns are square, so they are crossed the same way along a diagonal
+		if _, _, ok = crossCheck(picture, center, 1, 1, 2*runs[2]); !ok {
+			return
+		}
+		add(center, float64(width+height)/14)
+	}
+	for y := 0; y < picture.height; y++ {
+		var runs [5]int
+		state := 0
+		for x := 0; x < picture.width; x++ {
+			if picture.at(x, y) {
+				if state%2 == 1 {
+					state++
+				}
+				runs[state]++
+				continue
+			}
+			if state%2 == 1 {
+				runs[state]++
+				continue
+			}
+			if state == 4 {
+				if finderRatio(runs) {
+					check(runs, x, y)
+				}
+				runs = [5]int{runs[2], runs[3], runs[4], 1, 0}
+				state = 3
+				continue
+			}
+			state++
+			runs[state]++
+		}
+		if state == 4 && finderRatio(runs) {
+			check(runs, picture.width, y)
+		}
+	}
+	return found
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// corners are finder patterns of a code ordered as top left, top right and bottom left of the code
+type corners struct {
+	topLeft, topRight, bottomLeft finder
+}
+
+// chooseCorners gives triples of candidates which look like corners of one code, the likeliest first.
+// The top left corner is opposite to the longest side and the others are ordered clockwise
+func chooseCorners(candidates []finder) []corners {
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].count > candidates[j].count
+	})
+	if len(candidates) > 12 {
+		candidates = candidates[:12]
+	}
+	type scored struct {
+		corners
+		score float64
+	}
+	var triples []scored
+	for i := 0; i < len(candidates); i++ {
+		for j := i + 1; j < len(candidates); j++ {
+			for k := j + 1; k < len(candidates); k++ {
+				a, b, c := candidates[i], candidates[j], candidates[k]
+				ab, ac, bc := distance(a.point, b.point), distance(a.point, c.point), distance(b.point, c.point)
+				switch {
+				case ab >= ac && ab >= bc:
+					a, c = c, a
+					ac, bc = bc, ac
+					ab, bc = bc, ab
+				case ac >= ab && ac >= bc:
+					a, b = b, a
+					ac, bc = bc, ac
+				}
+				// now a is the top left corner, bc is the longest side and ab, ac are the sides
+				sizes := []float64{a.moduleSize, b.moduleSize, c.moduleSize}
+				smallest, biggest := math.Min(sizes[0], math.Min(sizes[1], sizes[2])), math.Max(sizes[0], math.Max(sizes[1], sizes[2]))
+				if biggest > 2*smallest || ab < 7*smallest || ac < 7*smallest {
+					continue
+				}
+				sides := math.Abs(ab-ac) / math.Max(ab, ac)
+				right := math.Abs(bc*bc-ab*ab-ac*ac) / (bc * bc)
+				if sides > 0.5 || right > 0.5 {
+					continue
+				}
+				if (b.x-a.x)*(c.y-a.y)-(b.y-a.y)*(c.x-a.x) < 0 {
+					b, c = c, b
+				}
+				triples = append(triples, scored{corners{a, b, c}, sides + right + (biggest-smallest)/smallest})
+			}
+		}
+	}
+	sort.Slice(triples, func(i, j int) bool {
+		return triples[i].score < triples[j].score
+	})
+	result := make([]corners, 0, len(triples))
+	for _, triple := range triples {
+		result = append(result, triple.corners)
+	}
+	return result
+}
+
+// moduleSize measures the width of modules along the sides of the code, between the centers of finder patterns.
+// Widths measured across rows and columns are bigger when the code is turned
+func (found corners) moduleSize(picture *bitmap) float64 {
+	across := (patternWidth(picture, found.topLeft.point, found.topRight.point) + patternWidth(picture, found.topRight.point, found.topLeft.point) +
+		patternWidth(picture, found.topLeft.point, found.bottomLeft.point) + patternWidth(picture, found.bottomLeft.point, found.topLeft.point)) / 4
+	if math.IsNaN(across) {
+		return (found.topLeft.moduleSize + found.topRight.moduleSize + found.bottomLeft.moduleSize) / 3
+	}
+	return across / 7
+}
+
+// patternWidth walks from the center of a finder pattern toward the point and back, crossing its dark center,
+// light ring and dark ring. It gives the width of the pattern, 7 modules, or NaN when the pattern isn't there
+func patternWidth(picture *bitmap, center, toward point) float64 {
+	length := distance(center, toward)
+	dx, dy := (toward.x-center.x)/length, (toward.y-center.y)/length
+	width := 0.0
+	for _, sign := range []float64{1, -1} {
+		state, t := 0, 0.0
+		for ; state < 3 && t < length/2; t += 0.5 {
+			dark := picture.at(int(math.Floor(center.x+sign*t*dx)), int(math.Floor(center.y+sign*t*dy)))
+			if dark != (state != 1) {
+				state++
+			}
+		}
+		if state < 3 {
+			return math.NaN()
+		}
+		width += t - 0.5
+	}
+	return width
+}
+
+// size estimates how many modules are on a side of the code. It is 17 plus a multiple of 4
+func (found corners) size(moduleSize float64) int {
+	across := (distance(found.topLeft.point, found.topRight.point) + distance(found.topLeft.point, found.bottomLeft.point)) / 2
+	size := int(math.Round(across/moduleSize)) + 7
+	switch size % 4 {
+	case 0:
+		size++
+	case 2:
+		size--
+	case 3:
+		size -= 2
+	}
+	return size
+}
+
+// axes are vectors of one module along rows and along columns of the code of the size
+func (found corners) axes(size int) (point, point) {
+	modules := float64(size - 7)
+	return point{(found.topRight.x - found.topLeft.x) / modules, (found.topRight.y - found.topLeft.y) / modules},
+		point{(found.bottomLeft.x - found.topLeft.x) / modules, (found.bottomLeft.y - found.topLeft.y) / modules}
+}
+
+// timingSize counts modules of the timing patterns, the lines of alternating modules which join finder
+// patterns along row and column 6. It gives the size they tell when it is close to the estimated one
+func (found corners) timingSize(picture *bitmap, estimated int) (int, bool) {
+	across, down := found.axes(estimated)
+	votes := make(map[int]int)
+	for _, offset := range []float64{2.8, 3, 3.2} {
+		lines := [][2]point{
+			{{found.topLeft.x + offset*down.x, found.topLeft.y + offset*down.y}, {found.topRight.x + offset*down.x, found.topRight.y + offset*down.y}},
+			{{found.topLeft.x + offset*across.x, found.topLeft.y + offset*across.y}, {found.bottomLeft.x + offset*across.x, found.bottomLeft.y + offset*across.y}},
+		}
+		for _, line := range lines {
+			runs := countRuns(picture, line[0], line[1], math.Hypot(across.x, across.y)/4)
+			size := runs + 12
+			if size%4 == 1 && absInt(size-estimated) <= estimated/5+4 {
+				votes[size]++
+			}
+		}
+	}
+	best, bestVotes := 0, 0
+	for size, count := range votes {
+		if count > bestVotes || (count == bestVotes && absInt(size-estimated) < absInt(best-estimated)) {
+			best, bestVotes = size, count
+		}
+	}
+	return best, bestVotes > 0
+}
+
+// countRuns counts runs of dark and light pixels from one point to another, looking every step pixels.
+// Runs of one look are taken as noise
+func countRuns(picture *bitmap, from, to point, step float64) int {
+	count := int(distance(from, to) / step)
+	if count < 2 {
+		return 0
+	}
+	var runs []int
+	previous := false
+	for i := 0; i <= count; i++ {
+		t := float64(i) / float64(count)
+		dark := picture.at(int(math.Floor(from.x+t*(to.x-from.x))), int(math.Floor(from.y+t*(to.y-from.y))))
+		if i > 0 && dark == previous {
+			runs[len(runs)-1]++
+		} else {
+			runs = append(runs, 1)
+		}
+		previous = dark
+	}
+	merged := runs[:1]
+	for i := 1; i < len(runs); i++ {
+		if runs[i] == 1 && i+1 < len(runs) {
+			merged[len(merged)-1] += runs[i] + runs[i+1]
+			i++
+			continue
+		}
+		merged = append(merged, runs[i])
+	}
+	return len(merged)
+}
+
+// findAlignment looks for the alignment pattern near the bottom right corner of the code, a dark module
+// inside a light and a dark ring. It gives a few places which look like it, the likeliest first. Codes of
+// version 1 have none
+func findAlignment(picture *bitmap, found corners, size int) []point {
+	if size < 25 {
+		return nil
+	}
+	last := float64(size) - 3.5
+	from := [4]point{{3.5, 3.5}, {last, 3.5}, {last, last}, {3.5, last}}
+	to := [4]point{
+		found.topLeft.point,
+		found.topRight.point,
+		{found.topRight.x - found.topLeft.x + found.bottomLeft.x, found.topRight.y - found.topLeft.y + found.bottomLeft.y},
+		found.bottomLeft.point,
+	}
+	transform := squareToQuad(to).times(squareToQuad(from).adjoint())
+	// the perspective moves the pattern farther from where a parallelogram puts it in bigger codes
+	return alignmentsNear(picture, transform, last-3, max(16, float64(size)/5))
+}
+
+// maxAlignments limits how many places of the alignment pattern are tried
+const maxAlignments = 4
+
+// alignmentsNear compares modules around every pixel within the radius in modules from the place where
+// the transformation puts the alignment pattern at the module with the center. Places with up to 2 wrong
+// modules are given, the ones with fewer wrong modules and closer to the expected place first
+func alignmentsNear(picture *bitmap, transform perspective, middle float64, radius float64) []point {
+	x0, y0 := transform.apply(middle, middle)
+	estimate := point{x0, y0}
+	x1, y1 := transform.apply(middle+1, middle)
+	x2, y2 := transform.apply(middle, middle+1)
+	across, down := point{x1 - x0, y1 - y0}, point{x2 - x0, y2 - y0}
+	moduleSize := math.Max(math.Hypot(across.x, across.y), 1)
+	mismatches := func(x, y float64) int {
+		count := 0
+		for i := -2; i <= 2; i++ {
+			for j := -2; j <= 2; j++ {
+				px := x + float64(i)*across.x + float64(j)*down.x
+				py := y + float64(i)*across.y + float64(j)*down.y
+				if picture.at(int(math.Floor(px)), int(math.Floor(py))) != (max(absInt(i), absInt(j)) != 1) {
+					count++
+				}
+			}
+		}
+		return count
+	}
+	type match struct {
+		point
+		mismatches int
+		pixels     int
+	}
+	var matches []match
+	window := int(radius * moduleSize)
+	for y := int(estimate.y) - window; y <= int(estimate.y)+window; y++ {
+		for x := int(estimate.x) - window; x <= int(estimate.x)+window; x++ {
+			if !picture.at(x, y) {
+				continue
+			}
+			count := mismatches(float64(x)+0.5, float64(y)+0.5)
+			if count > 2 {
+				continue
+			}
+			candidate := point{float64(x) + 0.5, float64(y) + 0.5}
+			joined := false
+			// the pattern matches on all pixels of its center module, its center is their middle
+			for i := range matches {
+				existing := &matches[i]
+				if distance(existing.point, candidate) <= moduleSize {
+					n := float64(existing.pixels)
+					existing.x = (existing.x*n + candidate.x) / (n + 1)
+					existing.y = (existing.y*n + candidate.y) / (n + 1)
+					existing.mismatches = min(existing.mismatches, count)
+					existing.pixels++
+					joined = true
+					break
+				}
+			}
+			if !joined {
+				matches = append(matches, match{candidate, count, 1})
+			}
+		}
+	}
+	// a wrong module counts as much as being 4 modules farther from the expected place
+	score := func(m match) float64 {
+		return float64(m.mismatches) + distance(m.point, estimate)/moduleSize/4
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return score(matches[i]) < score(matches[j])
+	})
+	var result []point
+	for i := 0; i < len(matches) && i < maxAlignments; i++ {
+		result = append(result, matches[i].point)
+	}
+	return result
+}
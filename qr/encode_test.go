@@ -0,0 +1,225 @@
+package qr
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// encode makes a byte mode code of the text with the version, error correction level and mask. It is the way
+// round of decoding, written only to make codes for tests
+func encode(t *testing.T, text string, number, levelIndex, mask int) modules {
+	t.Helper()
+	info := versions[number]
+	count, check := info.levels[levelIndex].blocks, info.levels[levelIndex].checkBytes
+	dataBytes := info.codewords - count*check
+	lengthBits := 8
+	if number >= 10 {
+		lengthBits = 16
+	}
+	writer := &bitWriter{}
+	writer.write(4, 4)
+	writer.write(len(text), lengthBits)
+	for i := 0; i < len(text); i++ {
+		writer.write(int(text[i]), 8)
+	}
+	if len(writer.data)*8-writer.free > dataBytes*8 {
+		t.Fatalf("%d bytes don't fit version %d level %d", len(text), number, levelIndex)
+	}
+	writer.write(0, min(4, dataBytes*8-(len(writer.data)*8-writer.free)))
+	writer.free = 0
+	for pad := 0; len(writer.data) < dataBytes; pad++ {
+		writer.data = append(writer.data, []byte{0xec, 0x11}[pad%2])
+	}
+
+	short, longer := dataBytes/count, dataBytes%count
+	blocks := make([][]byte, count)
+	next := 0
+	for i := range blocks {
+		length := short
+		if i >= count-longer {
+			length++
+		}
+		blocks[i] = writer.data[next : next+length]
+		next += length
+	}
+	var codewords []byte
+	for i := 0; i <= short; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				codewords = append(codewords, block[i])
+			}
+		}
+	}
+	checks := make([][]byte, count)
+	for i, block := range blocks {
+		checks[i] = checkBytes(block, check)
+	}
+	for i := 0; i < check; i++ {
+		for _, block := range checks {
+			codewords = append(codewords, block[i])
+		}
+	}
+	return place(codewords, number, levelIndex, mask)
+}
+
+// bitWriter is the way round of bitReader, free is how many bits of the last byte are not written yet
+type bitWriter struct {
+	data []byte
+	free int
+}
+
+func (writer *bitWriter) write(value, count int) {
+	for i := count - 1; i >= 0; i-- {
+		if writer.free == 0 {
+			writer.data = append(writer.data, 0)
+			writer.free = 8
+		}
+		writer.free--
+		writer.data[len(writer.data)-1] |= byte(value>>i&1) << writer.free
+	}
+}
+
+// checkBytes are the remainder of the block times x^count divided by the generator with roots 2^0 ... 2^(count-1)
+func checkBytes(block []byte, count int) []byte {
+	generator := []byte{1}
+	for i := 0; i < count; i++ {
+		next := make([]byte, len(generator)+1)
+		for j, coefficient := range generator {
+			next[j] ^= coefficient
+			next[j+1] ^= gfMul(coefficient, gfPow(i))
+		}
+		generator = next
+	}
+	remainder := make([]byte, len(block)+count)
+	copy(remainder, block)
+	for i := range block {
+		factor := remainder[i]
+		if factor == 0 {
+			continue
+		}
+		for j, coefficient := range generator {
+			remainder[i+j] ^= gfMul(factor, coefficient)
+		}
+	}
+	return remainder[len(block):]
+}
+
+// place draws function patterns, format and version bits and the codewords like [modules.codewords] reads them
+func place(codewords []byte, number, levelIndex, mask int) modules {
+	size := 17 + 4*number
+	grid := make(modules, size)
+	for row := range grid {
+		grid[row] = make([]bool, size)
+	}
+	for _, corner := range [][2]int{{0, 0}, {0, size - 7}, {size - 7, 0}} {
+		for y := 0; y < 7; y++ {
+			for x := 0; x < 7; x++ {
+				ring := max(absInt(y-3), absInt(x-3))
+				grid[corner[0]+y][corner[1]+x] = ring != 2
+			}
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		grid[6][i], grid[i][6] = i%2 == 0, i%2 == 0
+	}
+	centers := alignmentCenters(number)
+	for _, y := range centers {
+		for _, x := range centers {
+			if (x == 6 && y == 6) || (x == 6 && y == size-7) || (x == size-7 && y == 6) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					grid[y+dy][x+dx] = max(absInt(dy), absInt(dx)) != 1
+				}
+			}
+		}
+	}
+	grid[size-8][8] = true
+	format := formatCode((levelIndex^1)<<3 | mask)
+	for i := 0; i < 15; i++ {
+		dark := format>>i&1 == 1
+		switch {
+		case i < 6:
+			grid[i][8] = dark
+		case i < 8:
+			grid[i+1][8] = dark
+		case i < 9:
+			grid[8][7] = dark
+		default:
+			grid[8][14-i] = dark
+		}
+		if i < 8 {
+			grid[8][size-1-i] = dark
+		} else {
+			grid[size-15+i][8] = dark
+		}
+	}
+	if number >= 7 {
+		for i := 0; i < 18; i++ {
+			dark := versions[number].versionBits>>i&1 == 1
+			x, y := i/3, size-11+i%3
+			grid[y][x], grid[x][y] = dark, dark
+		}
+	}
+	bit := 0
+	up := true
+	for column := size - 1; column > 0; column -= 2 {
+		if column == 6 {
+			column--
+		}
+		for i := 0; i < size; i++ {
+			row := i
+			if up {
+				row = size - 1 - i
+			}
+			for _, x := range []int{column, column - 1} {
+				if isFunction(number, row, x) {
+					continue
+				}
+				dark := false
+				if bit < len(codewords)*8 {
+					dark = codewords[bit/8]>>(7-bit%8)&1 == 1
+				}
+				grid[row][x] = dark != masked(mask, row, x)
+				bit++
+			}
+		}
+		up = !up
+	}
+	return grid
+}
+
+// rotated is the code turned clockwise by quarters
+func (grid modules) rotated(quarters int) modules {
+	for ; quarters > 0; quarters-- {
+		turned := make(modules, len(grid))
+		for row := range turned {
+			turned[row] = make([]bool, len(grid))
+			for column := range turned[row] {
+				turned[row][column] = grid[len(grid)-1-column][row]
+			}
+		}
+		grid = turned
+	}
+	return grid
+}
+
+// picture draws the code with a quiet zone of 4 modules, every module is scale pixels wide
+func (grid modules) picture(scale int) image.Image {
+	size := (len(grid) + 8) * scale
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			row, column := y/scale-4, x/scale-4
+			dark := row >= 0 && column >= 0 && row < len(grid) && column < len(grid) && grid[row][column]
+			if dark {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,160 @@
+// Package qr reads QR codes from images like photos of receipts. It finds the three finder patterns in corners
+// of a code, samples its modules taking the perspective of the photo into account and corrects wrong modules
+// with Reed-Solomon codes. Only numeric, alphanumeric and byte data is read, it is what codes with links have
+package qr
+
+import (
+	"errors"
+	"image"
+	"math"
+)
+
+// ErrNotFound is given when there is no QR code in the image that can be read
+var ErrNotFound = errors.New("no QR code found")
+
+// Decode gives the text of a QR code in the image. When there are a few codes it gives one of them
+func Decode(img image.Image) (string, error) {
+	values, width, height := luminance(img)
+	if width == 0 || height == 0 {
+		return "", ErrNotFound
+	}
+	for _, threshold := range []func([]uint8, int, int) *bitmap{localThreshold, globalThreshold} {
+		picture := threshold(values, width, height)
+		if text, err := decodeBitmap(picture); err == nil {
+			return text, nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// maxTriples limits how many triples of finder patterns are tried in one image
+const maxTriples = 5
+
+func decodeBitmap(picture *bitmap) (string, error) {
+	triples := chooseCorners(findFinders(picture))
+	if len(triples) > maxTriples {
+		triples = triples[:maxTriples]
+	}
+	for _, found := range triples {
+		estimated := found.size(found.moduleSize(picture))
+		sizes := []int{estimated, estimated - 4, estimated + 4, estimated - 8, estimated + 8}
+		if counted, ok := found.timingSize(picture, estimated); ok && counted != estimated {
+			sizes = append([]int{counted}, sizes...)
+		}
+		for _, size := range sizes {
+			if size < 21 || size > 177 {
+				continue
+			}
+			var alignments []point
+			if size > 21 {
+				alignments = findAlignment(picture, found, size)
+			}
+			// without the alignment pattern the code is taken as a parallelogram
+			for _, alignment := range append(alignments, point{math.NaN(), math.NaN()}) {
+				grid, ok := sample(picture, found, size, alignment)
+				if !ok {
+					continue
+				}
+				if text, err := grid.decode(); err == nil {
+					return text, nil
+				}
+				if text, err := grid.transposed().decode(); err == nil {
+					return text, nil
+				}
+			}
+		}
+	}
+	return "", ErrNotFound
+}
+
+// sample reads every module of the code of the size at its center. Centers of finder patterns and of
+// the bottom right alignment pattern tell the perspective. When the alignment is NaN the fourth corner
+// is taken where it would be without perspective
+func sample(picture *bitmap, found corners, size int, alignment point) (modules, bool) {
+	last := float64(size) - 3.5
+	from := [4]point{{3.5, 3.5}, {last, 3.5}, {last, last}, {3.5, last}}
+	to := [4]point{
+		found.topLeft.point,
+		found.topRight.point,
+		{found.topRight.x - found.topLeft.x + found.bottomLeft.x, found.topRight.y - found.topLeft.y + found.bottomLeft.y},
+		found.bottomLeft.point,
+	}
+	if !math.IsNaN(alignment.x) {
+		from[2] = point{last - 3, last - 3}
+		to[2] = alignment
+	}
+	transform := squareToQuad(to).times(squareToQuad(from).adjoint())
+	grid := make(modules, size)
+	for row := range grid {
+		grid[row] = make([]bool, size)
+		for column := range grid[row] {
+			x, y := transform.apply(float64(column)+0.5, float64(row)+0.5)
+			if x < -1 || y < -1 || x > float64(picture.width)+1 || y > float64(picture.height)+1 {
+				return nil, false
+			}
+			grid[row][column] = picture.at(int(math.Floor(x)), int(math.Floor(y)))
+		}
+	}
+	return grid, true
+}
+
+// transposed is the code mirrored along its diagonal, like a code seen from the back of the paper
+func (grid modules) transposed() modules {
+	result := make(modules, len(grid))
+	for row := range grid {
+		result[row] = make([]bool, len(grid))
+		for column := range grid {
+			result[row][column] = grid[column][row]
+		}
+	}
+	return result
+}
+
+// perspective is a projective transformation of the plane, x and y are divided by the last row
+type perspective [3][3]float64
+
+func (matrix perspective) apply(x, y float64) (float64, float64) {
+	w := matrix[2][0]*x + matrix[2][1]*y + matrix[2][2]
+	return (matrix[0][0]*x + matrix[0][1]*y + matrix[0][2]) / w, (matrix[1][0]*x + matrix[1][1]*y + matrix[1][2]) / w
+}
+
+func (matrix perspective) times(other perspective) perspective {
+	var result perspective
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				result[i][j] += matrix[i][k] * other[k][j]
+			}
+		}
+	}
+	return result
+}
+
+// adjoint is the inverse transformation up to a factor, which doesn't matter for projective ones
+func (matrix perspective) adjoint() perspective {
+	m := matrix
+	return perspective{
+		{m[1][1]*m[2][2] - m[1][2]*m[2][1], m[0][2]*m[2][1] - m[0][1]*m[2][2], m[0][1]*m[1][2] - m[0][2]*m[1][1]},
+		{m[1][2]*m[2][0] - m[1][0]*m[2][2], m[0][0]*m[2][2] - m[0][2]*m[2][0], m[0][2]*m[1][0] - m[0][0]*m[1][2]},
+		{m[1][0]*m[2][1] - m[1][1]*m[2][0], m[0][1]*m[2][0] - m[0][0]*m[2][1], m[0][0]*m[1][1] - m[0][1]*m[1][0]},
+	}
+}
+
+// squareToQuad maps corners of the unit square (0,0), (1,0), (1,1) and (0,1) to the points
+func squareToQuad(points [4]point) perspective {
+	x0, y0, x1, y1 := points[0].x, points[0].y, points[1].x, points[1].y
+	x2, y2, x3, y3 := points[2].x, points[2].y, points[3].x, points[3].y
+	dx3, dy3 := x0-x1+x2-x3, y0-y1+y2-y3
+	if dx3 == 0 && dy3 == 0 {
+		return perspective{{x1 - x0, x3 - x0, x0}, {y1 - y0, y3 - y0, y0}, {0, 0, 1}}
+	}
+	dx1, dx2, dy1, dy2 := x1-x2, x3-x2, y1-y2, y3-y2
+	denominator := dx1*dy2 - dx2*dy1
+	a13 := (dx3*dy2 - dx2*dy3) / denominator
+	a23 := (dx1*dy3 - dx3*dy1) / denominator
+	return perspective{
+		{x1 - x0 + a13*x1, x3 - x0 + a23*x3, x0},
+		{y1 - y0 + a13*y1, y3 - y0 + a23*y3, y0},
+		{a13, a23, 1},
+	}
+}
@@ -0,0 +1,115 @@
+package qr
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// afipLink is like the links of AFIP receipt codes, its length is typical for them
+const afipLink = "https://www.afip.gob.ar/fe/qr/?p=eyJ2ZXIiOjEsImZlY2hhIjoiMjAyNC0wMy0wNCIsImN1aXQiOjMwNzEyMzQ1Njc4LCJwdG9WdGEiOjMsInRpcG9DbXAiOjYsIm5yb0NtcCI6MTIzNDUsImltcG9ydGUiOjE1MDAuNX0="
+
+// levelNames are error correction levels in the order of [version] levels
+var levelNames = []string{"L", "M", "Q", "H"}
+
+// fitting is the text cut to what a code of the version and level can keep
+func fitting(text string, number, levelIndex int) string {
+	info := versions[number]
+	level := info.levels[levelIndex]
+	capacity := info.codewords - level.blocks*level.checkBytes - 2
+	if number >= 10 {
+		capacity--
+	}
+	return text[:min(len(text), capacity)]
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	for _, number := range []int{1, 2, 4, 7, 10} {
+		for levelIndex := range levelNames {
+			text := fitting(afipLink, number, levelIndex)
+			mask := (number + levelIndex) % 8
+			grid := encode(t, text, number, levelIndex, mask)
+			for quarters := 0; quarters < 4; quarters++ {
+				t.Run(fmt.Sprintf("version %d level %s turned %d", number, levelNames[levelIndex], 90*quarters), func(t *testing.T) {
+					got, err := Decode(grid.rotated(quarters).picture(4))
+					if err != nil {
+						t.Fatalf("Decode: %v", err)
+					}
+					if got != text {
+						t.Errorf("Decode = %q, want %q", got, text)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestDecodeEveryMask(t *testing.T) {
+	text := fitting(afipLink, 5, 1)
+	for mask := 0; mask < 8; mask++ {
+		got, err := Decode(encode(t, text, 5, 1, mask).picture(3))
+		if err != nil || got != text {
+			t.Errorf("mask %d: Decode = %q, %v, want %q", mask, got, err, text)
+		}
+	}
+}
+
+func TestDecodeCorrectsDamagedModules(t *testing.T) {
+	text := fitting(afipLink, 6, 3)
+	grid := encode(t, text, 6, 3, 2)
+	flipped := 0
+	for row := len(grid) - 1; row >= 0 && flipped < 12; row -= 3 {
+		column := len(grid) - 1 - row%5
+		if !isFunction(6, row, column) {
+			grid[row][column] = !grid[row][column]
+			flipped++
+		}
+	}
+	got, err := Decode(grid.picture(4))
+	if err != nil || got != text {
+		t.Errorf("Decode of a damaged code = %q, %v, want %q", got, err, text)
+	}
+}
+
+func TestDecodeMirroredCode(t *testing.T) {
+	text := fitting(afipLink, 3, 0)
+	got, err := Decode(encode(t, text, 3, 0, 4).transposed().picture(4))
+	if err != nil || got != text {
+		t.Errorf("Decode of a mirrored code = %q, %v, want %q", got, err, text)
+	}
+}
+
+func TestDecodeWithoutCode(t *testing.T) {
+	blank := image.NewGray(image.Rect(0, 0, 200, 200))
+	for i := range blank.Pix {
+		blank.Pix[i] = 255
+	}
+	blank.SetGray(100, 100, color.Gray{})
+	if _, err := Decode(blank); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Decode of a blank picture gives %v, want %v", err, ErrNotFound)
+	}
+	if _, err := Decode(image.NewGray(image.Rect(0, 0, 0, 0))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Decode of an empty picture gives %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestCorrectFixesUpToHalfOfCheckBytes(t *testing.T) {
+	data := []byte(strings.Repeat("receipt", 4))
+	for _, check := range []int{7, 10, 16, 30} {
+		block := append(append([]byte{}, data...), checkBytes(data, check)...)
+		damaged := append([]byte{}, block...)
+		for i := 0; i < check/2; i++ {
+			damaged[i*3%len(damaged)] ^= byte(0x5a + i)
+		}
+		if err := correct(damaged, check); err != nil {
+			t.Errorf("%d check bytes: correct gives %v", check, err)
+			continue
+		}
+		if string(damaged) != string(block) {
+			t.Errorf("%d check bytes: corrected block = %x, want %x", check, damaged, block)
+		}
+	}
+}
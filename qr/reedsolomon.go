@@ -0,0 +1,150 @@
+package qr
+
+import "errors"
+
+var errTooManyErrors = errors.New("too many errors to correct")
+
+// QR codes use Reed-Solomon codes over GF(256) with the polynomial x^8+x^4+x^3+x^2+1 and generator 2
+var (
+	gfExp [512]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// gfPow is the generator to the power, which may be negative
+func gfPow(power int) byte {
+	power %= 255
+	if power < 0 {
+		power += 255
+	}
+	return gfExp[power]
+}
+
+// evaluate gives the value of the polynomial with coefficients from the lowest degree at x
+func evaluate(polynomial []byte, x byte) byte {
+	var value byte
+	for i := len(polynomial) - 1; i >= 0; i-- {
+		value = gfMul(value, x) ^ polynomial[i]
+	}
+	return value
+}
+
+// syndromes of the block whose first byte is the coefficient of the highest degree. They are all zero when there are no errors
+func syndromes(block []byte, checkBytes int) ([]byte, bool) {
+	result := make([]byte, checkBytes)
+	clean := true
+	for i := range result {
+		x := gfPow(i)
+		var value byte
+		for _, b := range block {
+			value = gfMul(value, x) ^ b
+		}
+		result[i] = value
+		if value != 0 {
+			clean = false
+		}
+	}
+	return result, clean
+}
+
+// correct fixes up to half of checkBytes wrong bytes of the block in place. It finds the error locator with
+// the Berlekamp-Massey algorithm, its roots by trying every position and the error values with the Forney formula
+func correct(block []byte, checkBytes int) error {
+	syndrome, clean := syndromes(block, checkBytes)
+	if clean {
+		return nil
+	}
+	locator, length := []byte{1}, 0
+	previous, shift, previousDiscrepancy := []byte{1}, 1, byte(1)
+	for n := 0; n < checkBytes; n++ {
+		discrepancy := syndrome[n]
+		for i := 1; i <= length && i < len(locator); i++ {
+			discrepancy ^= gfMul(locator[i], syndrome[n-i])
+		}
+		if discrepancy == 0 {
+			shift++
+			continue
+		}
+		factor := gfDiv(discrepancy, previousDiscrepancy)
+		updated := make([]byte, max(len(locator), len(previous)+shift))
+		copy(updated, locator)
+		for i, coefficient := range previous {
+			updated[i+shift] ^= gfMul(factor, coefficient)
+		}
+		if 2*length <= n {
+			previous, length, previousDiscrepancy, shift = locator, n+1-length, discrepancy, 1
+		} else {
+			shift++
+		}
+		locator = updated
+	}
+	if 2*length > checkBytes {
+		return errTooManyErrors
+	}
+	// evaluator is syndromes times locator cut to checkBytes coefficients
+	evaluator := make([]byte, checkBytes)
+	for i, s := range syndrome {
+		for j, l := range locator {
+			if i+j < checkBytes {
+				evaluator[i+j] ^= gfMul(s, l)
+			}
+		}
+	}
+	var derivative []byte
+	for i := 1; i < len(locator); i++ {
+		if i%2 == 1 {
+			derivative = append(derivative, locator[i])
+		} else {
+			derivative = append(derivative, 0)
+		}
+	}
+	found := 0
+	for position := range block {
+		power := len(block) - 1 - position
+		inverse := gfPow(-power)
+		if evaluate(locator, inverse) != 0 {
+			continue
+		}
+		denominator := evaluate(derivative, inverse)
+		if denominator == 0 {
+			return errTooManyErrors
+		}
+		block[position] ^= gfMul(gfPow(power), gfDiv(evaluate(evaluator, inverse), denominator))
+		found++
+	}
+	if found != length {
+		return errTooManyErrors
+	}
+	if _, clean = syndromes(block, checkBytes); !clean {
+		return errTooManyErrors
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package reports
+
+import (
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// Balance is the money an account has: its opening balance with transfers to it less expenses paid from it
+// and transfers from it. A card owes money when its balance is negative
+type Balance struct {
+	Account storage_interface.Account
+	Amount  float32
+}
+
+// MainAccount is the account paying expenses which don't name one, the first added account in pesos which is not a card
+func MainAccount(accounts []storage_interface.Account) (storage_interface.Account, bool) {
+	for _, account := range accounts {
+		if account.Kind != storage_interface.AccountCard && account.Currency == Currency {
+			return account, true
+		}
+	}
+	return storage_interface.Account{}, false
+}
+
+// NewBalances counts balances of the accounts from events and transfers made since each account was added.
+// Events without an account are paid from the main account, mainID is 0 when there is no such account
+func NewBalances(accounts []storage_interface.Account, mainID int, events []storage_interface.MoneyEvent, transfers []storage_interface.Transfer) []Balance {
+	balances := make([]Balance, len(accounts))
+	positions := make(map[int]int, len(accounts))
+	for i, account := range accounts {
+		balances[i] = Balance{Account: account, Amount: account.Opening}
+		positions[account.ID] = i
+	}
+	change := func(accountID int, amount float32, moment time.Time) {
+		i, known := positions[accountID]
+		if known && !moment.Before(balances[i].Account.Created) {
+			balances[i].Amount += amount
+		}
+	}
+	for _, event := range events {
+		accountID := event.AccountID
+		if accountID == 0 {
+			accountID = mainID
+		}
+		change(accountID, -event.Amount, event.Created)
+	}
+	for _, transfer := range transfers {
+		change(transfer.FromAccountID, -transfer.Amount, transfer.Created)
+		change(transfer.ToAccountID, transfer.Received, transfer.Created)
+	}
+	return balances
+}
@@ -0,0 +1,145 @@
+package reports
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+const (
+	progressBarWidth = 10
+	progressFull     = "\xE2\x96\x88"
+	progressEmpty    = "\xE2\x96\x91"
+	overBudgetMark   = "\xE2\x80\xBC"
+	lineIndent       = "    "
+)
+
+// BudgetReport compares spending of a period with targets of the period, tag by tag
+type BudgetReport struct {
+	Tags        []*TagNode
+	Spent       float32
+	Budget      float32
+	HasBudget   bool
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	// Now is the moment the report is made for. Days left are counted from its day
+	Now time.Time
+}
+
+// Currency is the currency of reports. Events in other currencies, like dollars of a savings account,
+// can't be summed with it and are left out
+const Currency = "ARS"
+
+// Countable tells whether the amount of the event is summed in reports
+func Countable(event storage_interface.MoneyEvent) bool {
+	return event.Currency == Currency || event.Currency == ""
+}
+
+// NewBudgetReport sums money events and targets of the period [from, to) by tags of the user
+func NewBudgetReport(tags []storage_interface.Tag, events []storage_interface.MoneyEvent, targets []storage_interface.Target, from, to, now time.Time) BudgetReport {
+	spending := make(map[string]float32)
+	for _, event := range events {
+		if Countable(event) {
+			spending[event.Tag] += event.Amount
+		}
+	}
+	targetSums := make(map[string]float32)
+	for _, target := range targets {
+		targetSums[target.Tag] += target.Amount
+	}
+	report := BudgetReport{Tags: BuildTagTree(tags, spending, targetSums), PeriodStart: from, PeriodEnd: to, Now: now}
+	for _, node := range report.Tags {
+		report.Spent += node.Total
+		if budget, ok := node.Budget(); ok {
+			report.Budget += budget
+			report.HasBudget = true
+		}
+	}
+	return report
+}
+
+// DaysLeft counts days till the end of the period including today. It is 0 when the period is over
+func (report BudgetReport) DaysLeft() int {
+	year, month, day := report.Now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, report.Now.Location())
+	if !today.Before(report.PeriodEnd) {
+		return 0
+	}
+	if today.Before(report.PeriodStart) {
+		today = report.PeriodStart
+	}
+	return int(math.Ceil(report.PeriodEnd.Sub(today).Hours() / 24))
+}
+
+// DailyAllowance is how much can be spent every day till the end of the period to stay within the budget.
+// The second value is false when there is no budget, no days left or nothing left to spend
+func (report BudgetReport) DailyAllowance() (float32, bool) {
+	daysLeft := report.DaysLeft()
+	if !report.HasBudget || daysLeft == 0 || report.Spent >= report.Budget {
+		return 0, false
+	}
+	return (report.Budget - report.Spent) / float32(daysLeft), true
+}
+
+// Text is the report as lines: a tag per line with its children indented, the grand total and the daily allowance
+func (report BudgetReport) Text() string {
+	if len(report.Tags) == 0 {
+		return "No expenses and no budget for this period yet"
+	}
+	var lines []string
+	for _, node := range Flatten(report.Tags) {
+		label := strings.Repeat(lineIndent, node.Depth) + node.Label()
+		if budget, ok := node.Budget(); ok {
+			lines = append(lines, label+": "+budgetLine(node.Total, budget))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: %.2f", label, node.Total))
+		}
+	}
+	lines = append(lines, "")
+	if report.HasBudget {
+		lines = append(lines, "Total: "+budgetLine(report.Spent, report.Budget))
+	} else {
+		lines = append(lines, fmt.Sprintf("Total: %.2f", report.Spent))
+	}
+	if allowance, ok := report.DailyAllowance(); ok {
+		lines = append(lines, fmt.Sprintf("You can spend %.2f/day for the rest of the period (%d days)", allowance, report.DaysLeft()))
+	} else if report.HasBudget && report.Spent > report.Budget {
+		lines = append(lines, fmt.Sprintf("The budget is exceeded by %.2f", report.Spent-report.Budget))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// budgetLine shows spent vs target, percent used, a progress bar and what is remaining
+func budgetLine(spent, budget float32) string {
+	remaining := fmt.Sprintf("%.2f left", budget-spent)
+	if spent > budget {
+		remaining = fmt.Sprintf("%s%.2f over", overBudgetMark, spent-budget)
+	}
+	return fmt.Sprintf("%.2f / %.2f (%s) %s %s", spent, budget, PercentUsed(spent, budget), ProgressBar(spent, budget), remaining)
+}
+
+// PercentUsed is the part of the budget already spent, like "42%". An empty budget is used completely by any spending
+func PercentUsed(spent, budget float32) string {
+	if budget <= 0 {
+		if spent > 0 {
+			return "100%+"
+		}
+		return "0%"
+	}
+	return fmt.Sprintf("%.0f%%", 100*spent/budget)
+}
+
+// ProgressBar draws the part of the budget already spent with text blocks. It never gets longer than the budget
+func ProgressBar(spent, budget float32) string {
+	filled := progressBarWidth
+	if budget > 0 && spent < budget {
+		filled = int(math.Round(float64(progressBarWidth * spent / budget)))
+	}
+	if filled < 0 {
+		filled = 0
+	}
+	return strings.Repeat(progressFull, filled) + strings.Repeat(progressEmpty, progressBarWidth-filled)
+}
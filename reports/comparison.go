@@ -0,0 +1,88 @@
+package reports
+
+import (
+	"fmt"
+	"strings"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// Comparison shows spending of every tag in a period next to the previous period and the same period a year before
+type Comparison struct {
+	Tags     []*TagNode
+	Previous map[string]float32
+	LastYear map[string]float32
+}
+
+// NewComparison sums money events of the three periods by tags of the user. Tags spent only in the past periods
+// are shown too, with nothing spent now
+func NewComparison(tags []storage_interface.Tag, current, previous, lastYear []storage_interface.MoneyEvent) Comparison {
+	previousTotals := totalsByTag(tags, previous)
+	lastYearTotals := totalsByTag(tags, lastYear)
+	spending := sumByTag(current)
+	for name := range previousTotals {
+		if _, ok := spending[name]; !ok {
+			spending[name] = 0
+		}
+	}
+	for name := range lastYearTotals {
+		if _, ok := spending[name]; !ok {
+			spending[name] = 0
+		}
+	}
+	return Comparison{Tags: BuildTagTree(tags, spending, nil), Previous: previousTotals, LastYear: lastYearTotals}
+}
+
+// Text is a tag per line with its change against the previous period and the year before
+func (comparison Comparison) Text() string {
+	if len(comparison.Tags) == 0 {
+		return "No expenses in these periods"
+	}
+	var lines []string
+	var total, previousTotal, lastYearTotal float32
+	for _, node := range comparison.Tags {
+		total += node.Total
+		previousTotal += comparison.Previous[node.Name]
+		lastYearTotal += comparison.LastYear[node.Name]
+	}
+	for _, node := range Flatten(comparison.Tags) {
+		label := strings.Repeat(lineIndent, node.Depth) + node.Label()
+		lines = append(lines, fmt.Sprintf("%s: %s", label, comparisonLine(node.Total, comparison.Previous[node.Name], comparison.LastYear[node.Name])))
+	}
+	lines = append(lines, "", "Total: "+comparisonLine(total, previousTotal, lastYearTotal))
+	return strings.Join(lines, "\n")
+}
+
+func comparisonLine(spent, previous, lastYear float32) string {
+	return fmt.Sprintf("%.2f (previous %.2f %s, year before %.2f %s)", spent, previous, Change(spent, previous), lastYear, Change(spent, lastYear))
+}
+
+// Change is the difference between now and before in percent, like "+12%". There is no percent when nothing was before
+func Change(now, before float32) string {
+	if before == 0 {
+		if now == 0 {
+			return "="
+		}
+		return "new"
+	}
+	return fmt.Sprintf("%+.0f%%", 100*(now-before)/before)
+}
+
+func sumByTag(events []storage_interface.MoneyEvent) map[string]float32 {
+	sums := make(map[string]float32)
+	for _, event := range events {
+		if Countable(event) {
+			sums[event.Tag] += event.Amount
+		}
+	}
+	return sums
+}
+
+// totalsByTag gives spending of every tag together with its children
+func totalsByTag(tags []storage_interface.Tag, events []storage_interface.MoneyEvent) map[string]float32 {
+	totals := make(map[string]float32)
+	for _, node := range Flatten(BuildTagTree(tags, sumByTag(events), nil)) {
+		totals[node.Name] = node.Total
+	}
+	return totals
+}
@@ -0,0 +1,84 @@
+package reports
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// upcomingMonths is how many months after the period are listed with their installments
+const upcomingMonths = 3
+
+// InstallmentsSummary is the burden of purchases in installments: how much they take from the period
+// and what is left to pay after it
+type InstallmentsSummary struct {
+	Paid      float32
+	Purchases int
+	Left      float32
+	LeftCount int
+	// Last is the month of the last installment left to pay
+	Last time.Time
+	// Upcoming are sums of installments of the months following the period
+	Upcoming []MonthSum
+}
+
+// MonthSum is the total of a calendar month
+type MonthSum struct {
+	Month time.Time
+	Total float32
+}
+
+// NewInstallmentsSummary sums installments among events of the period and among events after it
+func NewInstallmentsSummary(periodEvents, laterEvents []storage_interface.MoneyEvent) InstallmentsSummary {
+	var summary InstallmentsSummary
+	purchases := make(map[int]bool)
+	for _, event := range periodEvents {
+		if event.PurchaseID == 0 || !Countable(event) {
+			continue
+		}
+		summary.Paid += event.Amount
+		purchases[event.PurchaseID] = true
+	}
+	summary.Purchases = len(purchases)
+	months := make(map[string]float32)
+	var first time.Time
+	for _, event := range laterEvents {
+		if event.PurchaseID == 0 || !Countable(event) {
+			continue
+		}
+		summary.Left += event.Amount
+		summary.LeftCount++
+		month := MonthPeriod(event.Created).Start
+		months[month.Format(monthLayout)] += event.Amount
+		if month.After(summary.Last) {
+			summary.Last = month
+		}
+		if first.IsZero() || month.Before(first) {
+			first = month
+		}
+	}
+	for month := first; len(months) > 0 && len(summary.Upcoming) < upcomingMonths && !month.After(summary.Last); month = month.AddDate(0, 1, 0) {
+		summary.Upcoming = append(summary.Upcoming, MonthSum{Month: month, Total: months[month.Format(monthLayout)]})
+	}
+	return summary
+}
+
+// Empty tells there are no installments in the period and none left after it
+func (summary InstallmentsSummary) Empty() bool {
+	return summary.Purchases == 0 && summary.LeftCount == 0
+}
+
+// Text is the installments of the period and the ones left to pay in the next months
+func (summary InstallmentsSummary) Text() string {
+	lines := []string{fmt.Sprintf("\xF0\x9F\x92\xB3Installments this period: %.2f (%d purchases)", summary.Paid, summary.Purchases)}
+	if summary.LeftCount == 0 {
+		return lines[0]
+	}
+	lines = append(lines, fmt.Sprintf("Still to pay: %.2f in %d installments till %s", summary.Left, summary.LeftCount, summary.Last.Format("January 2006")))
+	for _, month := range summary.Upcoming {
+		lines = append(lines, fmt.Sprintf("%s%s: %.2f", lineIndent, month.Month.Format("January 2006"), month.Total))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,205 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"ingresos_gastos/storage_interface"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+	yearLayout  = "2006"
+	// rangeSeparator joins the first and the last days of a custom period like "2024-03-01..2024-03-15"
+	rangeSeparator = ".."
+)
+
+type periodKind int
+
+const (
+	periodDays periodKind = iota
+	periodMonth
+	periodYear
+)
+
+var ErrPeriodFormat = errors.New("unknown period")
+
+// PeriodExamples are the ways to type a period for users
+const PeriodExamples = "2024-03, 2024, 2024-03-05, 2024-03-01..2024-03-15, today, yesterday, this week, last week, this month, last month, this year, last year, ytd"
+
+// Period is the interval [Start, End) of whole days to make statistics for
+type Period struct {
+	Start time.Time
+	End   time.Time
+	kind  periodKind
+}
+
+// MonthPeriod is the calendar month containing the moment
+func MonthPeriod(moment time.Time) Period {
+	year, month, _ := moment.Date()
+	start := time.Date(year, month, 1, 0, 0, 0, 0, moment.Location())
+	return Period{Start: start, End: start.AddDate(0, 1, 0), kind: periodMonth}
+}
+
+func yearPeriod(year int, location *time.Location) Period {
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, location)
+	return Period{Start: start, End: start.AddDate(1, 0, 0), kind: periodYear}
+}
+
+func daysPeriod(first, last time.Time) Period {
+	return Period{Start: first, End: last.AddDate(0, 0, 1), kind: periodDays}
+}
+
+func startOfDay(moment time.Time) time.Time {
+	year, month, day := moment.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, moment.Location())
+}
+
+// ParsePeriod understands periods listed in [PeriodExamples]. Relative periods are counted from now,
+// weeks start on Monday. An empty text is the current month
+func ParsePeriod(text string, now time.Time) (Period, error) {
+	text = strings.ToLower(strings.Join(strings.Fields(text), " "))
+	today := startOfDay(now)
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	switch text {
+	case "", "this month", "month":
+		return MonthPeriod(now), nil
+	case "last month":
+		return MonthPeriod(MonthPeriod(now).Start.AddDate(0, -1, 0)), nil
+	case "today":
+		return daysPeriod(today, today), nil
+	case "yesterday":
+		yesterday := today.AddDate(0, 0, -1)
+		return daysPeriod(yesterday, yesterday), nil
+	case "this week", "week":
+		return daysPeriod(weekStart, weekStart.AddDate(0, 0, 6)), nil
+	case "last week":
+		return daysPeriod(weekStart.AddDate(0, 0, -7), weekStart.AddDate(0, 0, -1)), nil
+	case "this year", "year":
+		return yearPeriod(now.Year(), now.Location()), nil
+	case "last year":
+		return yearPeriod(now.Year()-1, now.Location()), nil
+	case "ytd":
+		return daysPeriod(yearPeriod(now.Year(), now.Location()).Start, today), nil
+	}
+	if first, last, found := strings.Cut(text, rangeSeparator); found {
+		firstDay, errFirst := time.ParseInLocation(dayLayout, strings.TrimSpace(first), now.Location())
+		lastDay, errLast := time.ParseInLocation(dayLayout, strings.TrimSpace(last), now.Location())
+		if errFirst != nil || errLast != nil || lastDay.Before(firstDay) {
+			return Period{}, fmt.Errorf("can't understand period '%s': %w", text, ErrPeriodFormat)
+		}
+		return daysPeriod(firstDay, lastDay), nil
+	}
+	if day, err := time.ParseInLocation(dayLayout, text, now.Location()); err == nil {
+		return daysPeriod(day, day), nil
+	}
+	if month, err := time.ParseInLocation(monthLayout, text, now.Location()); err == nil {
+		return MonthPeriod(month), nil
+	}
+	if year, err := time.ParseInLocation(yearLayout, text, now.Location()); err == nil {
+		return yearPeriod(year.Year(), now.Location()), nil
+	}
+	return Period{}, fmt.Errorf("can't understand period '%s': %w", text, ErrPeriodFormat)
+}
+
+// Shift moves the period by the number of its own lengths: months for a month, years for a year and days for other periods
+func (period Period) Shift(times int) Period {
+	switch period.kind {
+	case periodMonth:
+		return MonthPeriod(period.Start.AddDate(0, times, 0))
+	case periodYear:
+		return yearPeriod(period.Start.Year()+times, period.Start.Location())
+	default:
+		days := period.Days()
+		return Period{Start: period.Start.AddDate(0, 0, times*days), End: period.End.AddDate(0, 0, times*days), kind: periodDays}
+	}
+}
+
+// Previous is the period of the same length right before this one
+func (period Period) Previous() Period {
+	return period.Shift(-1)
+}
+
+// Next is the period of the same length right after this one
+func (period Period) Next() Period {
+	return period.Shift(1)
+}
+
+// YearBefore is the same period a year earlier
+func (period Period) YearBefore() Period {
+	switch period.kind {
+	case periodMonth:
+		return MonthPeriod(period.Start.AddDate(-1, 0, 0))
+	case periodYear:
+		return period.Shift(-1)
+	default:
+		return Period{Start: period.Start.AddDate(-1, 0, 0), End: period.End.AddDate(-1, 0, 0), kind: periodDays}
+	}
+}
+
+// Days is the number of days in the period
+func (period Period) Days() int {
+	return int(period.End.Sub(period.Start).Hours()/24 + 0.5)
+}
+
+// Contains tells if the moment is inside the period
+func (period Period) Contains(moment time.Time) bool {
+	return !moment.Before(period.Start) && moment.Before(period.End)
+}
+
+// String gives the period in the form [ParsePeriod] understands, so it can be passed around as text
+func (period Period) String() string {
+	last := period.End.AddDate(0, 0, -1)
+	switch {
+	case period.kind == periodMonth:
+		return period.Start.Format(monthLayout)
+	case period.kind == periodYear:
+		return period.Start.Format(yearLayout)
+	case period.Days() == 1:
+		return period.Start.Format(dayLayout)
+	default:
+		return period.Start.Format(dayLayout) + rangeSeparator + last.Format(dayLayout)
+	}
+}
+
+// Title is the period as it is shown to users
+func (period Period) Title() string {
+	last := period.End.AddDate(0, 0, -1)
+	switch {
+	case period.kind == periodMonth:
+		return period.Start.Format("January 2006")
+	case period.kind == periodYear:
+		return period.Start.Format(yearLayout)
+	case period.Days() == 1:
+		return period.Start.Format("Mon, 2 Jan 2006")
+	default:
+		return period.Start.Format("2 Jan 2006") + " \xE2\x80\x93 " + last.Format("2 Jan 2006")
+	}
+}
+
+// DailyCumulative is the running total of the events at the end of every day of the period up to today
+func DailyCumulative(events []storage_interface.MoneyEvent, period Period, now time.Time) []float32 {
+	days := period.Days()
+	if period.Contains(now) {
+		days = int(startOfDay(now).Sub(period.Start).Hours()/24+0.5) + 1
+	} else if now.Before(period.Start) {
+		return nil
+	}
+	daily := make([]float32, days)
+	for _, event := range events {
+		if !period.Contains(event.Created) || !Countable(event) {
+			continue
+		}
+		day := int(startOfDay(event.Created.In(period.Start.Location())).Sub(period.Start).Hours()/24 + 0.5)
+		if day < days {
+			daily[day] += event.Amount
+		}
+	}
+	for day := 1; day < days; day++ {
+		daily[day] += daily[day-1]
+	}
+	return daily
+}
@@ -0,0 +1,131 @@
+// Package reports turns money events and targets into summaries which are shown to users
+package reports
+
+import (
+	"sort"
+
+	"ingresos_gastos/storage_interface"
+)
+
+// TagNode is a tag in the tree of tags with spending of the tag itself and spending rolled up from its children
+type TagNode struct {
+	Name  string
+	Emoji string
+	Color string
+	Spent float32
+	Total float32
+	// Target is the budget set for the tag itself, HasTarget tells if there is one
+	Target    float32
+	HasTarget bool
+	Depth     int
+	Children  []*TagNode
+	// listed tells that the tag is in spending even with nothing spent, so it is kept in the tree
+	listed bool
+	// known tags are user's tags, their sortOrder and id give their position like in keyboards
+	known     bool
+	sortOrder int
+	id        int
+}
+
+// BuildTagTree puts spending and targets by tag name into the tree of user's tags, so parent tags get totals of their
+// children. Tags missing in spending and targets in all their subtree are left out. Spending and targets of tags unknown
+// to the tree go to the top level. Tags on every level are in the order user gave them, the same as in keyboards,
+// unknown tags follow them sorted by name
+func BuildTagTree(tags []storage_interface.Tag, spending map[string]float32, targets map[string]float32) []*TagNode {
+	nodesByID := make(map[int]*TagNode)
+	nodesByName := make(map[string]*TagNode)
+	for _, tag := range tags {
+		spent, listed := spending[tag.Name]
+		node := &TagNode{Name: tag.Name, Emoji: tag.Emoji, Color: tag.Color, Spent: spent, listed: listed,
+			known: true, sortOrder: tag.SortOrder, id: tag.ID}
+		nodesByID[tag.ID] = node
+		nodesByName[tag.Name] = node
+	}
+	var roots []*TagNode
+	for _, tag := range tags {
+		node := nodesByID[tag.ID]
+		if parent, ok := nodesByID[tag.ParentID]; ok && tag.ParentID != tag.ID {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	for name, amount := range spending {
+		if _, ok := nodesByName[name]; !ok {
+			node := &TagNode{Name: name, Spent: amount, listed: true}
+			nodesByName[name] = node
+			roots = append(roots, node)
+		}
+	}
+	for name, amount := range targets {
+		node, ok := nodesByName[name]
+		if !ok {
+			node = &TagNode{Name: name}
+			nodesByName[name] = node
+			roots = append(roots, node)
+		}
+		node.Target, node.HasTarget = amount, true
+	}
+	return finishLevel(roots, 0)
+}
+
+func finishLevel(nodes []*TagNode, depth int) []*TagNode {
+	var result []*TagNode
+	for _, node := range nodes {
+		node.Depth = depth
+		node.Children = finishLevel(node.Children, depth+1)
+		node.Total = node.Spent
+		for _, child := range node.Children {
+			node.Total += child.Total
+		}
+		if node.listed || node.HasTarget || len(node.Children) > 0 {
+			result = append(result, node)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.known != b.known {
+			return a.known
+		}
+		if !a.known {
+			return a.Name < b.Name
+		}
+		if a.sortOrder != b.sortOrder {
+			return a.sortOrder < b.sortOrder
+		}
+		return a.id < b.id
+	})
+	return result
+}
+
+// Budget is the target of the tag itself or the sum of budgets of its children when the tag has no target.
+// The second value tells if there is any budget in the subtree
+func (node *TagNode) Budget() (float32, bool) {
+	if node.HasTarget {
+		return node.Target, true
+	}
+	var budget float32
+	found := false
+	for _, child := range node.Children {
+		if childBudget, ok := child.Budget(); ok {
+			budget += childBudget
+			found = true
+		}
+	}
+	return budget, found
+}
+
+// Label is the name of the tag with its emoji
+func (node *TagNode) Label() string {
+	return node.Emoji + node.Name
+}
+
+// Flatten lists the tree depth first: every parent goes right before its children
+func Flatten(nodes []*TagNode) []*TagNode {
+	var result []*TagNode
+	for _, node := range nodes {
+		result = append(result, node)
+		result = append(result, Flatten(node.Children)...)
+	}
+	return result
+}
@@ -0,0 +1,82 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/cards"
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"strings"
+)
+
+// accountMark starts a word naming the account of an expense, like "@visa" in "5000 food @visa"
+const accountMark = "@"
+
+// accountLast moves words naming accounts after the others, so the first word still can be the tag
+func accountLast(words []string) []string {
+	var result, accounts []string
+	for _, word := range words {
+		if strings.HasPrefix(word, accountMark) && len(word) > len(accountMark) {
+			accounts = append(accounts, word)
+		} else {
+			result = append(result, word)
+		}
+	}
+	return append(result, accounts...)
+}
+
+// findAccount looks for the account by its name ignoring case
+func findAccount(accounts []storage_interface.Account, name string) (storage_interface.Account, bool) {
+	for _, account := range accounts {
+		if strings.EqualFold(account.Name, name) {
+			return account, true
+		}
+	}
+	return storage_interface.Account{}, false
+}
+
+// takeAccount finds the account named in the comment and takes its name out of the comment.
+// Words with the mark which are not names of user's accounts stay in the comment.
+// When no account is named the money comes from the main account
+func (env MessagingPlatform) takeAccount(user bot_interface.BotRecipient, comment string) (storage_interface.Account, string) {
+	accounts, err := env.Storage.GetAccounts(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting accounts in takeAccount: %v", err))
+		return storage_interface.Account{}, comment
+	}
+	words := strings.Fields(comment)
+	for i, word := range words {
+		if !strings.HasPrefix(word, accountMark) {
+			continue
+		}
+		if account, ok := findAccount(accounts, strings.TrimPrefix(word, accountMark)); ok {
+			return account, strings.Join(append(words[:i:i], words[i+1:]...), " ")
+		}
+	}
+	main, _ := reports.MainAccount(accounts)
+	return main, comment
+}
+
+// accountNote tells which account the expense is paid from and for a card which statement it lands on
+func (env MessagingPlatform) accountNote(user bot_interface.BotRecipient, event storage_interface.MoneyEvent) string {
+	if event.AccountID == 0 {
+		return ""
+	}
+	accounts, err := env.Storage.GetAccounts(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting accounts in accountNote: %v", err))
+		return ""
+	}
+	for _, account := range accounts {
+		if account.ID != event.AccountID {
+			continue
+		}
+		if account.Kind == storage_interface.AccountCard && account.ClosingDay > 0 {
+			cycle := cards.CycleOf(account.ClosingDay, account.DueDay, event.Created)
+			return fmt.Sprintf("\n\xF0\x9F\x92\xB3%s statement closing %s, due %s", account.Name, cycle.Closing().Format("Mon, 2 Jan"), cycle.Due.Format("Mon, 2 Jan"))
+		}
+		return "\nFrom " + account.Name
+	}
+	return ""
+}
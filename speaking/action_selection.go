@@ -3,11 +3,17 @@ package speaking
 import (
 	"fmt"
 	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/notifications"
 	"log"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// nestedTagSpaces lets user type "Food > Groceries" for a nested tag
+var nestedTagSpaces = regexp.MustCompile(`\s*>\s*`)
+
 func (env MessagingPlatform) saveUsageLog(requestType string, userId int64) {
 	err := env.Storage.SaveUsageLog(userId, requestType)
 	if err != nil {
@@ -15,51 +21,118 @@ func (env MessagingPlatform) saveUsageLog(requestType string, userId int64) {
 	}
 }
 
-func (env MessagingPlatform) DetectAppropriateActionForButton(user bot_interface.BotRecipient, inlineButtonTag string) ([]bot_interface.Message, error) {
+func (env MessagingPlatform) DetectAppropriateActionForButton(user bot_interface.BotRecipient, callback bot_interface.Callback) ([]bot_interface.Message, error) {
 	var messages []bot_interface.Message
 	var err error
-	commandFound := true
-	switch inlineButtonTag {
-	case bot_interface.CommandDefineTags:
-		messages, err = env.GiveInstructionsOnTags(user)
-	case bot_interface.CommandDefineBudget:
-		messages, err = env.GiveInstructionOnBudgeting(user)
-	case bot_interface.CommandStatistics:
-		messages, err = env.GiveCurrentStatistics(user)
-	case bot_interface.CommandHelp:
-		messages, err = env.ProvideHelp(user)
-	case bot_interface.CommandStart:
-		messages, err = env.ProvideGreeting(user)
-	case bot_interface.CommandFeedback:
-		messages, err = env.ProvideFeedbackInstruction(user)
-	case bot_interface.CommandCancel:
-		messages, err = env.CancelLastState(user)
-	default:
-		commandFound = false
+	if callback.Action == bot_interface.ActionCommand {
+		commandFound := true
+		switch callback.Value {
+		case bot_interface.CommandDefineTags:
+			messages, err = env.GiveInstructionsOnTags(user)
+		case bot_interface.CommandDefineBudget:
+			messages, err = env.GiveInstructionOnBudgeting(user)
+		case bot_interface.CommandStatistics:
+			messages, err = env.GiveCurrentStatistics(user)
+		case bot_interface.CommandHelp:
+			messages, err = env.ProvideHelp(user)
+		case bot_interface.CommandStart:
+			messages, err = env.ProvideGreeting(user)
+		case bot_interface.CommandFeedback:
+			messages, err = env.ProvideFeedbackInstruction(user)
+		case bot_interface.CommandCancel:
+			messages, err = env.CancelLastState(user)
+		case bot_interface.CommandRules:
+			messages, err = env.GiveInstructionsOnRules(user)
+		case bot_interface.CommandRenameTag:
+			messages, err = env.StartRenamingTag(user)
+		case bot_interface.CommandMergeTags:
+			messages, err = env.StartMergingTags(user)
+		case bot_interface.CommandArchiveTag:
+			messages, err = env.StartArchivingTag(user)
+		case bot_interface.CommandCards:
+			messages, err = env.GiveCards(user, "")
+		default:
+			commandFound = false
+		}
+		if commandFound {
+			env.saveUsageLog(callback.Value, user.UserID)
+			return messages, nil
+		}
 	}
-	if commandFound {
-		env.saveUsageLog(inlineButtonTag, user.UserID)
+
+	switch callback.Action {
+	case bot_interface.ActionStatistics:
+		env.saveUsageLog(bot_interface.CommandStatistics, user.UserID)
+		return env.GiveStatistics(user, callback.Value)
+	case bot_interface.ActionCharts:
+		env.saveUsageLog(bot_interface.CommandCharts, user.UserID)
+		return env.GiveCharts(user, callback.Value)
+	case bot_interface.ActionExpenses:
+		return env.ShowTagExpenses(user, callback.Value)
+	case bot_interface.ActionEditExpense:
+		return env.StartEditingExpense(user, callback.Value)
+	case bot_interface.ActionDeleteExpense:
+		return env.DeleteExpense(user, callback.Value, callback.State)
+	case bot_interface.ActionImport:
+		return env.AnswerImport(user, callback.Value)
+	case bot_interface.ActionReconcile:
+		return env.AnswerReconcile(user, callback.Value)
+	case bot_interface.ActionOpenTag:
+		return env.OpenTagLevel(user, callback.Value)
+	case bot_interface.ActionInput:
+		return env.DetectAppropriateActionForInput(user, callback.Value)
+	case bot_interface.ActionChangeTag:
+		messages, err = env.ChooseNewTagForExpense(user, callback.State)
+		if err != nil && len(messages) == 0 {
+			messages = []bot_interface.Message{{Text: "Problem in our system. Please try again later"}}
+		}
 		return messages, nil
 	}
 
 	userState, err := env.Storage.GetUserState(user.UserID)
 	if err == nil {
-		switch userState {
-		case bot_interface.StateCreateTags:
-			messages, err = env.UpdateTag(user, strings.TrimPrefix(inlineButtonTag, "inline_"))
-		case bot_interface.StateModifyBudget:
-			messages, err = env.ConfirmSelectingBudgetTag(user, strings.TrimPrefix(inlineButtonTag, "inline_"))
-		case bot_interface.StateSpending:
-			numberToParse := trimStringFromFirstSpace(userState)
+		tag := callback.Value
+		switch {
+		case callback.Action == bot_interface.ActionCardStatement:
+			messages, err = env.ShowCardStatement(user, callback.Value)
+		case callback.Action == bot_interface.ActionAttachments:
+			messages, err = env.SendAttachments(user, callback.Value)
+		case callback.Action == bot_interface.ActionDeleteRule:
+			messages, err = env.DeleteCategorizationRule(user, callback.Value)
+		case callback.Action == bot_interface.ActionEditTag:
+			messages, err = env.EditTagSetting(user, userState, callback.Value)
+		case callback.Action == bot_interface.ActionColor:
+			messages, err = env.SetTagColor(user, userState, callback.Value)
+		case callback.Action != bot_interface.ActionTag:
+			log.Print("ERROR unrecognized button action: " + callback.Action)
+			messages = []bot_interface.Message{{Text: "I didn't recognize the command. Sorry"}}
+		case strings.HasPrefix(userState, bot_interface.StateCreateTags):
+			messages, err = env.SelectTagInTagsList(user, tag)
+		case strings.HasPrefix(userState, bot_interface.StateModifyBudget):
+			messages, err = env.ConfirmSelectingBudgetTag(user, tag)
+		case strings.HasPrefix(userState, bot_interface.StateSpending):
+			numberToParse, comment := splitByFirstSpace(trimStringFromFirstSpace(userState))
 			amount, errParsing := strconv.ParseFloat(numberToParse, 32)
 			if errParsing == nil {
-				messages, err = env.SetSpendingWithTag(user, float32(amount), strings.TrimPrefix(inlineButtonTag, "inline_"), "")
+				messages, err = env.SetSpendingWithTag(user, float32(amount), tag, comment)
 			} else {
-				log.Print(fmt.Errorf("error parsing float from state '%s' in GiveCurrentStatistics: %v", userState, err))
+				log.Print(fmt.Errorf("error parsing float from state '%s' in DetectAppropriateActionForButton: %v", userState, errParsing))
 				messages = []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}
 			}
+		case strings.HasPrefix(userState, bot_interface.StateNotification):
+			messages, err = env.SetNotifiedSpendingWithTag(user, userState, tag)
+		case strings.HasPrefix(userState, bot_interface.StateReceipt):
+			messages, err = env.SetReceiptSpendingWithTag(user, userState, tag)
+		case strings.HasPrefix(userState, bot_interface.StateChangeTag):
+			messages, err = env.ChangeExpenseTag(user, tag)
+		case strings.HasPrefix(userState, bot_interface.StateRenameTag):
+			messages, err = env.SelectTagToRename(user, tag)
+		case strings.HasPrefix(userState, bot_interface.StateMergeTags):
+			messages, err = env.SelectTagToMerge(user, userState, tag)
+		case strings.HasPrefix(userState, bot_interface.StateArchiveTag):
+			messages, err = env.ArchiveTag(user, tag)
 		default: //unrecognized. Let's write an error
-			log.Print("ERROR unrecognized button: " + inlineButtonTag)
+			log.Print("ERROR unrecognized button: " + tag)
 			messages = []bot_interface.Message{{Text: "I didn't recognize the command. Sorry"}}
 		}
 		if err != nil && (messages == nil || len(messages) == 0) {
@@ -77,8 +150,9 @@ func (env MessagingPlatform) DetectAppropriateActionForInput(user bot_interface.
 	userState, errGettingState := env.Storage.GetUserState(user.UserID)
 	if errGettingState == nil {
 		if strings.HasPrefix(userState, bot_interface.StateCreateTags) {
+			messageText = nestedTagSpaces.ReplaceAllString(strings.TrimSpace(messageText), ">")
 			if strings.Contains(messageText, " ") {
-				tags := strings.Split(messageText, " ")
+				tags := strings.Fields(messageText)
 				for _, tag := range tags {
 					messageForTag, _ := env.UpdateTag(user, tag)
 					messages = append(messages, messageForTag[0])
@@ -94,31 +168,38 @@ func (env MessagingPlatform) DetectAppropriateActionForInput(user bot_interface.
 				messages = []bot_interface.Message{{Text: "I can't understand your number, please enter correct number"}}
 				log.Print(fmt.Errorf("error parsing float from message '%s' in DetectAppropriateActionForInput: %v", messageText, err))
 			}
+		} else if strings.HasPrefix(userState, bot_interface.StateCreateRule) {
+			messages, _ = env.AddCategorizationRule(user, messageText)
+		} else if strings.HasPrefix(userState, bot_interface.StateTagEmoji) {
+			messages, _ = env.SetTagEmoji(user, userState, messageText)
+		} else if strings.HasPrefix(userState, bot_interface.StateTagColor) {
+			messages, _ = env.SetTagColor(user, userState, messageText)
+		} else if strings.HasPrefix(userState, bot_interface.StateJournalAccounts) {
+			messages, _ = env.UpdateJournalAccounts(user, messageText)
+		} else if strings.HasPrefix(userState, bot_interface.StateFeedback) {
+			messages, _ = env.SaveFeedback(user, messageText)
+		} else if strings.HasPrefix(userState, bot_interface.StateImportColumns) {
+			messages, _ = env.ChooseImportColumns(user, messageText)
+		} else if strings.HasPrefix(userState, bot_interface.StateEditExpense) {
+			messages, _ = env.EditExpense(user, userState, messageText)
+		} else if strings.HasPrefix(userState, bot_interface.StateRenameTag) {
+			messages, _ = env.RenameTag(user, userState, messageText)
+		} else if strings.HasPrefix(userState, bot_interface.StateReconcile) {
+			messages, _ = env.ReconcileWithInput(user, userState, messageText)
+		} else if _, _, errParsing := splitExpenseInput(messageText); errParsing != nil && isExpenseTagChoice(userState) && len(strings.Fields(messageText)) == 1 {
+			messages, _ = env.SetTypedTag(user, messageText)
 		} else {
-			if strings.Contains(messageText, " ") {
-				parts := strings.Split(messageText, " ")
-				possibleAmount, err := strconv.ParseFloat(parts[0], 32)
-				if err == nil {
-					contentLength := len(parts)
-					if contentLength == 3 { // todo switch
-						messages, err = env.SetSpendingWithTag(user, float32(possibleAmount), parts[1], parts[2])
-					} else if contentLength == 2 {
-						messages, err = env.SetSpendingWithTag(user, float32(possibleAmount), parts[1], "")
-					} else {
-						messages, err = env.SetSpending(user, float32(possibleAmount))
-					}
-				} else {
-					log.Print(fmt.Errorf("error parsing float from message '%s' in DetectAppropriateActionForInput: %v", messageText, err))
-					messages, err = env.SaveFeedback(user, messageText)
-				}
+			possibleAmount, words, err := splitExpenseInput(messageText)
+			if err == nil {
+				messages, err = env.RecordExpense(user, possibleAmount, words)
+			} else if notification, found := notifications.Parse(messageText, time.Now()); found {
+				messages, err = env.ProposeNotifiedExpense(user, notification)
+			} else if strings.Contains(messageText, " ") {
+				log.Print(fmt.Errorf("error parsing float from message '%s' in DetectAppropriateActionForInput: %v", messageText, err))
+				messages, err = env.SaveFeedback(user, messageText)
 			} else {
-				possibleAmount, err := strconv.ParseFloat(messageText, 32)
-				if err == nil {
-					messages, err = env.SetSpending(user, float32(possibleAmount))
-				} else {
-					log.Print(fmt.Errorf("error parsing float from message '%s' in DetectAppropriateActionForInput: %v", messageText, err))
-					messages = []bot_interface.Message{{Text: "I can't understand your number, please enter correct number"}}
-				}
+				log.Print(fmt.Errorf("error parsing float from message '%s' in DetectAppropriateActionForInput: %v", messageText, err))
+				messages = []bot_interface.Message{{Text: "I can't understand your number, please enter correct number"}}
 			}
 		}
 	} else {
@@ -133,13 +214,28 @@ func (env MessagingPlatform) ListenToCommands() {
 	env.Bot.ListenToCommand("/"+bot_interface.CommandHelp, env.ProvideHelp)
 	env.Bot.ListenToCommand("/"+bot_interface.CommandDefineTags, env.GiveInstructionsOnTags)
 	env.Bot.ListenToCommand("/"+bot_interface.CommandDefineBudget, env.GiveInstructionOnBudgeting)
-	env.Bot.ListenToCommand("/"+bot_interface.CommandStatistics, env.GiveCurrentStatistics)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandStatistics, env.GiveStatistics)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandCharts, env.GiveCharts)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandStatement, env.GiveStatement)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandExport, env.GiveExport)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandJournal, env.GiveJournal)
+	env.Bot.ListenToCommand("/"+bot_interface.CommandJournalAccounts, env.GiveJournalAccounts)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandCards, env.GiveCards)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandBalances, env.GiveBalances)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandTransfer, env.RecordTransfer)
+	env.Bot.ListenToCommandWithArguments("/"+bot_interface.CommandReconcile, env.StartReconciling)
 	env.Bot.ListenToCommand("/"+bot_interface.CommandFeedback, env.ProvideFeedbackInstruction)
 	env.Bot.ListenToCommand("/"+bot_interface.CommandCancel, env.CancelLastState)
+	env.Bot.ListenToCommand("/"+bot_interface.CommandRules, env.GiveInstructionsOnRules)
+	env.Bot.ListenToCommand("/"+bot_interface.CommandRenameTag, env.StartRenamingTag)
+	env.Bot.ListenToCommand("/"+bot_interface.CommandMergeTags, env.StartMergingTags)
+	env.Bot.ListenToCommand("/"+bot_interface.CommandArchiveTag, env.StartArchivingTag)
 }
 
 func (env MessagingPlatform) ListenToUserInput() {
 	env.Bot.ListenToInput(env.DetectAppropriateActionForInput)
+	env.Bot.ListenToDocuments(env.ReceiveDocument)
+	env.Bot.ListenToPhotos(env.ReceivePhoto)
 }
 
 func (env MessagingPlatform) ListenToInlineActions() {
@@ -2,10 +2,17 @@ package speaking
 
 import (
 	"fmt"
+	"ingresos_gastos/blobs"
 	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/categorization"
+	"ingresos_gastos/installments"
+	"ingresos_gastos/statement"
 	"ingresos_gastos/storage_interface"
+	"ingresos_gastos/tagpolicy"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // MessagingPlatform contains full functionality to speak with users.
@@ -14,15 +21,21 @@ import (
 type MessagingPlatform struct {
 	Storage storage_interface.ActualStorage
 	Bot     bot_interface.Bot
+	// Statements makes links to download statements from the HTTP server
+	Statements statement.Links
+	// Blobs keeps files attached to expenses, without it files can't be attached
+	Blobs blobs.Store
+	// Suggestions keeps models of tag suggestions, without it they are learned from history every time
+	Suggestions *categorization.Models
 }
 
 func provideMainOptions() bot_interface.Message {
 	text := "To add new expense just type it here. Other commands:"
 	options := []bot_interface.Option{
-		{Id: bot_interface.CommandHelp, Text: "\xE2\x9D\x93help"},
-		{Id: bot_interface.CommandDefineTags, Text: "\xE2\x9C\x8Ftags"},
-		{Id: bot_interface.CommandDefineBudget, Text: "\xF0\x9F\x92\xB0budget"},
-		{Id: bot_interface.CommandStatistics, Text: "\xF0\x9F\x93\x8Astatistics"},
+		{Id: bot_interface.CommandHelp, Action: bot_interface.ActionCommand, Text: "\xE2\x9D\x93help"},
+		{Id: bot_interface.CommandDefineTags, Action: bot_interface.ActionCommand, Text: "\xE2\x9C\x8Ftags"},
+		{Id: bot_interface.CommandDefineBudget, Action: bot_interface.ActionCommand, Text: "\xF0\x9F\x92\xB0budget"},
+		{Id: bot_interface.CommandStatistics, Action: bot_interface.ActionCommand, Text: "\xF0\x9F\x93\x8Astatistics"},
 	}
 	return bot_interface.Message{
 		Text:    text,
@@ -51,14 +64,33 @@ func (env MessagingPlatform) ProvideHelp(user bot_interface.BotRecipient) ([]bot
 	reply := fmt.Sprintf(`%s - Start the bot_interface and get a description
 %s - Get a list of all available commands
 %s - Define categories of expenses
+%s, %s, %s - Rename, merge or archive a category keeping its history
 %s - Set a budget for each category for the current month
 <number> <tag> <comment> - save a new expense (only number is required, other fields are optional)
-%s - View your current month statistics
+<number> <comment> - save a new expense with a tag chosen by your rules
+<number> <tag> 12c <comment> - save a purchase paid in 12 monthly installments, the number is its total
+<number> <tag> <comment> @visa - save an expense paid with the card or account Visa, without it the expense is paid from your first account in pesos
+Forward a payment notification of your bank or Mercado Pago to save it as an expense
+Send a photo of a receipt with its AFIP QR code to save its total, a caption becomes the comment
+Send a photo or a PDF with a caption like "1500 food", or in reply to the message about an expense, to attach it to the expense
+Send a CSV, OFX or QIF file of your bank or another app to import expenses from it, or result.json of a chat exported by Telegram Desktop to import expenses typed there
+%s [period] - View statistics for the current month or a period like 2024-03, last week, ytd or 2024-03-01..2024-03-15. Start with "compare" to see changes against the previous period and the year before
+%s [period] - Draw charts of spending for the current month or a period
+%s [period] - Get a PDF statement for the current month or a period. Statements of closed months come by themselves
+%s [csv|json|xlsx] [period] - Download your expenses, budgets and tags as a file
+%s [ledger|hledger|beancount] [period] - Download a plain-text accounting journal, %s chooses accounts for tags
+%s - Manage rules that choose a tag for an expense automatically
+%s [add <name> <closing day> <due day>] - View your credit cards with their statements and next payments or add a card
+%s [add <name> cash|bank|wallet|savings <balance> [currency]] - View balances of your accounts or add an account
+%s <amount> @from @to [received amount] [comment] - Move money between accounts, like an ATM withdrawal or buying dollars. With one account the money comes to it, like a salary
+%s [@account] [balance] - Check the balance of an account against the money it really has and record the difference
 %s - Give feedback to developers about this product
 %s - finish ongoing operation (like defining month budget or creating tags)`,
 		bot_interface.CommandStart, bot_interface.CommandHelp, bot_interface.CommandDefineTags,
-		bot_interface.CommandDefineBudget, bot_interface.CommandStatistics, bot_interface.CommandFeedback,
-		bot_interface.CommandCancel)
+		bot_interface.CommandRenameTag, bot_interface.CommandMergeTags, bot_interface.CommandArchiveTag,
+		bot_interface.CommandDefineBudget, bot_interface.CommandStatistics, bot_interface.CommandCharts, bot_interface.CommandStatement, bot_interface.CommandExport, bot_interface.CommandJournal, bot_interface.CommandJournalAccounts, bot_interface.CommandRules,
+		bot_interface.CommandCards, bot_interface.CommandBalances, bot_interface.CommandTransfer,
+		bot_interface.CommandReconcile, bot_interface.CommandFeedback, bot_interface.CommandCancel)
 	return []bot_interface.Message{{Text: reply}, provideMainOptions()}, nil
 }
 
@@ -83,11 +115,12 @@ func (env MessagingPlatform) SaveFeedback(user bot_interface.BotRecipient, feedb
 }
 
 func (env MessagingPlatform) GiveInstructionsOnTags(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
-	acceptedTags, err := env.Storage.GetUserTags(user.UserID)
+	userTags, err := env.Storage.GetTags(user.UserID)
 	if err != nil {
 		log.Print(fmt.Errorf("error getting user tags in GiveInstructionsOnTags: %v", err))
 		return []bot_interface.Message{{Text: "Problem creating your profile in our system. Please try again later"}}, err
 	}
+	acceptedTags := activeTags(userTags)
 	var replyOptions []bot_interface.Option
 	var textReply string
 	if len(acceptedTags) == 0 {
@@ -95,16 +128,17 @@ func (env MessagingPlatform) GiveInstructionsOnTags(user bot_interface.BotRecipi
 		textReply = "You didn't select tags yet. Please select from the list to add or input your own by keyboard"
 	} else {
 		for _, savedTag := range acceptedTags {
-			replyOptions = append(replyOptions, bot_interface.Option{Id: "inline_" + savedTag, Text: savedTag})
+			replyOptions = append(replyOptions, bot_interface.Option{Id: savedTag.Name, Action: bot_interface.ActionTag, Text: tagLabel(savedTag)})
 		}
-		textReply = "Your current tags are below.\nSelect a tag to delete or input new tags by keyboard"
+		textReply = fmt.Sprintf("Your current tags are below.\nSelect a tag to change its emoji, color or position or input new tags by keyboard.\nType 'Parent>Tag' to put a tag inside another one.\nUse /%s or /%s to fix tag names",
+			bot_interface.CommandRenameTag, bot_interface.CommandMergeTags)
 	}
 	errSavingState := env.Storage.SetState(user.UserID, bot_interface.StateCreateTags)
 	if errSavingState != nil {
 		log.Print(fmt.Errorf("error saving user state in GiveInstructionsOnTags: %v", errSavingState))
 		return []bot_interface.Message{{Text: "Problem creating your profile in our system. Please try again later"}}, errSavingState
 	}
-	return []bot_interface.Message{{Text: textReply, Options: replyOptions}}, nil
+	return []bot_interface.Message{{Text: textReply, Options: replyOptions, Layout: bot_interface.Layout{WithFinishOption: true}}}, nil
 }
 
 func (env MessagingPlatform) CancelLastState(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
@@ -116,34 +150,36 @@ func (env MessagingPlatform) CancelLastState(user bot_interface.BotRecipient) ([
 	return []bot_interface.Message{provideMainOptions()}, nil
 }
 
-func stringInSlice(a string, list []string) bool {
-	for _, b := range list {
-		if b == a {
-			return true
-		}
-	}
-	return false
-}
-
 func (env MessagingPlatform) UpdateTag(user bot_interface.BotRecipient, tag string) ([]bot_interface.Message, error) {
+	if parent, child, nested := strings.Cut(tag, ">"); nested {
+		return env.AddNestedTag(user, parent, child)
+	}
+	tag, emoji, errNormalizing := tagpolicy.Normalize(tag)
+	if errNormalizing != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't use it as a tag: %v", errNormalizing)}}, nil
+	}
 	tags, err := env.Storage.GetUserTags(user.UserID)
 	if err != nil {
 		return nil, err
 	}
 	var reply string
-	if stringInSlice(tag, tags) {
-		err := env.Storage.RemoveTagForUser(tag, user.UserID)
+	if existingTag, found := findTag(tag, tags); found {
+		tag = existingTag
+		err := env.Storage.ArchiveTagForUser(tag, user.UserID)
 		if err != nil {
-			log.Print(fmt.Errorf("error removing tag in updateTag: %v", err))
+			log.Print(fmt.Errorf("error archiving tag in updateTag: %v", err))
 			return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
 		}
-		reply = "Tag '" + tag + "' deleted"
+		env.forgetSuggestions(user)
+		reply = "Tag '" + tag + "' archived. Its history stays in your statistics"
 	} else {
 		err := env.Storage.AddTagForUser(tag, user.UserID)
 		if err != nil {
 			log.Print(fmt.Errorf("error adding tag in updateTag: %v", err))
 			return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
 		}
+		env.forgetSuggestions(user)
+		env.giveEmoji(user, tag, emoji)
 		reply = "Tag '" + tag + "' added"
 	}
 	return []bot_interface.Message{{Text: reply}, provideMainOptions()}, nil
@@ -174,7 +210,7 @@ func (env MessagingPlatform) GiveInstructionOnBudgeting(user bot_interface.BotRe
 
 	var options []bot_interface.Option
 	for key, value := range replyOptions {
-		options = append(options, bot_interface.Option{Id: key, Text: value})
+		options = append(options, bot_interface.Option{Id: key, Action: bot_interface.ActionTag, Text: value})
 	}
 
 	errSettingState := env.Storage.SetState(user.UserID, bot_interface.StateModifyBudget)
@@ -182,7 +218,7 @@ func (env MessagingPlatform) GiveInstructionOnBudgeting(user bot_interface.BotRe
 		log.Print(fmt.Errorf("error setting user state in GiveInstructionOnBudgeting: %v", errSettingState))
 		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, errSettingState
 	}
-	return []bot_interface.Message{{Text: textReply, Options: options}}, nil
+	return []bot_interface.Message{{Text: textReply, Options: options, Layout: tagChoiceLayout}}, nil
 }
 
 func (env MessagingPlatform) ConfirmSelectingBudgetTag(user bot_interface.BotRecipient, tag string) ([]bot_interface.Message, error) {
@@ -214,73 +250,136 @@ func (env MessagingPlatform) RecordBudgetRule(user bot_interface.BotRecipient, a
 	return append([]bot_interface.Message{{Text: fmt.Sprintf("Recorded: budget for '%s' is %.2f", selectedTag, amount)}}, secondMessage...), nil
 }
 
-func (env MessagingPlatform) GiveCurrentStatistics(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
-	firstOfMonth, nextMonth := monthInterval()
-	spending, err := env.Storage.GetMoneyEventsByDateInterval(firstOfMonth, nextMonth, user.UserID)
+// tagOptions gives top level of user's tags as keyboard options or default tags for those who didn't define any
+func (env MessagingPlatform) tagOptions(user bot_interface.BotRecipient) []bot_interface.Option {
+	return env.tagLevelOptions(user, "")
+}
+
+// knownTags are the tags user can type without selecting them from keyboard
+func (env MessagingPlatform) knownTags(user bot_interface.BotRecipient) []string {
+	acceptedTags, err := env.Storage.GetUserTags(user.UserID)
 	if err != nil {
-		log.Print(fmt.Errorf("error getting money events in GiveCurrentStatistics: %v", err))
-		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+		log.Print(fmt.Errorf("error getting tags in knownTags: %v", err))
 	}
-	spendingSums := make(map[string]float32)
-	for _, spendingItem := range spending {
-		spendingSums[spendingItem.Tag] += spendingItem.Amount
+	if len(acceptedTags) == 0 {
+		return defaultTagNames()
 	}
+	return acceptedTags
+}
 
-	targetSums := make(map[string]float32)
-	targets, err := env.Storage.GetTargets(firstOfMonth, nextMonth, user.UserID)
-	if err == nil {
-		for _, item := range targets {
-			targetSums[item.Tag] = item.Amount
-		}
-	} else {
-		log.Print(fmt.Errorf("error getting targets in GiveCurrentStatistics: %v", err))
-		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+// RecordExpense saves an expense typed as "<amount> [tag] [comment]". When the first word is not a known tag
+// all the words are a comment and the tag is chosen by user's categorization rules
+func (env MessagingPlatform) RecordExpense(user bot_interface.BotRecipient, amount float32, words []string) ([]bot_interface.Message, error) {
+	if len(words) == 0 {
+		return env.SetSpending(user, amount, "")
 	}
-	var resultTags []string
-	for key, value := range spendingSums {
-		if _, ok := targetSums[key]; ok {
-			if targetSums[key] < value {
-				resultTags = append(resultTags, fmt.Sprintf("%s: %.2f > %.2f !Warning!", key, value, targetSums[key]))
-			} else {
-				resultTags = append(resultTags, fmt.Sprintf("%s: %.2f <= %.2f OK", key, value, targetSums[key]))
-			}
-		} else {
-			resultTags = append(resultTags, fmt.Sprintf("%s: %.2f", key, value))
-		}
+	words = accountLast(words)
+	if count, rest := installments.Split(words); count > 0 {
+		return env.RecordInstallments(user, amount, count, rest)
+	}
+	tag, comment := splitTag(words, env.knownTags(user))
+	if tag != "" {
+		return env.SetSpendingWithTag(user, amount, tag, comment)
 	}
-	return []bot_interface.Message{{Text: strings.Join(resultTags, "\n")}, provideMainOptions()}, nil
+	if rule, found := env.findCategorizationRule(user, amount, comment); found {
+		return env.SetSpendingByRule(user, amount, comment, rule)
+	}
+	return env.SetSpending(user, amount, comment)
 }
 
-func (env MessagingPlatform) SetSpending(user bot_interface.BotRecipient, amount float32) ([]bot_interface.Message, error) {
-	err := env.Storage.SetState(user.UserID, fmt.Sprintf("%s %.2f", bot_interface.StateSpending, amount))
+func (env MessagingPlatform) SetSpending(user bot_interface.BotRecipient, amount float32, comment string) ([]bot_interface.Message, error) {
+	state := strings.TrimSpace(fmt.Sprintf("%s %.2f %s", bot_interface.StateSpending, amount, comment))
+	err := env.Storage.SetState(user.UserID, state)
 	if err != nil {
 		log.Print(fmt.Errorf("error setting user state in SetSpending: %v", err))
 		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
 	}
-	acceptedTags, err := env.Storage.GetUserTags(user.UserID)
+	return []bot_interface.Message{{Text: "For which category do I have to record this expense?", Options: env.suggestedTagOptions(user, amount, comment), Layout: tagChoiceLayout}}, nil
+}
+
+// saveSpending records the expense now. An account named in the comment like "@visa" is taken out of it
+func (env MessagingPlatform) saveSpending(user bot_interface.BotRecipient, amount float32, tag string, comment string) (storage_interface.MoneyEvent, error) {
+	account, comment := env.takeAccount(user, comment)
+	currency := "ARS"
+	if account.Currency != "" {
+		currency = account.Currency
+	}
+	events := []storage_interface.MoneyEvent{{Amount: amount, Currency: currency, Comment: comment, Tag: tag, Created: time.Now(), AccountID: account.ID}}
+	err := env.Storage.CreateMoneyEvents(events, user.UserID)
 	if err != nil {
-		log.Print(fmt.Errorf("error getting tags in SetSpending: %v", err))
+		return storage_interface.MoneyEvent{}, err
 	}
-	if len(acceptedTags) > 0 {
-		var options []bot_interface.Option
-		for _, acceptedTag := range acceptedTags {
-			options = append(options, bot_interface.Option{Text: acceptedTag, Id: "inline_" + acceptedTag})
-		}
-		return []bot_interface.Message{{Text: "For which category do I have to record this expense?", Options: options}}, nil
-	} else {
-		return []bot_interface.Message{{Text: "For which category do I have to record this expense?", Options: defaultTags}}, nil
+	env.updateSuggestions(user, nil, events)
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in saveSpending: %v", err))
 	}
+	return events[0], nil
 }
 
 func (env MessagingPlatform) SetSpendingWithTag(user bot_interface.BotRecipient, amount float32, tag string, comment string) ([]bot_interface.Message, error) {
-	err := env.Storage.CreateMoneyEvent(amount, "ARS", comment, tag, user.UserID)
+	// the number of installments stays in the comment while user chooses the tag
+	if count, rest := installments.Split(strings.Fields(comment)); count > 0 {
+		return env.SetInstallmentsWithTag(user, amount, count, tag, strings.Join(rest, " "))
+	}
+	event, err := env.saveSpending(user, amount, tag, comment)
 	if err != nil {
 		log.Print(fmt.Errorf("error creating money event in SetSpendingWithTag: %v", err))
 		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
 	}
+	text := fmt.Sprintf("Your expense is recorded:\n%.2f - %s", amount, tag) + env.accountNote(user, event)
+	return []bot_interface.Message{{Text: text, Reference: expenseReference(event.ID)}, provideMainOptions()}, nil
+}
+
+// SetSpendingByRule records an expense with the tag chosen by the rule and lets user change it with one tap
+func (env MessagingPlatform) SetSpendingByRule(user bot_interface.BotRecipient, amount float32, comment string, rule categorization.Rule) ([]bot_interface.Message, error) {
+	event, err := env.saveSpending(user, amount, rule.Tag, comment)
+	if err != nil {
+		log.Print(fmt.Errorf("error creating money event in SetSpendingByRule: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("Your expense is recorded:\n%.2f - %s (%s)\nTag is chosen by rule: %s", amount, rule.Tag, event.Comment, rule.Expression()) + env.accountNote(user, event)
+	options := []bot_interface.Option{{Action: bot_interface.ActionChangeTag, State: strconv.Itoa(event.ID), Text: "\xE2\x9C\x8Fchange", FullWidth: true}}
+	return []bot_interface.Message{{Text: text, Options: options, Reference: expenseReference(event.ID)}, provideMainOptions()}, nil
+}
+
+// ChooseNewTagForExpense shows tags keyboard to move already recorded expense to another tag
+func (env MessagingPlatform) ChooseNewTagForExpense(user bot_interface.BotRecipient, eventID string) ([]bot_interface.Message, error) {
+	err := env.Storage.SetState(user.UserID, fmt.Sprintf("%s %s", bot_interface.StateChangeTag, eventID))
+	if err != nil {
+		log.Print(fmt.Errorf("error setting user state in ChooseNewTagForExpense: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	return []bot_interface.Message{{Text: "Which category does this expense belong to?", Options: env.tagOptions(user), Layout: tagChoiceLayout}}, nil
+}
+
+func (env MessagingPlatform) ChangeExpenseTag(user bot_interface.BotRecipient, tag string) ([]bot_interface.Message, error) {
+	currentState, err := env.Storage.GetUserState(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting user state in ChangeExpenseTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	eventID, err := strconv.Atoi(trimStringFromFirstSpace(currentState))
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing expense id from state '%s' in ChangeExpenseTag: %v", currentState, err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	event, err := env.Storage.GetMoneyEvent(eventID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money event in ChangeExpenseTag: %v", err))
+		return []bot_interface.Message{{Text: "I didn't find the expense. Sorry"}}, nil
+	}
+	err = env.Storage.UpdateMoneyEventTag(eventID, tag, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error updating money event in ChangeExpenseTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	retagged := event
+	retagged.Tag = tag
+	env.updateSuggestions(user, []storage_interface.MoneyEvent{event}, []storage_interface.MoneyEvent{retagged})
 	err = env.Storage.SetState(user.UserID, "")
 	if err != nil {
-		log.Print(fmt.Errorf("error updating state in SetSpendingWithTag: %v", err))
+		log.Print(fmt.Errorf("error updating state in ChangeExpenseTag: %v", err))
 	}
-	return []bot_interface.Message{{Text: fmt.Sprintf("Your expense is recorded:\n%.2f - %s", amount, tag)}, provideMainOptions()}, nil
+	return []bot_interface.Message{{Text: "Expense moved to '" + tag + "'"}, provideMainOptions()}, nil
 }
@@ -0,0 +1,233 @@
+package speaking
+
+import (
+	"errors"
+	"fmt"
+	"ingresos_gastos/blobs"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// referenceExpense starts references of messages about an expense, a file sent in reply to them is attached to it
+const referenceExpense = "expense"
+
+var errNoBlobs = errors.New("blob store is not set")
+
+// attachableExtensions are the kinds of files kept with expenses: photos of receipts and PDF invoices
+var attachableExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".pdf": true}
+
+func expenseReference(eventID int) string {
+	return fmt.Sprintf("%s %d", referenceExpense, eventID)
+}
+
+func referencedExpense(reference string) (int, bool) {
+	kind, value := splitByFirstSpace(reference)
+	if kind != referenceExpense {
+		return 0, false
+	}
+	eventID, err := strconv.Atoi(value)
+	return eventID, err == nil
+}
+
+func isAttachable(name string) bool {
+	return attachableExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// saveAttachment puts the file into the blob store and links it with the expense
+func (env MessagingPlatform) saveAttachment(user bot_interface.BotRecipient, eventID int, file bot_interface.File) error {
+	if env.Blobs == nil {
+		return errNoBlobs
+	}
+	key := fmt.Sprintf("%d/%d/%d%s", user.UserID, eventID, time.Now().UnixNano(), strings.ToLower(filepath.Ext(file.Name)))
+	if err := env.Blobs.Put(key, file.Data); err != nil {
+		return err
+	}
+	_, err := env.Storage.SaveAttachment(storage_interface.Attachment{EventID: eventID, FileName: file.Name, BlobKey: key, UserID: user.UserID})
+	if err != nil {
+		if errDeleting := env.Blobs.Delete(key); errDeleting != nil {
+			log.Print(fmt.Errorf("error deleting blob in saveAttachment: %v", errDeleting))
+		}
+		return err
+	}
+	return nil
+}
+
+// receiveAttachment attaches the file to an expense when user sends it in reply to the message about the expense,
+// while editing the expense or with a caption like "1500 food" which records a new expense.
+// It doesn't handle other files and files which can't be attached, like statements to import
+func (env MessagingPlatform) receiveAttachment(user bot_interface.BotRecipient, file bot_interface.File, caption string) ([]bot_interface.Message, bool, error) {
+	if !isAttachable(file.Name) {
+		return nil, false, nil
+	}
+	if eventID, ok := referencedExpense(file.ReplyTo); ok {
+		messages, err := env.AttachToExpense(user, eventID, file)
+		return messages, true, err
+	}
+	userState, err := env.Storage.GetUserState(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting user state in receiveAttachment: %v", err))
+	} else if strings.HasPrefix(userState, bot_interface.StateEditExpense) {
+		if eventID, errParsing := strconv.Atoi(trimStringFromFirstSpace(userState)); errParsing == nil {
+			messages, err := env.AttachToExpense(user, eventID, file)
+			if err == nil {
+				edit, _ := env.StartEditingExpense(user, strconv.Itoa(eventID))
+				messages = append(messages[:1], edit...)
+			}
+			return messages, true, err
+		}
+	}
+	amount, words, err := splitExpenseInput(caption)
+	if err != nil {
+		return nil, false, nil
+	}
+	messages, err := env.RecordExpenseWithAttachment(user, amount, words, file)
+	return messages, true, err
+}
+
+// AttachToExpense keeps the photo or PDF with the expense
+func (env MessagingPlatform) AttachToExpense(user bot_interface.BotRecipient, eventID int, file bot_interface.File) ([]bot_interface.Message, error) {
+	if !isAttachable(file.Name) {
+		return []bot_interface.Message{{Text: "I can attach only photos and PDF files to expenses"}, provideMainOptions()}, nil
+	}
+	event, err := env.Storage.GetMoneyEvent(eventID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money event in AttachToExpense: %v", err))
+		return []bot_interface.Message{{Text: "I didn't find the expense. Sorry"}}, nil
+	}
+	err = env.saveAttachment(user, event.ID, file)
+	if err != nil {
+		log.Print(fmt.Errorf("error saving attachment in AttachToExpense: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("\xF0\x9F\x93\x8E%s is attached to the expense of %s: %s", file.Name, event.Created.Format("Mon, 2 Jan 2006"), expenseLine(event, ""))
+	return []bot_interface.Message{{Text: text, Reference: expenseReference(event.ID)}, provideMainOptions()}, nil
+}
+
+// RecordExpenseWithAttachment records the expense typed in the caption of the file and attaches the file to it.
+// The tag has to be in the caption or be chosen by a rule, there is no way to ask for it and keep the file
+func (env MessagingPlatform) RecordExpenseWithAttachment(user bot_interface.BotRecipient, amount float32, words []string, file bot_interface.File) ([]bot_interface.Message, error) {
+	if !isAttachable(file.Name) {
+		return []bot_interface.Message{{Text: "I can attach only photos and PDF files to expenses"}, provideMainOptions()}, nil
+	}
+	tag, comment := splitTag(accountLast(words), env.knownTags(user))
+	if tag == "" {
+		if rule, found := env.findCategorizationRule(user, amount, comment); found {
+			tag = rule.Tag
+		}
+	}
+	if tag == "" {
+		return []bot_interface.Message{{Text: "Please start the caption with the amount and one of your tags, like '1500 food', to record the expense with the file"}, provideMainOptions()}, nil
+	}
+	event, err := env.saveSpending(user, amount, tag, comment)
+	if err != nil {
+		log.Print(fmt.Errorf("error creating money event in RecordExpenseWithAttachment: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("Your expense is recorded:\n%.2f - %s", amount, tag)
+	if event.Comment != "" {
+		text += " (" + event.Comment + ")"
+	}
+	text += env.accountNote(user, event)
+	err = env.saveAttachment(user, event.ID, file)
+	if err != nil {
+		log.Print(fmt.Errorf("error saving attachment in RecordExpenseWithAttachment: %v", err))
+		text += "\nBut I couldn't keep the file, please send it again in reply to this message"
+	} else {
+		text += "\n\xF0\x9F\x93\x8E" + file.Name
+	}
+	return []bot_interface.Message{{Text: text, Reference: expenseReference(event.ID)}, provideMainOptions()}, nil
+}
+
+// SendAttachments gives back the files of the expense, pictures as photos and other files as documents
+func (env MessagingPlatform) SendAttachments(user bot_interface.BotRecipient, eventID string) ([]bot_interface.Message, error) {
+	event, err := env.expenseByID(user, eventID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money event in SendAttachments: %v", err))
+		return []bot_interface.Message{{Text: "I didn't find the expense. Sorry"}}, nil
+	}
+	attachments, err := env.Storage.GetAttachments(event.ID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting attachments in SendAttachments: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	if len(attachments) == 0 || env.Blobs == nil {
+		return []bot_interface.Message{{Text: "There are no files attached to this expense"}, provideMainOptions()}, nil
+	}
+	caption := fmt.Sprintf("%s: %s", event.Created.Format("Mon, 2 Jan 2006"), expenseLine(event, ""))
+	var messages []bot_interface.Message
+	for _, attachment := range attachments {
+		data, err := env.Blobs.Get(attachment.BlobKey)
+		if err != nil {
+			log.Print(fmt.Errorf("error getting blob of attachment %d in SendAttachments: %v", attachment.ID, err))
+			messages = append(messages, bot_interface.Message{Text: fmt.Sprintf("I couldn't find the file %s. Sorry", attachment.FileName)})
+			continue
+		}
+		file := &bot_interface.File{Name: attachment.FileName, Data: data}
+		if strings.HasPrefix(http.DetectContentType(data), "image/") {
+			messages = append(messages, bot_interface.Message{Text: caption, Photo: file})
+		} else {
+			messages = append(messages, bot_interface.Message{Text: caption, Document: file})
+		}
+	}
+	return append(messages, provideMainOptions()), nil
+}
+
+// deleteAttachments removes files of the expense from the blob store, their records go with the expense
+func (env MessagingPlatform) deleteAttachments(attachments []storage_interface.Attachment) {
+	if env.Blobs == nil {
+		return
+	}
+	for _, attachment := range attachments {
+		if err := env.Blobs.Delete(attachment.BlobKey); err != nil {
+			log.Print(fmt.Errorf("error deleting blob of attachment %d in deleteAttachments: %v", attachment.ID, err))
+		}
+	}
+}
+
+// pendingReceiptKey keeps the photo of a receipt until user chooses its tag, a new receipt replaces it
+func pendingReceiptKey(user bot_interface.BotRecipient) string {
+	return fmt.Sprintf("%d/pending-receipt", user.UserID)
+}
+
+// keepReceiptPhoto saves the photo of the receipt to attach it to the expense when it is recorded
+func (env MessagingPlatform) keepReceiptPhoto(user bot_interface.BotRecipient, photo bot_interface.File) {
+	if env.Blobs == nil || !isAttachable(photo.Name) {
+		return
+	}
+	if err := env.Blobs.Put(pendingReceiptKey(user), photo.Data); err != nil {
+		log.Print(fmt.Errorf("error keeping photo of receipt in keepReceiptPhoto: %v", err))
+	}
+}
+
+// attachReceiptPhoto attaches the photo kept by keepReceiptPhoto to the expense of the receipt
+func (env MessagingPlatform) attachReceiptPhoto(user bot_interface.BotRecipient, eventID int) bool {
+	if env.Blobs == nil {
+		return false
+	}
+	data, err := env.Blobs.Get(pendingReceiptKey(user))
+	if errors.Is(err, blobs.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		log.Print(fmt.Errorf("error getting photo of receipt in attachReceiptPhoto: %v", err))
+		return false
+	}
+	name := "receipt.jpg"
+	if http.DetectContentType(data) == "image/png" {
+		name = "receipt.png"
+	}
+	if err = env.saveAttachment(user, eventID, bot_interface.File{Name: name, Data: data}); err != nil {
+		log.Print(fmt.Errorf("error attaching photo of receipt in attachReceiptPhoto: %v", err))
+		return false
+	}
+	if err = env.Blobs.Delete(pendingReceiptKey(user)); err != nil {
+		log.Print(fmt.Errorf("error deleting photo of receipt in attachReceiptPhoto: %v", err))
+	}
+	return true
+}
@@ -0,0 +1,256 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// addAccountWord starts arguments of the balances command which add an account, like "add cash cash 20000"
+const addAccountWord = "add"
+
+// accountKinds are kinds of accounts added by the balances command with their signs, cards are added by the cards command
+var accountKinds = []struct {
+	kind string
+	sign string
+}{
+	{storage_interface.AccountCash, "\xF0\x9F\x92\xB5"},
+	{storage_interface.AccountBank, "\xF0\x9F\x8F\xA6"},
+	{storage_interface.AccountWallet, "\xF0\x9F\x93\xB1"},
+	{storage_interface.AccountSavings, "\xF0\x9F\x92\xB0"},
+	{storage_interface.AccountCard, "\xF0\x9F\x92\xB3"},
+}
+
+// accountSign is the emoji of the kind of the account
+func accountSign(account storage_interface.Account) string {
+	for _, known := range accountKinds {
+		if known.kind == account.Kind {
+			return known.sign
+		}
+	}
+	return ""
+}
+
+// GiveBalances shows the balance of every account or adds an account when arguments are like
+// "add mp wallet 15000": the name, the kind, the balance it has now and optionally its currency
+func (env MessagingPlatform) GiveBalances(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	words := strings.Fields(arguments)
+	if len(words) > 0 && strings.EqualFold(words[0], addAccountWord) {
+		return env.AddAccount(user, words[1:])
+	}
+	balances, main, err := env.balances(user)
+	if err != nil {
+		log.Print(fmt.Errorf("error counting balances in GiveBalances: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	if len(balances) == 0 {
+		text := fmt.Sprintf("You have no accounts yet. Add one with the money it has now, like '/%s %s cash cash 20000' or '/%s %s dollars savings 1500 USD'.\nKinds of accounts are %s, %s, %s and %s, credit cards are added by /%s",
+			bot_interface.CommandBalances, addAccountWord, bot_interface.CommandBalances, addAccountWord,
+			storage_interface.AccountCash, storage_interface.AccountBank, storage_interface.AccountWallet, storage_interface.AccountSavings, bot_interface.CommandCards)
+		return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+	}
+	lines := []string{"Balances of your accounts:"}
+	for _, balance := range balances {
+		lines = append(lines, balanceLine(balance))
+	}
+	if main.ID != 0 {
+		lines = append(lines, fmt.Sprintf("\nExpenses which name no account are paid from %s", main.Name))
+	}
+	lines = append(lines, fmt.Sprintf("Move money between accounts by /%s, like '/%s 50000 %sbank %scash atm'", bot_interface.CommandTransfer,
+		bot_interface.CommandTransfer, accountMark, accountMark))
+	return []bot_interface.Message{{Text: strings.Join(lines, "\n")}, provideMainOptions()}, nil
+}
+
+// balanceLine shows the balance with the kind, name and currency of its account
+func balanceLine(balance reports.Balance) string {
+	return fmt.Sprintf("%s%s: %.2f %s", accountSign(balance.Account), balance.Account.Name, balance.Amount, balance.Account.Currency)
+}
+
+// balances counts balances of user's accounts till now, it gives the main account too
+func (env MessagingPlatform) balances(user bot_interface.BotRecipient) ([]reports.Balance, storage_interface.Account, error) {
+	accounts, err := env.Storage.GetAccounts(user.UserID)
+	if err != nil || len(accounts) == 0 {
+		return nil, storage_interface.Account{}, err
+	}
+	start := accounts[0].Created
+	for _, account := range accounts {
+		if account.Created.Before(start) {
+			start = account.Created
+		}
+	}
+	now := time.Now()
+	events, err := env.Storage.GetMoneyEventsByDateInterval(start, now, user.UserID)
+	if err != nil {
+		return nil, storage_interface.Account{}, err
+	}
+	transfers, err := env.Storage.GetTransfersByDateInterval(start, now, user.UserID)
+	if err != nil {
+		return nil, storage_interface.Account{}, err
+	}
+	main, _ := reports.MainAccount(accounts)
+	return reports.NewBalances(accounts, main.ID, events, transfers), main, nil
+}
+
+// AddAccount creates an account from its name, kind, the balance it has now and its currency
+func (env MessagingPlatform) AddAccount(user bot_interface.BotRecipient, words []string) ([]bot_interface.Message, error) {
+	usage := fmt.Sprintf("Please type the name of the account, its kind (%s, %s, %s or %s), the money it has now and its currency if it is not ARS, like '/%s %s dollars savings 1500 USD'",
+		storage_interface.AccountCash, storage_interface.AccountBank, storage_interface.AccountWallet, storage_interface.AccountSavings,
+		bot_interface.CommandBalances, addAccountWord)
+	if len(words) < 2 || len(words) > 4 {
+		return []bot_interface.Message{{Text: usage}}, nil
+	}
+	account := storage_interface.Account{Name: strings.TrimPrefix(words[0], accountMark), Kind: strings.ToLower(words[1]), Currency: "ARS", UserID: user.UserID}
+	if account.Kind == storage_interface.AccountCard {
+		return []bot_interface.Message{{Text: fmt.Sprintf("Cards have statements, please add them by /%s", bot_interface.CommandCards)}}, nil
+	}
+	if account.Name == "" || accountSign(account) == "" {
+		return []bot_interface.Message{{Text: usage}}, nil
+	}
+	for _, word := range words[2:] {
+		if amount, ok := parseAmount(word); ok {
+			account.Opening = amount
+		} else if isCurrency(word) {
+			account.Currency = strings.ToUpper(word)
+		} else {
+			return []bot_interface.Message{{Text: usage}}, nil
+		}
+	}
+	accounts, err := env.Storage.GetAccounts(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting accounts in AddAccount: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	if _, exists := findAccount(accounts, account.Name); exists {
+		return []bot_interface.Message{{Text: fmt.Sprintf("You already have an account named %s", account.Name)}}, nil
+	}
+	if _, err = env.Storage.CreateAccount(account); err != nil {
+		log.Print(fmt.Errorf("error creating account in AddAccount: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("Account %s%s is added with %.2f %s.\nAdd '%s%s' to expenses paid from it, like '5000 food %s%s'",
+		accountSign(account), account.Name, account.Opening, account.Currency, accountMark, account.Name, accountMark, account.Name)
+	if _, hasMain := reports.MainAccount(accounts); !hasMain && account.Currency == reports.Currency {
+		text += ", expenses without an account are paid from it too"
+	}
+	return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+}
+
+// RecordTransfer moves money between accounts. Arguments are like "50000 @bank @cash atm": the amount, the account
+// it leaves and the account it comes to. When currencies differ the amount received follows the accounts, like
+// "120000 @cash @dollars 100". With one account the money comes to it from outside, like "800000 @bank salary"
+func (env MessagingPlatform) RecordTransfer(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	usage := fmt.Sprintf("Please type the amount, the account it leaves and the account it comes to, like '/%s 50000 %sbank %scash atm'.\nFor buying dollars add how many you got: '/%s 120000 %scash %sdollars 100'.\nWith one account the money comes to it, like '/%s 800000 %sbank salary'",
+		bot_interface.CommandTransfer, accountMark, accountMark, bot_interface.CommandTransfer, accountMark, accountMark, bot_interface.CommandTransfer, accountMark)
+	accounts, err := env.Storage.GetAccounts(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting accounts in RecordTransfer: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	var amount float32
+	var named []storage_interface.Account
+	var rest []string
+	for _, word := range strings.Fields(arguments) {
+		if strings.HasPrefix(word, accountMark) && len(word) > len(accountMark) {
+			account, ok := findAccount(accounts, strings.TrimPrefix(word, accountMark))
+			if !ok {
+				return []bot_interface.Message{{Text: fmt.Sprintf("You have no account %s, see your accounts by /%s", word, bot_interface.CommandBalances)}}, nil
+			}
+			named = append(named, account)
+			continue
+		}
+		if value, ok := parseAmount(word); ok && value > 0 && amount == 0 && len(rest) == 0 {
+			amount = value
+			continue
+		}
+		rest = append(rest, word)
+	}
+	if amount == 0 || len(named) == 0 || len(named) > 2 {
+		return []bot_interface.Message{{Text: usage}}, nil
+	}
+	transfer := storage_interface.Transfer{Amount: amount, Received: amount, Created: time.Now(), UserID: user.UserID}
+	to := named[len(named)-1]
+	transfer.ToAccountID = to.ID
+	text := fmt.Sprintf("%.2f %s came to %s", transfer.Received, to.Currency, to.Name)
+	if len(named) == 2 {
+		from := named[0]
+		if from.ID == to.ID {
+			return []bot_interface.Message{{Text: usage}}, nil
+		}
+		transfer.FromAccountID = from.ID
+		text = fmt.Sprintf("%.2f %s moved from %s to %s", transfer.Amount, from.Currency, from.Name, to.Name)
+		// the amount received is read only when currencies differ, otherwise a number after the accounts is a part of the comment
+		if from.Currency != to.Currency {
+			var received float32
+			var ok bool
+			if len(rest) > 0 {
+				received, ok = parseAmount(rest[0])
+			}
+			if !ok || received <= 0 {
+				return []bot_interface.Message{{Text: fmt.Sprintf("How many %s did you get for %.2f %s? Please type it after the accounts, like '/%s %s %s%s %s%s 100'",
+					to.Currency, transfer.Amount, from.Currency, bot_interface.CommandTransfer, formatAmount(transfer.Amount), accountMark, from.Name, accountMark, to.Name)}}, nil
+			}
+			transfer.Received = received
+			rest = rest[1:]
+			text = fmt.Sprintf("%.2f %s from %s became %.2f %s in %s, the rate is %s", transfer.Amount, from.Currency, from.Name,
+				transfer.Received, to.Currency, to.Name, exchangeRate(transfer.Amount, transfer.Received))
+		}
+	}
+	transfer.Comment = strings.Join(rest, " ")
+	if _, err = env.Storage.CreateTransfer(transfer); err != nil {
+		log.Print(fmt.Errorf("error creating transfer in RecordTransfer: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	lines := []string{"Your transfer is recorded:", text}
+	if balances, _, err := env.balances(user); err == nil {
+		for _, balance := range balances {
+			if balance.Account.ID == transfer.FromAccountID || balance.Account.ID == transfer.ToAccountID {
+				lines = append(lines, balanceLine(balance))
+			}
+		}
+	} else {
+		log.Print(fmt.Errorf("error counting balances in RecordTransfer: %v", err))
+	}
+	return []bot_interface.Message{{Text: strings.Join(lines, "\n")}, provideMainOptions()}, nil
+}
+
+// parseAmount reads a number typed by user, words like "nan" and "infinity" are not amounts
+func parseAmount(word string) (float32, bool) {
+	amount, err := strconv.ParseFloat(word, 32)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, false
+	}
+	return float32(amount), true
+}
+
+// formatAmount writes the amount the way user types it, without needless decimals
+func formatAmount(amount float32) string {
+	return strconv.FormatFloat(float64(amount), 'f', -1, 32)
+}
+
+// isCurrency tells whether the word looks like a currency code, like USD
+func isCurrency(word string) bool {
+	if len(word) != 3 {
+		return false
+	}
+	for _, letter := range word {
+		if !unicode.IsLetter(letter) {
+			return false
+		}
+	}
+	return true
+}
+
+// exchangeRate shows how much of one currency is given for a unit of the other, whichever of them is bigger
+func exchangeRate(amount, received float32) string {
+	if received >= amount {
+		return fmt.Sprintf("1 : %.2f", received/amount)
+	}
+	return fmt.Sprintf("%.2f : 1", amount/received)
+}
@@ -0,0 +1,157 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/cards"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// addCardWord starts arguments of the cards command which add a card, like "add visa 25 10"
+const addCardWord = "add"
+
+// GiveCards lists credit cards with their open statements and the next payments or adds a card
+// when arguments are like "add visa 25 10": the name, the closing day and the due day
+func (env MessagingPlatform) GiveCards(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	words := strings.Fields(arguments)
+	if len(words) > 0 && strings.EqualFold(words[0], addCardWord) {
+		return env.AddCard(user, words[1:])
+	}
+	accounts, err := env.Storage.GetAccounts(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting accounts in GiveCards: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	now := time.Now()
+	var blocks []string
+	var options []bot_interface.Option
+	for _, card := range accounts {
+		if card.Kind != storage_interface.AccountCard {
+			continue
+		}
+		open := cards.CycleOf(card.ClosingDay, card.DueDay, now)
+		next := cards.NextDue(card.ClosingDay, card.DueDay, now)
+		events, err := env.Storage.GetMoneyEventsByDateInterval(open.Previous().Start, open.End, user.UserID)
+		if err != nil {
+			log.Print(fmt.Errorf("error getting money events in GiveCards: %v", err))
+			return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+		}
+		lines := []string{
+			fmt.Sprintf("\xF0\x9F\x92\xB3%s: closes on day %d, due on day %d", card.Name, card.ClosingDay, card.DueDay),
+			fmt.Sprintf("Open statement till %s: %.2f", open.Closing().Format("Mon, 2 Jan"), statementTotal(events, card, open)),
+		}
+		if next.End.Equal(open.End) {
+			lines = append(lines, fmt.Sprintf("Next payment on %s is the open statement", next.Due.Format("Mon, 2 Jan")))
+		} else {
+			lines = append(lines, fmt.Sprintf("Next payment on %s: %.2f", next.Due.Format("Mon, 2 Jan"), statementTotal(events, card, next)))
+		}
+		blocks = append(blocks, strings.Join(lines, "\n"))
+		options = append(options, bot_interface.Option{Id: statementValue(card, open), Action: bot_interface.ActionCardStatement, Text: "\xF0\x9F\x93\x84" + card.Name})
+	}
+	if len(blocks) == 0 {
+		text := fmt.Sprintf("You have no cards yet. Add one with its closing and due days like '/%s %s visa 25 10', then add '@visa' to expenses paid with it, like '5000 food @visa'",
+			bot_interface.CommandCards, addCardWord)
+		return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+	}
+	text := strings.Join(blocks, "\n\n") + "\n\nSelect a card to see expenses of its statements"
+	return []bot_interface.Message{{Text: text, Options: options}, provideMainOptions()}, nil
+}
+
+// AddCard creates a card from its name, closing day and due day
+func (env MessagingPlatform) AddCard(user bot_interface.BotRecipient, words []string) ([]bot_interface.Message, error) {
+	usage := fmt.Sprintf("Please type the name of the card, the day its statements close and the day they are due, like '/%s %s visa 25 10'", bot_interface.CommandCards, addCardWord)
+	if len(words) != 3 {
+		return []bot_interface.Message{{Text: usage}}, nil
+	}
+	name := strings.TrimPrefix(words[0], accountMark)
+	closingDay, errClosing := strconv.Atoi(words[1])
+	dueDay, errDue := strconv.Atoi(words[2])
+	if name == "" || errClosing != nil || errDue != nil || closingDay < 1 || closingDay > 31 || dueDay < 1 || dueDay > 31 {
+		return []bot_interface.Message{{Text: usage}}, nil
+	}
+	accounts, err := env.Storage.GetAccounts(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting accounts in AddCard: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	if _, exists := findAccount(accounts, name); exists {
+		return []bot_interface.Message{{Text: fmt.Sprintf("You already have an account named %s", name)}}, nil
+	}
+	card := storage_interface.Account{Name: name, Kind: storage_interface.AccountCard, Currency: "ARS", ClosingDay: closingDay, DueDay: dueDay, UserID: user.UserID}
+	if _, err = env.Storage.CreateAccount(card); err != nil {
+		log.Print(fmt.Errorf("error creating account in AddCard: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("Card %s is added: its statements close on day %d and are due on day %d.\nAdd '%s%s' to expenses paid with it, like '5000 food %s%s'",
+		name, closingDay, dueDay, accountMark, name, accountMark, name)
+	return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+}
+
+// statementValue packs what [MessagingPlatform.ShowCardStatement] needs into a button value: the card and the closing day
+func statementValue(card storage_interface.Account, cycle cards.Cycle) string {
+	return fmt.Sprintf("%d %s", card.ID, cycle.Closing().Format(time.DateOnly))
+}
+
+// statementTotal sums expenses of the card which land on the statement
+func statementTotal(events []storage_interface.MoneyEvent, card storage_interface.Account, cycle cards.Cycle) float32 {
+	var total float32
+	for _, event := range events {
+		if event.AccountID == card.ID && cycle.Contains(event.Created) {
+			total += event.Amount
+		}
+	}
+	return total
+}
+
+// ShowCardStatement lists expenses of a statement of the card. The value is "<card id> <closing day>"
+func (env MessagingPlatform) ShowCardStatement(user bot_interface.BotRecipient, value string) ([]bot_interface.Message, error) {
+	idText, dayText := splitByFirstSpace(value)
+	cardID, errID := strconv.Atoi(idText)
+	day, errDay := time.ParseInLocation(time.DateOnly, dayText, time.Local)
+	if errID != nil || errDay != nil {
+		log.Print(fmt.Errorf("error parsing statement request '%s' in ShowCardStatement: %v %v", value, errID, errDay))
+		return []bot_interface.Message{{Text: "I didn't recognize the command. Sorry"}}, nil
+	}
+	accounts, err := env.Storage.GetAccounts(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting accounts in ShowCardStatement: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	var card storage_interface.Account
+	for _, account := range accounts {
+		if account.ID == cardID && account.Kind == storage_interface.AccountCard {
+			card = account
+		}
+	}
+	if card.ID == 0 {
+		return []bot_interface.Message{{Text: "I didn't find the card. Sorry"}}, nil
+	}
+	cycle := cards.CycleOf(card.ClosingDay, card.DueDay, day)
+	events, err := env.Storage.GetMoneyEventsByDateInterval(cycle.Start, cycle.End, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money events in ShowCardStatement: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	var lines []string
+	for _, event := range events {
+		if event.AccountID == card.ID && cycle.Contains(event.Created) {
+			lines = append(lines, fmt.Sprintf("%s: %.2f %s %s", event.Created.Format("Mon, 2 Jan"), event.Amount, event.Tag, event.Comment))
+		}
+	}
+	title := fmt.Sprintf("\xF0\x9F\x92\xB3%s statement from %s to %s, due %s", card.Name,
+		cycle.Start.Format("2 Jan"), cycle.Closing().Format("2 Jan 2006"), cycle.Due.Format("Mon, 2 Jan"))
+	text := title + "\n\nNo expenses on this statement"
+	if len(lines) > 0 {
+		text = fmt.Sprintf("%s\n\n%s\n\nTotal: %.2f", title, strings.Join(lines, "\n"), statementTotal(events, card, cycle))
+	}
+	options := []bot_interface.Option{
+		{Id: statementValue(card, cycle.Previous()), Action: bot_interface.ActionCardStatement, Text: "\xE2\x97\x80" + cycle.Previous().Closing().Format("Jan 2006")},
+		{Id: statementValue(card, cycle.Next()), Action: bot_interface.ActionCardStatement, Text: cycle.Next().Closing().Format("Jan 2006") + "\xE2\x96\xB6"},
+		{Id: bot_interface.CommandCards, Action: bot_interface.ActionCommand, Text: "\xE2\xAC\x85cards", FullWidth: true},
+	}
+	return []bot_interface.Message{{Text: text, Options: options}, provideMainOptions()}, nil
+}
@@ -0,0 +1,67 @@
+package speaking
+
+import (
+	"errors"
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/charts"
+	"ingresos_gastos/reports"
+	"log"
+	"time"
+)
+
+// GiveCharts draws spending of a period typed as arguments like "2024-03": a pie by tags, budget vs actual bars
+// and the running total against the budget pace. Charts without data are skipped
+func (env MessagingPlatform) GiveCharts(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	now := time.Now()
+	period, err := reports.ParsePeriod(arguments, now)
+	if errors.Is(err, reports.ErrPeriodFormat) {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't understand the period '%s'. Try one of: %s", arguments, reports.PeriodExamples)}}, nil
+	}
+	spending, err := env.Storage.GetMoneyEventsByDateInterval(period.Start, period.End, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money events in GiveCharts: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	targets, err := env.Storage.GetTargets(period.Start, period.End, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting targets in GiveCharts: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in GiveCharts: %v", err))
+	}
+	report := reports.NewBudgetReport(tags, spending, targets, period.Start, period.End, now)
+
+	var slices []charts.Slice
+	var bars []charts.Bar
+	for _, node := range report.Tags {
+		slices = append(slices, charts.Slice{Label: node.Name, Value: node.Total, Color: node.Color})
+		if budget, ok := node.Budget(); ok {
+			bars = append(bars, charts.Bar{Label: node.Name, Actual: node.Total, Budget: budget, Color: node.Color})
+		}
+	}
+	var messages []bot_interface.Message
+	addChart := func(name, caption string, data []byte, errDrawing error) {
+		if errDrawing == nil {
+			messages = append(messages, bot_interface.Message{Text: caption, Photo: &bot_interface.File{Name: name + ".png", Data: data}})
+		} else if !errors.Is(errDrawing, charts.ErrNoData) {
+			log.Print(fmt.Errorf("error drawing %s chart in GiveCharts: %v", name, errDrawing))
+		}
+	}
+	data, errDrawing := charts.Pie("Spending "+period.String(), slices)
+	addChart("spending", "Spending by tags, "+period.Title(), data, errDrawing)
+	data, errDrawing = charts.BudgetBars("Budget vs actual "+period.String(), bars)
+	addChart("budget", "Budget vs actual, "+period.Title(), data, errDrawing)
+	var budget float32
+	if report.HasBudget {
+		budget = report.Budget
+	}
+	data, errDrawing = charts.PaceLine("Spent by day "+period.String(), reports.DailyCumulative(spending, period, now), period.Days(), budget)
+	addChart("pace", "Running total against the budget pace, "+period.Title(), data, errDrawing)
+	if len(messages) == 0 {
+		return []bot_interface.Message{{Text: "Nothing to draw for " + period.Title()}, provideMainOptions()}, nil
+	}
+	return append(messages, provideMainOptions()), nil
+}
@@ -0,0 +1,296 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	expensesPerPage = 10
+	// confirmDeleting is the state of the delete button which deletes the expense without asking again
+	confirmDeleting = "yes"
+)
+
+// expensesValue packs what [MessagingPlatform.ShowTagExpenses] needs into a button value
+func expensesValue(period reports.Period, tag string, page int) string {
+	return fmt.Sprintf("%s %s %d", period, tag, page)
+}
+
+// tagExpensesOptions open expenses of every tag of the statistics
+func tagExpensesOptions(period reports.Period, nodes []*reports.TagNode) []bot_interface.Option {
+	var options []bot_interface.Option
+	for _, node := range reports.Flatten(nodes) {
+		if node.Name == "" || node.Total == 0 {
+			continue
+		}
+		options = append(options, bot_interface.Option{Id: expensesValue(period, node.Name, 0), Action: bot_interface.ActionExpenses, Text: node.Label()})
+	}
+	return options
+}
+
+// ShowTagExpenses lists expenses of the tag and the tags inside it for the period day by day with edit and delete buttons.
+// The value is "<period> <tag> <page>"
+func (env MessagingPlatform) ShowTagExpenses(user bot_interface.BotRecipient, value string) ([]bot_interface.Message, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		log.Print(fmt.Errorf("error parsing expenses request '%s' in ShowTagExpenses", value))
+		return []bot_interface.Message{{Text: "I didn't recognize the command. Sorry"}}, nil
+	}
+	period, errPeriod := reports.ParsePeriod(fields[0], time.Now())
+	page, errPage := strconv.Atoi(fields[2])
+	if errPeriod != nil || errPage != nil || page < 0 {
+		log.Print(fmt.Errorf("error parsing expenses request '%s' in ShowTagExpenses: %v %v", value, errPeriod, errPage))
+		return []bot_interface.Message{{Text: "I didn't recognize the command. Sorry"}}, nil
+	}
+	tag := fields[1]
+	events, err := env.Storage.GetMoneyEventsByDateInterval(period.Start, period.End, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money events in ShowTagExpenses: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in ShowTagExpenses: %v", err))
+	}
+	var tagEvents []storage_interface.MoneyEvent
+	var total float32
+	daySums := make(map[string]float32)
+	for _, event := range events {
+		if event.Tag == tag || isTagInside(tags, event.Tag, tag) {
+			tagEvents = append(tagEvents, event)
+			if reports.Countable(event) {
+				total += event.Amount
+				daySums[event.Created.Format(time.DateOnly)] += event.Amount
+			}
+		}
+	}
+	label := tag
+	if storedTag, ok := storage_interface.FindTag(tags, tag); ok {
+		label = tagLabel(storedTag)
+	}
+	back := bot_interface.Option{Id: period.String(), Action: bot_interface.ActionStatistics, Text: "\xE2\xAC\x85statistics", FullWidth: true}
+	if len(tagEvents) == 0 {
+		return []bot_interface.Message{{Text: fmt.Sprintf("No expenses for %s in %s", label, period.Title()), Options: []bot_interface.Option{back}}}, nil
+	}
+	pages := (len(tagEvents) + expensesPerPage - 1) / expensesPerPage
+	if page >= pages {
+		page = pages - 1
+	}
+	lines := []string{fmt.Sprintf("%s, %s: %d expenses, %.2f", label, period.Title(), len(tagEvents), total)}
+	var options, attachmentOptions []bot_interface.Option
+	lastDay := ""
+	end := (page + 1) * expensesPerPage
+	if end > len(tagEvents) {
+		end = len(tagEvents)
+	}
+	var pageIDs []int
+	for _, event := range tagEvents[page*expensesPerPage : end] {
+		pageIDs = append(pageIDs, event.ID)
+	}
+	attached, err := env.Storage.CountAttachments(pageIDs, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error counting attachments in ShowTagExpenses: %v", err))
+	}
+	for i := page * expensesPerPage; i < end; i++ {
+		event := tagEvents[i]
+		if day := event.Created.Format(time.DateOnly); day != lastDay {
+			lines = append(lines, "", fmt.Sprintf("%s: %.2f", event.Created.Format("Mon, 2 Jan"), daySums[day]))
+			lastDay = day
+		}
+		line := fmt.Sprintf("%d. %s", i+1, expenseLine(event, tag))
+		eventID := strconv.Itoa(event.ID)
+		options = append(options,
+			bot_interface.Option{Id: eventID, Action: bot_interface.ActionEditExpense, Text: fmt.Sprintf("\xE2\x9C\x8F%d", i+1)},
+			bot_interface.Option{Id: eventID, Action: bot_interface.ActionDeleteExpense, Text: fmt.Sprintf("\xE2\x9D\x8C%d", i+1)})
+		if attached[event.ID] > 0 {
+			line += " \xF0\x9F\x93\x8E"
+			attachmentOptions = append(attachmentOptions, bot_interface.Option{Id: eventID, Action: bot_interface.ActionAttachments, Text: fmt.Sprintf("\xF0\x9F\x93\x8E%d", i+1)})
+		}
+		lines = append(lines, line)
+	}
+	// files go after edit and delete buttons, so those keep two expenses in a row
+	options = append(options, attachmentOptions...)
+	if page > 0 {
+		options = append(options, bot_interface.Option{Id: expensesValue(period, tag, page-1), Action: bot_interface.ActionExpenses, Text: "\xE2\x97\x80previous", FullWidth: true})
+	}
+	if page < pages-1 {
+		options = append(options, bot_interface.Option{Id: expensesValue(period, tag, page+1), Action: bot_interface.ActionExpenses, Text: "next\xE2\x96\xB6", FullWidth: true})
+	}
+	options = append(options, back)
+	if pages > 1 {
+		lines = append(lines, "", fmt.Sprintf("Page %d of %d", page+1, pages))
+	}
+	layout := bot_interface.Layout{Columns: 4, PageSize: len(options)}
+	return []bot_interface.Message{{Text: strings.Join(lines, "\n"), Options: options, Layout: layout}}, nil
+}
+
+// expenseLine is the amount and the comment of the expense. The tag is shown too when it is not the one listed
+func expenseLine(event storage_interface.MoneyEvent, listedTag string) string {
+	line := fmt.Sprintf("%.2f", event.Amount)
+	if event.Tag != listedTag {
+		line += " [" + event.Tag + "]"
+	}
+	if event.Comment != "" {
+		line += " " + event.Comment
+	}
+	return line
+}
+
+// StartEditingExpense asks for a new amount and comment of the expense or lets user move it to another tag
+func (env MessagingPlatform) StartEditingExpense(user bot_interface.BotRecipient, eventID string) ([]bot_interface.Message, error) {
+	event, err := env.expenseByID(user, eventID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money event in StartEditingExpense: %v", err))
+		return []bot_interface.Message{{Text: "I didn't find the expense. Sorry"}}, nil
+	}
+	err = env.Storage.SetState(user.UserID, fmt.Sprintf("%s %d", bot_interface.StateEditExpense, event.ID))
+	if err != nil {
+		log.Print(fmt.Errorf("error setting user state in StartEditingExpense: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("Expense of %s: %s\nType a new amount and comment like '450 coffee with milk', change its tag or send a photo or a PDF to attach it",
+		event.Created.Format("Mon, 2 Jan 2006"), expenseLine(event, ""))
+	if event.PurchaseID != 0 {
+		text = fmt.Sprintf("Installment of %s: %s\nType the same amount with a new comment, change its tag or send a photo or a PDF to attach it. "+
+			"Installments keep the total of their purchase, to change the amount delete the purchase and record it again",
+			event.Created.Format("Mon, 2 Jan 2006"), expenseLine(event, ""))
+	}
+	options := []bot_interface.Option{{Action: bot_interface.ActionChangeTag, State: strconv.Itoa(event.ID), Text: "\xE2\x9C\x8Fchange tag"}}
+	attachments, err := env.Storage.GetAttachments(event.ID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting attachments in StartEditingExpense: %v", err))
+	}
+	if len(attachments) > 0 {
+		var names []string
+		for _, attachment := range attachments {
+			names = append(names, attachment.FileName)
+		}
+		text += "\n\xF0\x9F\x93\x8E" + strings.Join(names, ", ")
+		options = append(options, bot_interface.Option{Id: strconv.Itoa(event.ID), Action: bot_interface.ActionAttachments, Text: "\xF0\x9F\x93\x8Efiles"})
+	}
+	return []bot_interface.Message{{Text: text, Options: options, Layout: bot_interface.Layout{WithFinishOption: true}, Reference: expenseReference(event.ID)}}, nil
+}
+
+// EditExpense saves a new amount and comment typed for the expense remembered in state.
+// When only the amount is typed the comment stays the same
+func (env MessagingPlatform) EditExpense(user bot_interface.BotRecipient, userState string, text string) ([]bot_interface.Message, error) {
+	event, err := env.expenseByID(user, trimStringFromFirstSpace(userState))
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money event from state '%s' in EditExpense: %v", userState, err))
+		return []bot_interface.Message{{Text: "I didn't find the expense. Sorry"}}, nil
+	}
+	amount, words, err := splitExpenseInput(text)
+	if err != nil {
+		return []bot_interface.Message{{Text: "I can't understand your number, please enter correct number"}}, nil
+	}
+	if event.PurchaseID != 0 && amount != event.Amount {
+		text := fmt.Sprintf("Installments keep the total of their purchase, so the amount of one of them can't be changed. "+
+			"Type %.2f to change only the comment or delete the purchase and record it again", event.Amount)
+		return []bot_interface.Message{{Text: text}}, nil
+	}
+	comment := event.Comment
+	if len(words) > 0 {
+		comment = strings.Join(words, " ")
+	}
+	err = env.Storage.UpdateMoneyEvent(event.ID, amount, comment, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error updating money event in EditExpense: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in EditExpense: %v", err))
+	}
+	edited := event
+	edited.Amount, edited.Comment = amount, comment
+	env.updateSuggestions(user, []storage_interface.MoneyEvent{event}, []storage_interface.MoneyEvent{edited})
+	event = edited
+	return []bot_interface.Message{{Text: "Expense updated: " + expenseLine(event, "")}, provideMainOptions()}, nil
+}
+
+// DeleteExpense asks to confirm deleting of the expense and deletes it when confirmed
+func (env MessagingPlatform) DeleteExpense(user bot_interface.BotRecipient, eventID string, confirmation string) ([]bot_interface.Message, error) {
+	event, err := env.expenseByID(user, eventID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money event in DeleteExpense: %v", err))
+		return []bot_interface.Message{{Text: "I didn't find the expense. Sorry"}}, nil
+	}
+	if event.PurchaseID != 0 {
+		return env.deletePurchase(user, event, confirmation)
+	}
+	if confirmation != confirmDeleting {
+		text := fmt.Sprintf("Delete the expense of %s: %s?", event.Created.Format("Mon, 2 Jan 2006"), expenseLine(event, ""))
+		options := []bot_interface.Option{{Id: eventID, Action: bot_interface.ActionDeleteExpense, State: confirmDeleting, Text: "\xE2\x9D\x8Cdelete"}}
+		return []bot_interface.Message{{Text: text, Options: options}}, nil
+	}
+	attachments, err := env.Storage.GetAttachments(event.ID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting attachments in DeleteExpense: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	err = env.Storage.DeleteMoneyEvent(event.ID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error deleting money event in DeleteExpense: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	env.updateSuggestions(user, []storage_interface.MoneyEvent{event}, nil)
+	env.deleteAttachments(attachments)
+	return []bot_interface.Message{{Text: "Expense deleted: " + expenseLine(event, "")}, provideMainOptions()}, nil
+}
+
+// deletePurchase deletes the whole purchase of the installment when confirmed, one installment alone would leave
+// the total of the purchase and what is left to pay out of sync with its installments
+func (env MessagingPlatform) deletePurchase(user bot_interface.BotRecipient, event storage_interface.MoneyEvent, confirmation string) ([]bot_interface.Message, error) {
+	purchase, err := env.Storage.GetPurchase(event.PurchaseID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting purchase in deletePurchase: %v", err))
+		return []bot_interface.Message{{Text: "I didn't find the purchase of the installment. Sorry"}}, nil
+	}
+	description := fmt.Sprintf("%.2f - %s", purchase.Amount, event.Tag)
+	if purchase.Comment != "" {
+		description += " " + purchase.Comment
+	}
+	if confirmation != confirmDeleting {
+		text := fmt.Sprintf("This is an installment of the purchase of %s: %s in %d installments. Delete the purchase with all its installments?",
+			purchase.Created.Format("Mon, 2 Jan 2006"), description, purchase.Installments)
+		options := []bot_interface.Option{{Id: strconv.Itoa(event.ID), Action: bot_interface.ActionDeleteExpense, State: confirmDeleting, Text: "\xE2\x9D\x8Cdelete purchase"}}
+		return []bot_interface.Message{{Text: text, Options: options}}, nil
+	}
+	events, err := env.Storage.GetPurchaseInstallments(purchase.ID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting installments in deletePurchase: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	var attachments []storage_interface.Attachment
+	for _, installment := range events {
+		files, err := env.Storage.GetAttachments(installment.ID, user.UserID)
+		if err != nil {
+			log.Print(fmt.Errorf("error getting attachments in deletePurchase: %v", err))
+			return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+		}
+		attachments = append(attachments, files...)
+	}
+	err = env.Storage.DeletePurchase(purchase.ID, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error deleting purchase in deletePurchase: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	env.updateSuggestions(user, events, nil)
+	env.deleteAttachments(attachments)
+	text := fmt.Sprintf("Purchase deleted with its %d installments: %s", len(events), description)
+	return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+}
+
+func (env MessagingPlatform) expenseByID(user bot_interface.BotRecipient, eventID string) (storage_interface.MoneyEvent, error) {
+	id, err := strconv.Atoi(eventID)
+	if err != nil {
+		return storage_interface.MoneyEvent{}, fmt.Errorf("error parsing expense id '%s': %v", eventID, err)
+	}
+	return env.Storage.GetMoneyEvent(id, user.UserID)
+}
@@ -0,0 +1,46 @@
+package speaking
+
+import (
+	"errors"
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/export"
+	"ingresos_gastos/reports"
+	"log"
+	"strings"
+	"time"
+)
+
+// GiveExport sends user's money events, targets and tags as a file. Arguments are an optional format
+// and a period like "xlsx 2024", by default it is CSV for the current month
+func (env MessagingPlatform) GiveExport(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	format := export.FormatCSV
+	words := strings.Fields(arguments)
+	if len(words) > 0 {
+		for _, known := range export.Formats {
+			if strings.EqualFold(words[0], known) {
+				format = known
+				words = words[1:]
+				break
+			}
+		}
+	}
+	periodText := strings.Join(words, " ")
+	period, err := reports.ParsePeriod(periodText, time.Now())
+	if errors.Is(err, reports.ErrPeriodFormat) {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't understand '%s'. Type /%s [%s] [period], where period is one of: %s",
+			periodText, bot_interface.CommandExport, strings.Join(export.Formats, "|"), reports.PeriodExamples)}}, nil
+	}
+	data, err := export.Load(env.Storage, user.UserID, period)
+	if err != nil {
+		log.Print(fmt.Errorf("error loading data in GiveExport: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	name, content, err := export.Write(data, format)
+	if err != nil {
+		log.Print(fmt.Errorf("error writing export in GiveExport: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("Your data for %s: %d expenses, %d targets, %d tags", period.Title(), len(data.Events), len(data.Targets), len(data.Tags))
+	return []bot_interface.Message{{Text: text, Document: &bot_interface.File{Name: name, Data: content}}, provideMainOptions()}, nil
+}
@@ -2,24 +2,30 @@ package speaking
 
 import (
 	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/storage_interface"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// tagChoiceLayout is for keyboards where user picks one of the tags: it can be long, so typing a part of the name filters it
+var tagChoiceLayout = bot_interface.Layout{Searchable: true, WithFinishOption: true}
+
 var defaultTags = []bot_interface.Option{
-	{Id: "inline_Food", Text: "\xF0\x9F\x8D\x9CFood"},
-	{Id: "inline_Cafe", Text: "\xE2\x98\x95Cafe"},
-	{Id: "inline_Bar", Text: "\xF0\x9F\x8D\xB9Bar"},
-	{Id: "inline_Auto", Text: "\xF0\x9F\x9A\x99Auto"},
-	{Id: "inline_Medicine", Text: "\xF0\x9F\x9A\x91Medicine"},
-	{Id: "inline_Credits", Text: "Credits"},
-	{Id: "inline_Travel", Text: "\xF0\x9F\x9A\xA2Travel"},
-	{Id: "inline_Garden", Text: "\xF0\x9F\x8C\xBCGarden"},
-	{Id: "inline_Culture", Text: "\xF0\x9F\x8E\xADCulture"},
-	{Id: "inline_Home", Text: "\xF0\x9F\x8F\xA0Home"},
-	{Id: "inline_Pet", Text: "\xF0\x9F\x90\xA9Pet"},
-	{Id: "inline_Clothes", Text: "\xF0\x9F\x91\x97Clothes"},
-	{Id: "inline_Investment", Text: "\xF0\x9F\x92\x8EInvestment"}}
+	{Id: "Food", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x8D\x9CFood"},
+	{Id: "Cafe", Action: bot_interface.ActionTag, Text: "\xE2\x98\x95Cafe"},
+	{Id: "Bar", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x8D\xB9Bar"},
+	{Id: "Auto", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x9A\x99Auto"},
+	{Id: "Medicine", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x9A\x91Medicine"},
+	{Id: "Credits", Action: bot_interface.ActionTag, Text: "Credits"},
+	{Id: "Travel", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x9A\xA2Travel"},
+	{Id: "Garden", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x8C\xBCGarden"},
+	{Id: "Culture", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x8E\xADCulture"},
+	{Id: "Home", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x8F\xA0Home"},
+	{Id: "Pet", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x90\xA9Pet"},
+	{Id: "Clothes", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x91\x97Clothes"},
+	{Id: "Investment", Action: bot_interface.ActionTag, Text: "\xF0\x9F\x92\x8EInvestment"}}
 
 // gets interval for current month to compare with database dates
 func monthInterval() (time.Time, time.Time) {
@@ -37,3 +43,129 @@ func trimStringFromFirstSpace(s string) string {
 	}
 	return s
 }
+
+func splitByFirstSpace(s string) (string, string) {
+	head, tail, _ := strings.Cut(s, " ")
+	return head, tail
+}
+
+// splitExpenseInput reads "<amount> [words...]" typed by user
+func splitExpenseInput(text string) (float32, []string, error) {
+	parts := strings.Fields(text)
+	if len(parts) == 0 {
+		return 0, nil, strconv.ErrSyntax
+	}
+	amount, err := strconv.ParseFloat(parts[0], 32)
+	if err != nil {
+		return 0, nil, err
+	}
+	// words like "nan" and "infinity" are numbers for ParseFloat, but not amounts
+	if math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, nil, strconv.ErrSyntax
+	}
+	return float32(amount), parts[1:], nil
+}
+
+// splitTag takes the tag from the first of the words typed after the amount, the rest is the comment.
+// When the first word is not a known tag all the words are the comment and the tag is empty
+func splitTag(words []string, knownTags []string) (string, string) {
+	if len(words) == 0 {
+		return "", ""
+	}
+	if tag, ok := findTag(words[0], knownTags); ok {
+		return tag, strings.Join(words[1:], " ")
+	}
+	return "", strings.Join(words, " ")
+}
+
+// findTag looks for the tag in the list ignoring case and gives back the tag as it is written in the list
+func findTag(tag string, tags []string) (string, bool) {
+	for _, known := range tags {
+		if strings.EqualFold(known, tag) {
+			return known, true
+		}
+	}
+	return "", false
+}
+
+func defaultTagNames() []string {
+	var names []string
+	for _, option := range defaultTags {
+		names = append(names, option.Id)
+	}
+	return names
+}
+
+// tagLabel is how the tag is shown to user: its emoji and name
+func tagLabel(tag storage_interface.Tag) string {
+	return tag.Emoji + tag.Name
+}
+
+// defaultEmoji is the emoji of a default tag with the name or empty string for other tags
+func defaultEmoji(name string) string {
+	for _, option := range defaultTags {
+		if option.Id == name {
+			return strings.TrimSuffix(option.Text, name)
+		}
+	}
+	return ""
+}
+
+func activeTags(tags []storage_interface.Tag) []storage_interface.Tag {
+	var result []storage_interface.Tag
+	for _, tag := range tags {
+		if !tag.Archived {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// visibleParentID is the parent of the tag when the parent is in the list, otherwise the tag is shown on the top level
+func visibleParentID(tags []storage_interface.Tag, tag storage_interface.Tag) int {
+	if _, ok := storage_interface.FindTagByID(tags, tag.ParentID); ok {
+		return tag.ParentID
+	}
+	return 0
+}
+
+func hasChildren(tags []storage_interface.Tag, id int) bool {
+	for _, tag := range tags {
+		if tag.ParentID == id && tag.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// isTagInside tells if the tag is somewhere below the ancestor in the tree of tags
+func isTagInside(tags []storage_interface.Tag, tag string, ancestor string) bool {
+	current, ok := storage_interface.FindTag(tags, tag)
+	for depth := 0; ok && depth < len(tags); depth++ {
+		parent, found := storage_interface.FindTagByID(tags, current.ParentID)
+		if !found {
+			return false
+		}
+		if parent.Name == ancestor {
+			return true
+		}
+		current = parent
+	}
+	return false
+}
+
+// topLevelTag is the top ancestor of the tag, the one shown in the first level of tags keyboard
+func topLevelTag(tags []storage_interface.Tag, name string) string {
+	current, ok := storage_interface.FindTag(tags, name)
+	for depth := 0; ok && depth < len(tags); depth++ {
+		parent, found := storage_interface.FindTagByID(tags, visibleParentID(tags, current))
+		if !found {
+			break
+		}
+		current = parent
+	}
+	if !ok {
+		return name
+	}
+	return current.Name
+}
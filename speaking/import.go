@@ -0,0 +1,288 @@
+package speaking
+
+import (
+	"errors"
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/importing"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// importPreviewRows is how many rows of the file are shown before the import
+	importPreviewRows = 10
+	importConfirm     = "confirm"
+	importColumns     = "columns"
+	importCancel      = "cancel"
+	importExample     = "date=1, amount=3, description=2, expenses=negative"
+	importReportName  = "not-imported.txt"
+)
+
+var errNoPendingImport = errors.New("no file to import")
+
+// ReceiveDocument starts importing expenses from the file user sent
+func (env MessagingPlatform) ReceiveDocument(user bot_interface.BotRecipient, document bot_interface.File, caption string) ([]bot_interface.Message, error) {
+	if messages, handled, err := env.receiveAttachment(user, document, caption); handled {
+		env.saveUsageLog("attachment", user.UserID)
+		return messages, err
+	}
+	switch strings.ToLower(filepath.Ext(document.Name)) {
+	case ".jpg", ".jpeg", ".png":
+		// a photo sent as a file keeps its full quality, it is the best way to send a small QR code
+		return env.ReceivePhoto(user, document, caption)
+	}
+	format, err := importing.FormatOf(document.Name)
+	if err != nil {
+		return []bot_interface.Message{{Text: "I can import expenses from CSV, OFX and QIF files of banks and apps, or from result.json of a chat exported by Telegram Desktop. Please send a .csv, .ofx, .qif or .json file"}, provideMainOptions()}, nil
+	}
+	env.saveUsageLog("import", user.UserID)
+	if format == importing.FormatCSV {
+		return env.StartCSVImport(user, document)
+	}
+	return env.StartStatementImport(user, document)
+}
+
+// StartStatementImport keeps an OFX, QIF or chat export file until user confirms the import
+func (env MessagingPlatform) StartStatementImport(user bot_interface.BotRecipient, document bot_interface.File) ([]bot_interface.Message, error) {
+	pending := storage_interface.PendingImport{UserID: user.UserID, FileName: document.Name, Content: document.Data}
+	err := env.Storage.SavePendingImport(pending)
+	if err != nil {
+		log.Print(fmt.Errorf("error saving pending import in StartStatementImport: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	return env.previewImport(user, pending)
+}
+
+// StartCSVImport keeps the file until user confirms the import. Columns of the file are taken from the profile
+// saved for files like this one or guessed, user is asked for them when they can't be guessed
+func (env MessagingPlatform) StartCSVImport(user bot_interface.BotRecipient, document bot_interface.File) ([]bot_interface.Message, error) {
+	table, err := importing.ReadCSV(document.Data)
+	if err != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't read '%s' as a CSV file: %v", document.Name, err)}, provideMainOptions()}, nil
+	}
+	pending := storage_interface.PendingImport{UserID: user.UserID, FileName: document.Name, Content: document.Data}
+	profile, err := env.Storage.GetImportProfile(user.UserID, table.Signature())
+	if err != nil {
+		log.Print(fmt.Errorf("error getting import profile in StartCSVImport: %v", err))
+	}
+	if columns, errParsing := importing.ParseColumns(profile, table.Header); profile != "" && errParsing == nil {
+		pending.Columns = columns.String()
+	} else if columns, complete := importing.DetectColumns(table); complete {
+		pending.Columns = columns.String()
+	}
+	err = env.Storage.SavePendingImport(pending)
+	if err != nil {
+		log.Print(fmt.Errorf("error saving pending import in StartCSVImport: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	if pending.Columns == "" {
+		return env.askImportColumns(user, table, "I don't know columns of this file.")
+	}
+	return env.previewImport(user, pending)
+}
+
+// ChooseImportColumns applies columns typed by user to the file waiting for import
+func (env MessagingPlatform) ChooseImportColumns(user bot_interface.BotRecipient, text string) ([]bot_interface.Message, error) {
+	pending, err := env.pendingImport(user)
+	if errors.Is(err, errNoPendingImport) {
+		return env.noPendingImport(user)
+	}
+	if err != nil {
+		log.Print(fmt.Errorf("error getting pending import in ChooseImportColumns: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	table, err := importing.ReadCSV(pending.Content)
+	if err != nil {
+		return env.noPendingImport(user)
+	}
+	columns, err := importing.ParseColumns(text, table.Header)
+	if err != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't understand it: %v. Please type columns like:\n%s", err, importExample)}}, nil
+	}
+	pending.Columns = columns.String()
+	err = env.Storage.SavePendingImport(pending)
+	if err != nil {
+		log.Print(fmt.Errorf("error saving pending import in ChooseImportColumns: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	return env.previewImport(user, pending)
+}
+
+// AnswerImport does what user pressed under the import preview: confirm, change columns or cancel
+func (env MessagingPlatform) AnswerImport(user bot_interface.BotRecipient, answer string) ([]bot_interface.Message, error) {
+	if answer == importCancel {
+		if err := env.Storage.DeletePendingImport(user.UserID); err != nil {
+			log.Print(fmt.Errorf("error deleting pending import in AnswerImport: %v", err))
+		}
+		return env.CancelLastState(user)
+	}
+	pending, err := env.pendingImport(user)
+	if errors.Is(err, errNoPendingImport) {
+		return env.noPendingImport(user)
+	}
+	if err != nil {
+		log.Print(fmt.Errorf("error getting pending import in AnswerImport: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	if answer == importColumns {
+		return env.askPendingImportColumns(user, pending, "")
+	}
+	events, problems, err := env.pendingEvents(user, pending)
+	if err != nil {
+		return env.previewImport(user, pending)
+	}
+	plan, err := importing.NewPlan(env.Storage, user.UserID, events)
+	if err != nil {
+		log.Print(fmt.Errorf("error planning import in AnswerImport: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	err = env.Storage.CreateMoneyEvents(plan.Fresh, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error creating money events in AnswerImport: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	env.updateSuggestions(user, nil, plan.Fresh)
+	if pending.Columns != "" {
+		if table, errReading := importing.ReadCSV(pending.Content); errReading == nil {
+			if err = env.Storage.SaveImportProfile(user.UserID, table.Signature(), pending.Columns); err != nil {
+				log.Print(fmt.Errorf("error saving import profile in AnswerImport: %v", err))
+			}
+		}
+	}
+	if err = env.Storage.DeletePendingImport(user.UserID); err != nil {
+		log.Print(fmt.Errorf("error deleting pending import in AnswerImport: %v", err))
+	}
+	text := fmt.Sprintf("Imported %d expenses from %s, %d got tags by your rules and history, %d were already recorded",
+		len(plan.Fresh), pending.FileName, plan.Tagged(), len(plan.Duplicates))
+	if len(problems) == 0 {
+		return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+	}
+	text += fmt.Sprintf(". %d lines are not imported, they are in the report", len(problems))
+	report := &bot_interface.File{Name: importReportName, Data: []byte(strings.Join(problems, "\n") + "\n")}
+	return []bot_interface.Message{{Text: text, Document: report}, provideMainOptions()}, nil
+}
+
+// previewImport shows what is going to be imported and asks for confirmation
+func (env MessagingPlatform) previewImport(user bot_interface.BotRecipient, pending storage_interface.PendingImport) ([]bot_interface.Message, error) {
+	events, problems, err := env.pendingEvents(user, pending)
+	if errors.Is(err, importing.ErrUnknownColumns) {
+		return env.askPendingImportColumns(user, pending, "I don't know columns of this file.")
+	}
+	if err != nil {
+		if errDeleting := env.Storage.DeletePendingImport(user.UserID); errDeleting != nil {
+			log.Print(fmt.Errorf("error deleting pending import in previewImport: %v", errDeleting))
+		}
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't read '%s': %v", pending.FileName, err)}, provideMainOptions()}, nil
+	}
+	if len(events) == 0 && pending.Columns != "" {
+		return env.askPendingImportColumns(user, pending, fmt.Sprintf("No rows can be read with these columns: %s.", strings.Join(problems, ", ")))
+	}
+	plan, err := importing.NewPlan(env.Storage, user.UserID, events)
+	if err != nil {
+		log.Print(fmt.Errorf("error planning import in previewImport: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error saving user state in previewImport: %v", err))
+	}
+
+	lines := []string{"File: " + pending.FileName}
+	if table, errReading := importing.ReadCSV(pending.Content); pending.Columns != "" && errReading == nil {
+		if columns, errParsing := importing.ParseColumns(pending.Columns, table.Header); errParsing == nil {
+			lines = append(lines, columns.Describe(table.Header))
+		}
+	}
+	lines = append(lines, "", fmt.Sprintf("New expenses: %d (%d with tags by your rules and history), already recorded: %d, rows I can't read: %d",
+		len(plan.Fresh), plan.Tagged(), len(plan.Duplicates), len(problems)))
+	for i, event := range plan.Fresh {
+		if i == importPreviewRows {
+			lines = append(lines, fmt.Sprintf("...and %d more", len(plan.Fresh)-importPreviewRows))
+			break
+		}
+		lines = append(lines, event.Created.Format(time.DateOnly)+" "+expenseLine(event, ""))
+	}
+	if len(problems) > 0 {
+		lines = append(lines, "", "Not imported: "+strings.Join(firstLines(problems, importPreviewRows), "; "))
+	}
+
+	var options []bot_interface.Option
+	if len(plan.Fresh) > 0 {
+		options = append(options, bot_interface.Option{Id: importConfirm, Action: bot_interface.ActionImport, Text: fmt.Sprintf("\xE2\x9C\x85import %d", len(plan.Fresh)), FullWidth: true})
+	}
+	if pending.Columns != "" {
+		options = append(options, bot_interface.Option{Id: importColumns, Action: bot_interface.ActionImport, Text: "\xE2\x9C\x8Fcolumns"})
+	}
+	options = append(options, bot_interface.Option{Id: importCancel, Action: bot_interface.ActionImport, Text: "\xE2\x9C\x96cancel"})
+	return []bot_interface.Message{{Text: strings.Join(lines, "\n"), Options: options}}, nil
+}
+
+// askPendingImportColumns asks for columns of the CSV file waiting for import
+func (env MessagingPlatform) askPendingImportColumns(user bot_interface.BotRecipient, pending storage_interface.PendingImport, reason string) ([]bot_interface.Message, error) {
+	table, err := importing.ReadCSV(pending.Content)
+	if err != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't read '%s' as a CSV file: %v", pending.FileName, err)}, provideMainOptions()}, nil
+	}
+	return env.askImportColumns(user, table, reason)
+}
+
+// askImportColumns lists columns of the file with examples and waits for user to tell which is which
+func (env MessagingPlatform) askImportColumns(user bot_interface.BotRecipient, table importing.Table, reason string) ([]bot_interface.Message, error) {
+	err := env.Storage.SetState(user.UserID, bot_interface.StateImportColumns)
+	if err != nil {
+		log.Print(fmt.Errorf("error saving user state in askImportColumns: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	lines := []string{strings.TrimSpace(reason + " Which columns have date, amount and description? Columns of the file:")}
+	for i, name := range table.Header {
+		lines = append(lines, fmt.Sprintf("%d. %s (%s)", i+1, name, table.Sample(i)))
+	}
+	lines = append(lines, "", "Type them by number or name like:", importExample,
+		"Currency column is optional. Write expenses=negative when expenses have minus in the file")
+	return []bot_interface.Message{{Text: strings.Join(lines, "\n")}}, nil
+}
+
+// pendingEvents reads money events of the file waiting for import. Every line of exported chat messages is read
+// the same way as expenses typed to the bot, and the expense is dated by its message
+func (env MessagingPlatform) pendingEvents(user bot_interface.BotRecipient, pending storage_interface.PendingImport) ([]storage_interface.MoneyEvent, []string, error) {
+	if format, err := importing.FormatOf(pending.FileName); err != nil || format != importing.FormatTelegram {
+		return importing.ReadEvents(pending.FileName, pending.Content, pending.Columns)
+	}
+	knownTags := env.knownTags(user)
+	return importing.TelegramEvents(pending.Content, func(text string) (storage_interface.MoneyEvent, bool) {
+		amount, words, err := splitExpenseInput(text)
+		if err != nil {
+			return storage_interface.MoneyEvent{}, false
+		}
+		tag, comment := splitTag(words, knownTags)
+		return storage_interface.MoneyEvent{Amount: amount, Currency: "ARS", Tag: tag, Comment: comment}, true
+	})
+}
+
+// pendingImport gives the file waiting for import
+func (env MessagingPlatform) pendingImport(user bot_interface.BotRecipient) (storage_interface.PendingImport, error) {
+	pending, err := env.Storage.GetPendingImport(user.UserID)
+	if err == nil && len(pending.Content) == 0 {
+		err = errNoPendingImport
+	}
+	return pending, err
+}
+
+func (env MessagingPlatform) noPendingImport(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
+	err := env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error saving user state in noPendingImport: %v", err))
+	}
+	return []bot_interface.Message{{Text: "There is no file to import. Please send it again"}, provideMainOptions()}, nil
+}
+
+func firstLines(lines []string, count int) []string {
+	if len(lines) <= count {
+		return lines
+	}
+	return append(lines[:count:count], fmt.Sprintf("...and %d more", len(lines)-count))
+}
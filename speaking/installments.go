@@ -0,0 +1,58 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/installments"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"strings"
+	"time"
+)
+
+// RecordInstallments records a purchase typed like "120000 home 12c tv" as an expense in every month it is paid.
+// When the tag is unknown it is asked like for other expenses keeping the number of installments in the comment
+func (env MessagingPlatform) RecordInstallments(user bot_interface.BotRecipient, amount float32, count int, words []string) ([]bot_interface.Message, error) {
+	tag, comment := splitTag(words, env.knownTags(user))
+	if tag == "" {
+		if rule, found := env.findCategorizationRule(user, amount, comment); found {
+			tag = rule.Tag
+		}
+	}
+	if tag == "" {
+		return env.SetSpending(user, amount, strings.TrimSpace(installments.Token(count)+" "+comment))
+	}
+	return env.SetInstallmentsWithTag(user, amount, count, tag, comment)
+}
+
+// SetInstallmentsWithTag saves the purchase and its installments, the first one is today
+func (env MessagingPlatform) SetInstallmentsWithTag(user bot_interface.BotRecipient, amount float32, count int, tag string, comment string) ([]bot_interface.Message, error) {
+	account, comment := env.takeAccount(user, comment)
+	currency := "ARS"
+	if account.Currency != "" {
+		currency = account.Currency
+	}
+	purchase := storage_interface.Purchase{Amount: amount, Currency: currency, Comment: comment, Installments: count, Created: time.Now(), UserID: user.UserID}
+	events := installments.Plan(purchase, tag)
+	for i := range events {
+		events[i].AccountID = account.ID
+	}
+	_, err := env.Storage.CreatePurchase(purchase, events, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error creating purchase in SetInstallmentsWithTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	env.updateSuggestions(user, nil, events)
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in SetInstallmentsWithTag: %v", err))
+	}
+	description := tag
+	if comment != "" {
+		description += " (" + comment + ")"
+	}
+	last := events[len(events)-1]
+	text := fmt.Sprintf("Your purchase is recorded:\n%.2f - %s\n%d installments of %.2f, one a month till %s",
+		amount, description, count, last.Amount, last.Created.Format("January 2006")) + env.accountNote(user, events[0])
+	return []bot_interface.Message{{Text: text, Reference: expenseReference(events[0].ID)}, provideMainOptions()}, nil
+}
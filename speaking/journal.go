@@ -0,0 +1,92 @@
+package speaking
+
+import (
+	"errors"
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/ledger"
+	"ingresos_gastos/reports"
+	"log"
+	"strings"
+	"time"
+)
+
+const journalAccountsExample = "Food = Expenses:Groceries\n@visa = Liabilities:Visa\n* = Assets:Bank"
+
+// GiveJournal sends user's expenses as a plain-text accounting journal. Arguments are an optional format
+// and a period like "beancount 2024", by default it is ledger for the current month
+func (env MessagingPlatform) GiveJournal(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	format := ledger.FormatLedger
+	words := strings.Fields(arguments)
+	if len(words) > 0 {
+		for _, known := range ledger.Formats {
+			if strings.EqualFold(words[0], known) {
+				format = known
+				words = words[1:]
+				break
+			}
+		}
+	}
+	periodText := strings.Join(words, " ")
+	period, err := reports.ParsePeriod(periodText, time.Now())
+	if errors.Is(err, reports.ErrPeriodFormat) {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't understand '%s'. Type /%s [%s] [period], where period is one of: %s",
+			periodText, bot_interface.CommandJournal, strings.Join(ledger.Formats, "|"), reports.PeriodExamples)}}, nil
+	}
+	journal, err := ledger.Export(env.Storage, user.UserID, format, period.Start, period.End, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error exporting journal in GiveJournal: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("Your %s journal for %s. Choose accounts for tags with /%s", format, period.Title(), bot_interface.CommandJournalAccounts)
+	document := &bot_interface.File{Name: ledger.FileName(format, period.String()), Data: journal}
+	return []bot_interface.Message{{Text: text, Document: document}, provideMainOptions()}, nil
+}
+
+// GiveJournalAccounts shows which accounts tags go to in journals and waits for changes
+func (env MessagingPlatform) GiveJournalAccounts(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
+	mapping, err := env.journalMapping(user)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting mapping in GiveJournalAccounts: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	err = env.Storage.SetState(user.UserID, bot_interface.StateJournalAccounts)
+	if err != nil {
+		log.Print(fmt.Errorf("error saving user state in GiveJournalAccounts: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	current := mapping.String()
+	if current == "" {
+		current = "none"
+	}
+	text := fmt.Sprintf("Tags go to %s:<Tag> accounts and money comes from your accounts like %s:Bank:<Name> and %s:Card:<Name>, or from %s before you added accounts, unless you change it.\nYour changes:\n%s\n\nType new lines like:\n%s\nType 'Tag =' to remove a line",
+		ledger.ExpensesRoot, ledger.AssetsRoot, ledger.LiabilitiesRoot, ledger.DefaultFunding, current, journalAccountsExample)
+	return []bot_interface.Message{{Text: text}}, nil
+}
+
+// UpdateJournalAccounts applies typed lines of the mapping over the saved one
+func (env MessagingPlatform) UpdateJournalAccounts(user bot_interface.BotRecipient, text string) ([]bot_interface.Message, error) {
+	mapping, err := env.journalMapping(user)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting mapping in UpdateJournalAccounts: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	if err = mapping.Update(text); err != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't understand it: %v. Please type lines like:\n%s", err, journalAccountsExample)}}, nil
+	}
+	err = env.Storage.SaveLedgerMapping(user.UserID, mapping.String())
+	if err != nil {
+		log.Print(fmt.Errorf("error saving mapping in UpdateJournalAccounts: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	accountsMessages, _ := env.GiveJournalAccounts(user)
+	return append([]bot_interface.Message{{Text: "Accounts saved"}}, accountsMessages...), nil
+}
+
+func (env MessagingPlatform) journalMapping(user bot_interface.BotRecipient) (ledger.Mapping, error) {
+	saved, err := env.Storage.GetLedgerMapping(user.UserID)
+	if err != nil {
+		return ledger.Mapping{}, err
+	}
+	return ledger.ParseMapping(saved)
+}
@@ -0,0 +1,94 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/notifications"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProposeNotifiedExpense shows the payment found in a forwarded notification of a bank or Mercado Pago
+// and asks for the tag. The tag of the user's rule or history for the merchant goes first
+func (env MessagingPlatform) ProposeNotifiedExpense(user bot_interface.BotRecipient, notification notifications.Notification) ([]bot_interface.Message, error) {
+	day := notification.Date
+	if day.IsZero() {
+		day = time.Now()
+	}
+	state := fmt.Sprintf("%s %.2f %s %s %s", bot_interface.StateNotification, notification.Amount, notification.Currency, day.Format(time.DateOnly), notification.Merchant)
+	err := env.Storage.SetState(user.UserID, state)
+	if err != nil {
+		log.Print(fmt.Errorf("error setting user state in ProposeNotifiedExpense: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	options := env.suggestedTagOptions(user, notification.Amount, notification.Merchant)
+	if rule, found := env.findCategorizationRule(user, notification.Amount, notification.Merchant); found {
+		options = preferTag(options, rule.Tag)
+	}
+	text := fmt.Sprintf("It looks like a payment from %s:\n%.2f %s - %s, %s\nFor which category do I have to record it?",
+		notification.Issuer, notification.Amount, notification.Currency, notification.Merchant, day.Format(time.DateOnly))
+	return []bot_interface.Message{{Text: text, Options: options, Layout: tagChoiceLayout}}, nil
+}
+
+// SetNotifiedSpendingWithTag records the payment of the notification kept in user's state with the chosen tag
+func (env MessagingPlatform) SetNotifiedSpendingWithTag(user bot_interface.BotRecipient, userState string, tag string) ([]bot_interface.Message, error) {
+	parts := strings.SplitN(trimStringFromFirstSpace(userState), " ", 4)
+	if len(parts) < 3 {
+		log.Print(fmt.Errorf("error reading notification from state '%s' in SetNotifiedSpendingWithTag", userState))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, nil
+	}
+	amount, err := strconv.ParseFloat(parts[0], 32)
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing amount from state '%s' in SetNotifiedSpendingWithTag: %v", userState, err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	day, err := time.ParseInLocation(time.DateOnly, parts[2], time.Local)
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing date from state '%s' in SetNotifiedSpendingWithTag: %v", userState, err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	now := time.Now()
+	created := time.Date(day.Year(), day.Month(), day.Day(), now.Hour(), now.Minute(), now.Second(), 0, time.Local)
+	if created.After(now) {
+		created = now
+	}
+	merchant := ""
+	if len(parts) == 4 {
+		merchant = parts[3]
+	}
+	events := []storage_interface.MoneyEvent{{Amount: float32(amount), Currency: parts[1], Comment: merchant, Tag: tag, Created: created}}
+	err = env.Storage.CreateMoneyEvents(events, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error creating money event in SetNotifiedSpendingWithTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	env.updateSuggestions(user, nil, events)
+	event := events[0]
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in SetNotifiedSpendingWithTag: %v", err))
+	}
+	text := fmt.Sprintf("Your expense is recorded:\n%.2f %s - %s (%s), %s", event.Amount, event.Currency, tag, merchant, day.Format(time.DateOnly))
+	return []bot_interface.Message{{Text: text, Reference: expenseReference(event.ID)}, provideMainOptions()}, nil
+}
+
+// preferTag puts the tag first and marks it as the suggested one instead of the tag suggested before
+func preferTag(options []bot_interface.Option, tag string) []bot_interface.Option {
+	preferred := bot_interface.Option{Id: tag, Action: bot_interface.ActionTag, Text: tag, FullWidth: true}
+	var rest []bot_interface.Option
+	for _, option := range options {
+		option.Text = strings.TrimPrefix(option.Text, suggestedMark)
+		if option.Id == tag {
+			if option.Action == bot_interface.ActionTag {
+				preferred = option
+			}
+			continue
+		}
+		rest = append(rest, option)
+	}
+	preferred.Text = suggestedMark + preferred.Text
+	return append([]bot_interface.Option{preferred}, rest...)
+}
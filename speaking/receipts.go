@@ -0,0 +1,150 @@
+package speaking
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"ingresos_gastos/afip"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/qr"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPhotoPixels limits the size of pictures which are decoded to look for a QR code, a small file
+// can unpack into a huge picture. It is far above the size of photos taken by phones
+const maxPhotoPixels = 50_000_000
+
+// ReceivePhoto attaches the photo to an expense or reads the AFIP QR code on the photo of a receipt and asks
+// for the tag of its total. The caption of a receipt, when there is one, becomes the comment of the expense
+func (env MessagingPlatform) ReceivePhoto(user bot_interface.BotRecipient, photo bot_interface.File, caption string) ([]bot_interface.Message, error) {
+	if messages, handled, err := env.receiveAttachment(user, photo, caption); handled {
+		env.saveUsageLog("attachment", user.UserID)
+		return messages, err
+	}
+	env.saveUsageLog("receipt", user.UserID)
+	config, _, err := image.DecodeConfig(bytes.NewReader(photo.Data))
+	if err == nil && config.Width*config.Height > maxPhotoPixels {
+		log.Print(fmt.Errorf("error decoding image %s in ReceivePhoto: %dx%d is too big", photo.Name, config.Width, config.Height))
+		return []bot_interface.Message{{Text: "This picture is too big for me. Please send a smaller photo of the receipt"}, provideMainOptions()}, nil
+	}
+	picture, _, err := image.Decode(bytes.NewReader(photo.Data))
+	if err != nil {
+		log.Print(fmt.Errorf("error decoding image %s in ReceivePhoto: %v", photo.Name, err))
+		return []bot_interface.Message{{Text: "I can't open this picture. Please send a JPEG or PNG photo of the receipt"}, provideMainOptions()}, nil
+	}
+	text, err := qr.Decode(picture)
+	if err != nil {
+		return []bot_interface.Message{{Text: "I couldn't find a QR code on the photo. Please take a closer and sharper photo of the code at the bottom of the receipt"}, provideMainOptions()}, nil
+	}
+	receipt, err := afip.Parse(text)
+	if errors.Is(err, afip.ErrNotReceipt) {
+		return []bot_interface.Message{{Text: "The QR code on the photo isn't the AFIP code of a receipt, I can read only those"}, provideMainOptions()}, nil
+	}
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing receipt '%s' in ReceivePhoto: %v", text, err))
+		return []bot_interface.Message{{Text: "I can't read the data of this receipt, please record the expense by typing it"}, provideMainOptions()}, nil
+	}
+	messages, err := env.ProposeReceiptExpense(user, receipt, strings.Join(strings.Fields(caption), " "))
+	if err == nil && len(messages) > 0 && len(messages[0].Options) > 0 {
+		env.keepReceiptPhoto(user, photo)
+	}
+	return messages, err
+}
+
+// receiptID tells receipts apart like AFIP does: by the seller, the type, the point of sale and the number
+func receiptID(receipt afip.Receipt) string {
+	return fmt.Sprintf("afip:%s:%d-%d-%d", receipt.CUIT, receipt.Type, receipt.PointOfSale, receipt.Number)
+}
+
+// ProposeReceiptExpense shows the total of the receipt and asks for the tag. The tag of the last expense
+// in the same shop, known by its CUIT, goes first. A receipt which is already recorded isn't proposed again
+func (env MessagingPlatform) ProposeReceiptExpense(user bot_interface.BotRecipient, receipt afip.Receipt, comment string) ([]bot_interface.Message, error) {
+	now := time.Now()
+	history, err := env.Storage.GetMoneyEventsByDateInterval(now.AddDate(-suggestionHistoryYears, 0, 0), now, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money events in ProposeReceiptExpense: %v", err))
+	}
+	id := receiptID(receipt)
+	lastTag := ""
+	for _, event := range history {
+		if event.ExternalID == id {
+			text := fmt.Sprintf("This receipt is already recorded:\n%.2f %s - %s, %s", event.Amount, event.Currency, event.Tag, event.Created.Format(time.DateOnly))
+			return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+		}
+		if event.MerchantID == receipt.CUIT && event.Tag != "" {
+			lastTag = event.Tag
+		}
+	}
+	state := fmt.Sprintf("%s %.2f %s %s %s %s %s", bot_interface.StateReceipt, receipt.Amount, receipt.Currency,
+		receipt.Date.Format(time.DateOnly), receipt.CUIT, id, comment)
+	err = env.Storage.SetState(user.UserID, strings.TrimSpace(state))
+	if err != nil {
+		log.Print(fmt.Errorf("error setting user state in ProposeReceiptExpense: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	options := env.suggestedTagOptions(user, receipt.Amount, comment)
+	if rule, found := env.findCategorizationRule(user, receipt.Amount, comment); found {
+		options = preferTag(options, rule.Tag)
+	} else if lastTag != "" {
+		options = preferTag(options, lastTag)
+	}
+	text := fmt.Sprintf("It's a receipt of CUIT %s:\n%.2f %s, %s\nFor which category do I have to record it?",
+		receipt.CUIT, receipt.Amount, receipt.Currency, receipt.Date.Format(time.DateOnly))
+	return []bot_interface.Message{{Text: text, Options: options, Layout: tagChoiceLayout}}, nil
+}
+
+// SetReceiptSpendingWithTag records the receipt kept in user's state with the chosen tag
+func (env MessagingPlatform) SetReceiptSpendingWithTag(user bot_interface.BotRecipient, userState string, tag string) ([]bot_interface.Message, error) {
+	parts := strings.SplitN(trimStringFromFirstSpace(userState), " ", 6)
+	if len(parts) < 5 {
+		log.Print(fmt.Errorf("error reading receipt from state '%s' in SetReceiptSpendingWithTag", userState))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, nil
+	}
+	amount, err := strconv.ParseFloat(parts[0], 32)
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing amount from state '%s' in SetReceiptSpendingWithTag: %v", userState, err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	day, err := time.ParseInLocation(time.DateOnly, parts[2], time.Local)
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing date from state '%s' in SetReceiptSpendingWithTag: %v", userState, err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	now := time.Now()
+	created := time.Date(day.Year(), day.Month(), day.Day(), now.Hour(), now.Minute(), now.Second(), 0, time.Local)
+	if created.After(now) {
+		created = now
+	}
+	comment := ""
+	if len(parts) == 6 {
+		comment = parts[5]
+	}
+	events := []storage_interface.MoneyEvent{{Amount: float32(amount), Currency: parts[1], Comment: comment, Tag: tag, Created: created,
+		MerchantID: parts[3], ExternalID: parts[4]}}
+	err = env.Storage.CreateMoneyEvents(events, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error creating money event in SetReceiptSpendingWithTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	env.updateSuggestions(user, nil, events)
+	event := events[0]
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in SetReceiptSpendingWithTag: %v", err))
+	}
+	text := fmt.Sprintf("Your expense is recorded:\n%.2f %s - %s, %s", event.Amount, event.Currency, tag, day.Format(time.DateOnly))
+	if comment != "" {
+		text = fmt.Sprintf("Your expense is recorded:\n%.2f %s - %s (%s), %s", event.Amount, event.Currency, tag, comment, day.Format(time.DateOnly))
+	}
+	if env.attachReceiptPhoto(user, event.ID) {
+		text += "\n\xF0\x9F\x93\x8EThe photo of the receipt is attached"
+	}
+	return []bot_interface.Message{{Text: text, Reference: expenseReference(event.ID)}, provideMainOptions()}, nil
+}
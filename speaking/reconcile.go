@@ -0,0 +1,211 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unaccountedTag marks expenses which make the balance of an account match the real one
+const unaccountedTag = "Unaccounted"
+
+// StartReconciling compares the balance of an account with the real one. Arguments are like "@cash 14500",
+// without the balance it is asked and without the account user chooses it
+func (env MessagingPlatform) StartReconciling(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	balances, _, err := env.balances(user)
+	if err != nil {
+		log.Print(fmt.Errorf("error counting balances in StartReconciling: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	var options []bot_interface.Option
+	for _, balance := range balances {
+		if balance.Account.Kind != storage_interface.AccountCard {
+			options = append(options, bot_interface.Option{Id: strconv.Itoa(balance.Account.ID), Action: bot_interface.ActionReconcile, Text: accountSign(balance.Account) + balance.Account.Name})
+		}
+	}
+	if len(options) == 0 {
+		text := fmt.Sprintf("You have no accounts to check yet. Add one by /%s, like '/%s %s cash cash 20000'", bot_interface.CommandBalances, bot_interface.CommandBalances, addAccountWord)
+		return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+	}
+	words := strings.Fields(arguments)
+	if len(words) == 0 {
+		return []bot_interface.Message{{Text: "Which account do you want to check?", Options: options}}, nil
+	}
+	balance, found := findBalance(balances, strings.TrimPrefix(words[0], accountMark))
+	if !found || balance.Account.Kind == storage_interface.AccountCard {
+		return []bot_interface.Message{{Text: fmt.Sprintf("You have no account %s, which one do you want to check?", words[0]), Options: options}}, nil
+	}
+	if len(words) == 1 {
+		return env.askRealBalance(user, balance)
+	}
+	actual, ok := parseAmount(words[1])
+	if !ok {
+		return []bot_interface.Message{{Text: "I can't understand your number, please enter correct number"}}, nil
+	}
+	return env.ReconcileAccount(user, balance, actual)
+}
+
+// findBalance looks for the balance of the account by its name ignoring case
+func findBalance(balances []reports.Balance, name string) (reports.Balance, bool) {
+	for _, balance := range balances {
+		if strings.EqualFold(balance.Account.Name, name) {
+			return balance, true
+		}
+	}
+	return reports.Balance{}, false
+}
+
+// askRealBalance waits for user to type how much money the account has
+func (env MessagingPlatform) askRealBalance(user bot_interface.BotRecipient, balance reports.Balance) ([]bot_interface.Message, error) {
+	err := env.Storage.SetState(user.UserID, fmt.Sprintf("%s %d", bot_interface.StateReconcile, balance.Account.ID))
+	if err != nil {
+		log.Print(fmt.Errorf("error setting user state in askRealBalance: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	text := fmt.Sprintf("How much money does %s have now? Please count it and type the number", balance.Account.Name)
+	return []bot_interface.Message{{Text: text}}, nil
+}
+
+// ReconcileWithInput compares the balance typed by user with the balance of the account in the state
+func (env MessagingPlatform) ReconcileWithInput(user bot_interface.BotRecipient, userState string, text string) ([]bot_interface.Message, error) {
+	actual, ok := parseAmount(strings.TrimSpace(text))
+	if !ok {
+		return []bot_interface.Message{{Text: "I can't understand your number, please enter correct number"}}, nil
+	}
+	accountID, err := strconv.Atoi(trimStringFromFirstSpace(userState))
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing account from state '%s' in ReconcileWithInput: %v", userState, err))
+		return []bot_interface.Message{{Text: "Please choose an account to check first"}}, nil
+	}
+	balance, found, err := env.accountBalance(user, accountID)
+	if err != nil {
+		log.Print(fmt.Errorf("error counting balances in ReconcileWithInput: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	if !found {
+		return []bot_interface.Message{{Text: "I didn't find the account. Sorry"}}, nil
+	}
+	return env.ReconcileAccount(user, balance, actual)
+}
+
+// ReconcileAccount shows the difference between the counted balance and the real one and offers to record it
+func (env MessagingPlatform) ReconcileAccount(user bot_interface.BotRecipient, balance reports.Balance, actual float32) ([]bot_interface.Message, error) {
+	err := env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in ReconcileAccount: %v", err))
+	}
+	account := balance.Account
+	difference := actual - balance.Amount
+	if math.Abs(float64(difference)) < 0.005 {
+		text := fmt.Sprintf("\xE2\x9C\x85%s is right: %.2f %s", account.Name, actual, account.Currency)
+		return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+	}
+	direction := "less"
+	if difference > 0 {
+		direction = "more"
+	}
+	text := fmt.Sprintf("By my count %s has %.2f %s, you have %.2f %s: %.2f %s than expected.",
+		account.Name, balance.Amount, account.Currency, actual, account.Currency, math.Abs(float64(difference)), direction)
+	if difference < 0 {
+		text += fmt.Sprintf("\nRecord the difference as an expense tagged %s?\nOr maybe you forgot some expenses, record them and check again", unaccountedTag)
+	} else {
+		text += fmt.Sprintf("\nRecord the difference as money which came to %s?", account.Name)
+	}
+	options := []bot_interface.Option{
+		{Id: fmt.Sprintf("%d %s", account.ID, formatAmount(actual)), Action: bot_interface.ActionReconcile, Text: "\xE2\x9C\x85record"},
+		{Id: bot_interface.CommandCancel, Action: bot_interface.ActionCommand, Text: "\xE2\x9C\x96leave it"},
+	}
+	return []bot_interface.Message{{Text: text, Options: options}, provideMainOptions()}, nil
+}
+
+// AnswerReconcile handles buttons of reconciliation: the value is the account to check or
+// "<account id> <real balance>" to record the difference
+func (env MessagingPlatform) AnswerReconcile(user bot_interface.BotRecipient, value string) ([]bot_interface.Message, error) {
+	idText, actualText := splitByFirstSpace(value)
+	accountID, err := strconv.Atoi(idText)
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing reconciliation '%s' in AnswerReconcile: %v", value, err))
+		return []bot_interface.Message{{Text: "I didn't recognize the command. Sorry"}}, nil
+	}
+	balance, found, err := env.accountBalance(user, accountID)
+	if err != nil {
+		log.Print(fmt.Errorf("error counting balances in AnswerReconcile: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	if !found {
+		return []bot_interface.Message{{Text: "I didn't find the account. Sorry"}}, nil
+	}
+	if actualText == "" {
+		return env.askRealBalance(user, balance)
+	}
+	actual, ok := parseAmount(actualText)
+	if !ok {
+		log.Print(fmt.Errorf("error parsing balance '%s' in AnswerReconcile", actualText))
+		return []bot_interface.Message{{Text: "I didn't recognize the command. Sorry"}}, nil
+	}
+	return env.RecordUnaccounted(user, balance, actual)
+}
+
+// RecordUnaccounted records the expense which makes the balance of the account equal to the real one,
+// when the account has more money than counted the difference is recorded as a transfer from outside.
+// The balance is counted again, so pressing the button twice records nothing the second time
+func (env MessagingPlatform) RecordUnaccounted(user bot_interface.BotRecipient, balance reports.Balance, actual float32) ([]bot_interface.Message, error) {
+	account := balance.Account
+	amount := balance.Amount - actual
+	if math.Abs(float64(amount)) < 0.005 {
+		text := fmt.Sprintf("\xE2\x9C\x85%s is right: %.2f %s", account.Name, actual, account.Currency)
+		return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+	}
+	if amount < 0 {
+		transfer := storage_interface.Transfer{
+			ToAccountID: account.ID,
+			Amount:      -amount,
+			Received:    -amount,
+			Comment:     fmt.Sprintf("%s had %s", account.Name, formatAmount(actual)),
+			Created:     time.Now(),
+			UserID:      user.UserID,
+		}
+		if _, err := env.Storage.CreateTransfer(transfer); err != nil {
+			log.Print(fmt.Errorf("error creating transfer in RecordUnaccounted: %v", err))
+			return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+		}
+		text := fmt.Sprintf("%.2f %s from outside is recorded in %s, it has %.2f %s now", transfer.Received, account.Currency, account.Name, actual, account.Currency)
+		return []bot_interface.Message{{Text: text}, provideMainOptions()}, nil
+	}
+	events := []storage_interface.MoneyEvent{{
+		Amount:    amount,
+		Currency:  account.Currency,
+		Comment:   fmt.Sprintf("%s had %s", account.Name, formatAmount(actual)),
+		Tag:       unaccountedTag,
+		Created:   time.Now(),
+		AccountID: account.ID,
+	}}
+	err := env.Storage.CreateMoneyEvents(events, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error creating money event in RecordUnaccounted: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	env.updateSuggestions(user, nil, events)
+	text := fmt.Sprintf("%.2f %s is recorded as %s, %s has %.2f %s now", amount, account.Currency, unaccountedTag, account.Name, actual, account.Currency)
+	return []bot_interface.Message{{Text: text, Reference: expenseReference(events[0].ID)}, provideMainOptions()}, nil
+}
+
+// accountBalance counts the balance of one account of the user
+func (env MessagingPlatform) accountBalance(user bot_interface.BotRecipient, accountID int) (reports.Balance, bool, error) {
+	balances, _, err := env.balances(user)
+	if err != nil {
+		return reports.Balance{}, false, err
+	}
+	for _, balance := range balances {
+		if balance.Account.ID == accountID {
+			return balance, true, nil
+		}
+	}
+	return reports.Balance{}, false, nil
+}
@@ -0,0 +1,101 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/categorization"
+	"ingresos_gastos/tagpolicy"
+	"log"
+	"strconv"
+	"strings"
+)
+
+const rulesExample = "comment contains subte -> Transport\namount < 2000 and comment matches /cafe|coffee/ -> Cafe"
+
+// userRules reads user's categorization rules from [Storage]. Rules which can't be understood anymore are skipped
+func (env MessagingPlatform) userRules(user bot_interface.BotRecipient) ([]categorization.Rule, error) {
+	storedRules, err := env.Storage.GetCategorizationRules(user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	var rules []categorization.Rule
+	for _, storedRule := range storedRules {
+		conditions, errParsing := categorization.ParseConditions(storedRule.Expression)
+		if errParsing != nil {
+			log.Print(fmt.Errorf("error parsing stored rule %d in userRules: %v", storedRule.ID, errParsing))
+			continue
+		}
+		rules = append(rules, categorization.Rule{ID: storedRule.ID, Conditions: conditions, Tag: storedRule.Tag})
+	}
+	return rules, nil
+}
+
+func (env MessagingPlatform) findCategorizationRule(user bot_interface.BotRecipient, amount float32, comment string) (categorization.Rule, bool) {
+	rules, err := env.userRules(user)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting rules in findCategorizationRule: %v", err))
+		return categorization.Rule{}, false
+	}
+	return categorization.FindRule(rules, amount, comment)
+}
+
+func (env MessagingPlatform) GiveInstructionsOnRules(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
+	rules, err := env.userRules(user)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting rules in GiveInstructionsOnRules: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	var textReply string
+	var options []bot_interface.Option
+	if len(rules) == 0 {
+		textReply = "You have no rules yet. A rule chooses a tag for you when you enter an expense as '<number> <comment>'.\nType a new rule like:\n" + rulesExample
+	} else {
+		lines := []string{"Your rules are checked from top to bottom:"}
+		for i, rule := range rules {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, rule))
+			options = append(options, bot_interface.Option{Id: strconv.Itoa(rule.ID), Action: bot_interface.ActionDeleteRule, Text: fmt.Sprintf("\xE2\x9D\x8C%d", i+1)})
+		}
+		lines = append(lines, "Select a rule to delete or type a new one like:\n"+rulesExample)
+		textReply = strings.Join(lines, "\n")
+	}
+	errSavingState := env.Storage.SetState(user.UserID, bot_interface.StateCreateRule)
+	if errSavingState != nil {
+		log.Print(fmt.Errorf("error saving user state in GiveInstructionsOnRules: %v", errSavingState))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, errSavingState
+	}
+	return []bot_interface.Message{{Text: textReply, Options: options, Layout: bot_interface.Layout{Columns: 5, WithFinishOption: true}}}, nil
+}
+
+func (env MessagingPlatform) AddCategorizationRule(user bot_interface.BotRecipient, text string) ([]bot_interface.Message, error) {
+	rule, err := categorization.ParseRule(text)
+	if err != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't understand the rule: %v. Please type it like:\n%s", err, rulesExample)}}, nil
+	}
+	if tag, ok := findTag(rule.Tag, env.knownTags(user)); ok {
+		rule.Tag = tag
+	} else if rule.Tag, _, err = tagpolicy.Normalize(rule.Tag); err != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't use the tag of the rule: %v. Please try again", err)}}, nil
+	}
+	err = env.Storage.CreateCategorizationRule(rule.Expression(), rule.Tag, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error creating rule in AddCategorizationRule: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	rulesMessages, _ := env.GiveInstructionsOnRules(user)
+	return append([]bot_interface.Message{{Text: "Rule saved: " + rule.String()}}, rulesMessages...), nil
+}
+
+func (env MessagingPlatform) DeleteCategorizationRule(user bot_interface.BotRecipient, ruleID string) ([]bot_interface.Message, error) {
+	id, err := strconv.Atoi(ruleID)
+	if err != nil {
+		log.Print(fmt.Errorf("error parsing rule id '%s' in DeleteCategorizationRule: %v", ruleID, err))
+		return []bot_interface.Message{{Text: "I didn't recognize the rule. Sorry"}}, nil
+	}
+	err = env.Storage.DeleteCategorizationRule(id, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error deleting rule in DeleteCategorizationRule: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	rulesMessages, _ := env.GiveInstructionsOnRules(user)
+	return append([]bot_interface.Message{{Text: "Rule deleted"}}, rulesMessages...), nil
+}
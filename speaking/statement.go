@@ -0,0 +1,94 @@
+package speaking
+
+import (
+	"errors"
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/reports"
+	"ingresos_gastos/statement"
+	"log"
+	"time"
+)
+
+// statementCheckInterval is how often the bot looks for users who didn't get the statement of the last month
+const statementCheckInterval = time.Hour
+
+// GiveStatement sends the PDF statement of a period typed as arguments like "2024-03", the current month by default
+func (env MessagingPlatform) GiveStatement(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	period, err := reports.ParsePeriod(arguments, time.Now())
+	if errors.Is(err, reports.ErrPeriodFormat) {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't understand the period '%s'. Try one of: %s", arguments, reports.PeriodExamples)}}, nil
+	}
+	message, err := env.statementMessage(user.UserID, period)
+	if err != nil {
+		log.Print(fmt.Errorf("error generating statement in GiveStatement: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	return []bot_interface.Message{message, provideMainOptions()}, nil
+}
+
+func (env MessagingPlatform) statementMessage(userID int64, period reports.Period) (bot_interface.Message, error) {
+	document, err := statement.Generate(env.Storage, userID, period, time.Now())
+	if err != nil {
+		return bot_interface.Message{}, err
+	}
+	text := "Statement for " + period.Title()
+	if link := env.Statements.URL(userID, period); link != "" {
+		text += "\nDownload it again: " + link
+	}
+	return bot_interface.Message{Text: text, Document: &bot_interface.File{Name: statement.FileName(period), Data: document}}, nil
+}
+
+// SendMonthlyStatements sends the statement of the previous month to every user who spent something in it
+// and didn't get the statement yet
+func (env MessagingPlatform) SendMonthlyStatements(now time.Time) {
+	period := reports.MonthPeriod(now).Previous()
+	users, err := env.Storage.GetUsers()
+	if err != nil {
+		log.Print(fmt.Errorf("error getting users in SendMonthlyStatements: %v", err))
+		return
+	}
+	for _, user := range users {
+		userID := int64(user.ID)
+		delivered, err := env.Storage.StatementDelivered(userID, period.Start)
+		if err != nil {
+			log.Print(fmt.Errorf("error checking statement of user %d in SendMonthlyStatements: %v", userID, err))
+			continue
+		}
+		if delivered {
+			continue
+		}
+		events, err := env.Storage.GetMoneyEventsByDateInterval(period.Start, period.End, userID)
+		if err != nil {
+			log.Print(fmt.Errorf("error getting money events of user %d in SendMonthlyStatements: %v", userID, err))
+			continue
+		}
+		if len(events) == 0 {
+			continue
+		}
+		message, err := env.statementMessage(userID, period)
+		if err != nil {
+			log.Print(fmt.Errorf("error generating statement of user %d in SendMonthlyStatements: %v", userID, err))
+			continue
+		}
+		recipient := bot_interface.BotRecipient{UserID: userID, Name: user.Name}
+		message.Text = "Your month is closed. " + message.Text
+		if err = env.Bot.Notify(recipient, []bot_interface.Message{message}); err != nil {
+			log.Print(fmt.Errorf("error sending statement to user %d in SendMonthlyStatements: %v", userID, err))
+			continue
+		}
+		if err = env.Storage.SaveStatementDelivery(userID, period.Start); err != nil {
+			log.Print(fmt.Errorf("error saving statement delivery of user %d in SendMonthlyStatements: %v", userID, err))
+		}
+	}
+}
+
+// ScheduleMonthlyStatements sends statements of every closed month in background
+func (env MessagingPlatform) ScheduleMonthlyStatements() {
+	go func() {
+		for {
+			env.SendMonthlyStatements(time.Now())
+			time.Sleep(statementCheckInterval)
+		}
+	}()
+}
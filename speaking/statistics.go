@@ -0,0 +1,90 @@
+package speaking
+
+import (
+	"errors"
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/installments"
+	"ingresos_gastos/reports"
+	"log"
+	"strings"
+	"time"
+)
+
+// compareMode is the first word of statistics arguments asking to compare the period with the previous ones
+const compareMode = "compare"
+
+func (env MessagingPlatform) GiveCurrentStatistics(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
+	return env.GiveStatistics(user, "")
+}
+
+// GiveStatistics shows the budget report for a period typed as arguments like "2024-03" or "last week".
+// Arguments starting with "compare" show how spending changed against the previous period and the year before
+func (env MessagingPlatform) GiveStatistics(user bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error) {
+	compare := false
+	if words := strings.Fields(arguments); len(words) > 0 && strings.EqualFold(words[0], compareMode) {
+		compare = true
+		arguments = strings.Join(words[1:], " ")
+	}
+	period, err := reports.ParsePeriod(arguments, time.Now())
+	if errors.Is(err, reports.ErrPeriodFormat) {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't understand the period '%s'. Try one of: %s", arguments, reports.PeriodExamples)}}, nil
+	}
+	spending, err := env.Storage.GetMoneyEventsByDateInterval(period.Start, period.End, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting money events in GiveStatistics: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+	}
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in GiveStatistics: %v", err))
+	}
+	var text string
+	var nodes []*reports.TagNode
+	if compare {
+		previous, errPrevious := env.Storage.GetMoneyEventsByDateInterval(period.Previous().Start, period.Previous().End, user.UserID)
+		lastYear, errLastYear := env.Storage.GetMoneyEventsByDateInterval(period.YearBefore().Start, period.YearBefore().End, user.UserID)
+		if err = errors.Join(errPrevious, errLastYear); err != nil {
+			log.Print(fmt.Errorf("error getting money events to compare in GiveStatistics: %v", err))
+			return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, err
+		}
+		comparison := reports.NewComparison(tags, spending, previous, lastYear)
+		text = fmt.Sprintf("%s compared to %s and %s\n\n%s", period.Title(), period.Previous().Title(), period.YearBefore().Title(), comparison.Text())
+		nodes = comparison.Tags
+	} else {
+		targets, errTargets := env.Storage.GetTargets(period.Start, period.End, user.UserID)
+		if errTargets != nil {
+			log.Print(fmt.Errorf("error getting targets in GiveStatistics: %v", errTargets))
+			return []bot_interface.Message{{Text: "Problem working with your profile. Please try again later"}}, errTargets
+		}
+		report := reports.NewBudgetReport(tags, spending, targets, period.Start, period.End, time.Now())
+		text = period.Title() + "\n\n" + report.Text()
+		nodes = report.Tags
+		// installments are recorded ahead, so the ones after the period are the commitments left
+		later, errLater := env.Storage.GetMoneyEventsByDateInterval(period.End, period.End.AddDate(0, installments.MaxCount, 0), user.UserID)
+		if errLater != nil {
+			log.Print(fmt.Errorf("error getting later money events in GiveStatistics: %v", errLater))
+		} else if summary := reports.NewInstallmentsSummary(spending, later); !summary.Empty() {
+			text += "\n\n" + summary.Text()
+		}
+	}
+	options := append(tagExpensesOptions(period, nodes), statisticsOptions(period, compare)...)
+	if len(nodes) > 0 {
+		text += "\n\nSelect a tag to see its expenses"
+	}
+	return []bot_interface.Message{{Text: text, Options: options}, provideMainOptions()}, nil
+}
+
+// statisticsOptions move statistics to the previous or the next period and switch between the budget and comparison
+func statisticsOptions(period reports.Period, compare bool) []bot_interface.Option {
+	mode, otherMode, otherModeText := "", compareMode+" ", "\xF0\x9F\x93\x88compare"
+	if compare {
+		mode, otherMode, otherModeText = compareMode+" ", "", "\xF0\x9F\x92\xB0budget"
+	}
+	return []bot_interface.Option{
+		{Id: mode + period.Previous().String(), Action: bot_interface.ActionStatistics, Text: "\xE2\x97\x80" + period.Previous().Title(), FullWidth: true},
+		{Id: mode + period.Next().String(), Action: bot_interface.ActionStatistics, Text: period.Next().Title() + "\xE2\x96\xB6", FullWidth: true},
+		{Id: otherMode + period.String(), Action: bot_interface.ActionStatistics, Text: otherModeText},
+		{Id: period.String(), Action: bot_interface.ActionCharts, Text: "\xF0\x9F\x93\x8Acharts"},
+	}
+}
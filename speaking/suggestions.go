@@ -0,0 +1,112 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/categorization"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"time"
+)
+
+const (
+	// suggestionHistoryYears is how far back user's expenses are read to learn tag suggestions
+	suggestionHistoryYears = 1
+	// suggestedMark highlights the tag the bot suggests
+	suggestedMark = "\xE2\xAD\x90"
+)
+
+// suggestedTagOptions orders tags keyboard by how likely each tag is for the expense judging by user's
+// own history. The most likely tag is highlighted. Expenses of nested tags count for their top level tag
+func (env MessagingPlatform) suggestedTagOptions(user bot_interface.BotRecipient, amount float32, comment string) []bot_interface.Option {
+	options := env.tagOptions(user)
+	optionsByTag := make(map[string]bot_interface.Option)
+	var tags []string
+	for _, option := range options {
+		tag := option.Id
+		optionsByTag[tag] = option
+		tags = append(tags, tag)
+	}
+	now := time.Now()
+	learn := func() (*categorization.Suggester, error) { return env.learnSuggestions(user, now) }
+	var ranked []string
+	var ok bool
+	var err error
+	if env.Suggestions != nil {
+		ranked, ok, err = env.Suggestions.Rank(user.UserID, learn, tags, amount, comment, now)
+	} else {
+		var suggester *categorization.Suggester
+		if suggester, err = learn(); err == nil && !suggester.Empty() {
+			ranked, ok = suggester.Rank(tags, amount, comment, now), true
+		}
+	}
+	if err != nil {
+		log.Print(fmt.Errorf("error learning suggestions in suggestedTagOptions: %v", err))
+		return options
+	}
+	if !ok {
+		return options
+	}
+	var result []bot_interface.Option
+	for i, tag := range ranked {
+		option := optionsByTag[tag]
+		if i == 0 {
+			option.Text = suggestedMark + option.Text
+		}
+		result = append(result, option)
+	}
+	return result
+}
+
+// learnSuggestions makes a model of user's expenses of the last year
+func (env MessagingPlatform) learnSuggestions(user bot_interface.BotRecipient, now time.Time) (*categorization.Suggester, error) {
+	history, err := env.Storage.GetMoneyEventsByDateInterval(now.AddDate(-suggestionHistoryYears, 0, 0), now, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	userTags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in learnSuggestions: %v", err))
+	}
+	active := activeTags(userTags)
+	suggester := categorization.NewSuggester()
+	for _, event := range history {
+		suggester.Learn(topLevelTag(active, event.Tag), event.Amount, event.Comment, event.Created)
+	}
+	return suggester, nil
+}
+
+// updateSuggestions keeps the kept model of the user in step with expenses: forgotten ones are taken back
+// and learned ones are added. Expenses of the future, like next installments, are not learned until they come
+func (env MessagingPlatform) updateSuggestions(user bot_interface.BotRecipient, forgotten []storage_interface.MoneyEvent, learned []storage_interface.MoneyEvent) {
+	if env.Suggestions == nil {
+		return
+	}
+	userTags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in updateSuggestions: %v", err))
+		env.Suggestions.Forget(user.UserID)
+		return
+	}
+	active := activeTags(userTags)
+	now := time.Now()
+	env.Suggestions.Update(user.UserID, func(suggester *categorization.Suggester) {
+		for _, event := range forgotten {
+			if !event.Created.After(now) {
+				suggester.Forget(topLevelTag(active, event.Tag), event.Amount, event.Comment, event.Created)
+			}
+		}
+		for _, event := range learned {
+			if !event.Created.After(now) {
+				suggester.Learn(topLevelTag(active, event.Tag), event.Amount, event.Comment, event.Created)
+			}
+		}
+	})
+}
+
+// forgetSuggestions drops the model of the user after tags change, it is learned again when needed
+func (env MessagingPlatform) forgetSuggestions(user bot_interface.BotRecipient) {
+	if env.Suggestions != nil {
+		env.Suggestions.Forget(user.UserID)
+	}
+}
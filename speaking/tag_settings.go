@@ -0,0 +1,253 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/storage_interface"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	tagSettingEmoji   = "emoji"
+	tagSettingColor   = "color"
+	tagSettingUp      = "up"
+	tagSettingDown    = "down"
+	tagSettingArchive = "archive"
+
+	// clearTagSetting typed instead of an emoji or a color removes it
+	clearTagSetting = "-"
+)
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+var tagColors = []bot_interface.Option{
+	{Id: "#e53935", Action: bot_interface.ActionColor, Text: "\xF0\x9F\x94\xB4"},
+	{Id: "#fb8c00", Action: bot_interface.ActionColor, Text: "\xF0\x9F\x9F\xA0"},
+	{Id: "#fdd835", Action: bot_interface.ActionColor, Text: "\xF0\x9F\x9F\xA1"},
+	{Id: "#43a047", Action: bot_interface.ActionColor, Text: "\xF0\x9F\x9F\xA2"},
+	{Id: "#1e88e5", Action: bot_interface.ActionColor, Text: "\xF0\x9F\x94\xB5"},
+	{Id: "#8e24aa", Action: bot_interface.ActionColor, Text: "\xF0\x9F\x9F\xA3"},
+	{Id: "#6d4c41", Action: bot_interface.ActionColor, Text: "\xF0\x9F\x9F\xA4"},
+	{Id: "#424242", Action: bot_interface.ActionColor, Text: "\xE2\x9A\xAB"},
+}
+
+// SelectTagInTagsList opens settings of a tapped user's tag or adds a tapped default tag
+func (env MessagingPlatform) SelectTagInTagsList(user bot_interface.BotRecipient, name string) ([]bot_interface.Message, error) {
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in SelectTagInTagsList: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	if tag, ok := storage_interface.FindTag(activeTags(tags), name); ok {
+		return env.ShowTagSettings(user, tag.Name)
+	}
+	return env.UpdateTag(user, name)
+}
+
+func (env MessagingPlatform) ShowTagSettings(user bot_interface.BotRecipient, name string) ([]bot_interface.Message, error) {
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in ShowTagSettings: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	tag, ok := storage_interface.FindTag(tags, name)
+	if !ok {
+		return []bot_interface.Message{{Text: "I didn't find tag '" + name + "'. Sorry"}}, nil
+	}
+	errSavingState := env.Storage.SetState(user.UserID, fmt.Sprintf("%s %s", bot_interface.StateEditTag, tag.Name))
+	if errSavingState != nil {
+		log.Print(fmt.Errorf("error saving user state in ShowTagSettings: %v", errSavingState))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, errSavingState
+	}
+	color := tag.Color
+	if color == "" {
+		color = "not set"
+	}
+	siblings := siblingTags(activeTags(tags), tag)
+	position := 0
+	for i, sibling := range siblings {
+		if sibling.ID == tag.ID {
+			position = i + 1
+		}
+	}
+	text := fmt.Sprintf("Tag %s\nColor: %s\nPosition: %d of %d\nWhat do you want to change?", tagLabel(tag), color, position, len(siblings))
+	options := []bot_interface.Option{
+		{Id: tagSettingEmoji, Action: bot_interface.ActionEditTag, Text: "\xF0\x9F\x98\x80emoji"},
+		{Id: tagSettingColor, Action: bot_interface.ActionEditTag, Text: "\xF0\x9F\x8E\xA8color"},
+		{Id: tagSettingUp, Action: bot_interface.ActionEditTag, Text: "\xE2\xAC\x86up"},
+		{Id: tagSettingDown, Action: bot_interface.ActionEditTag, Text: "\xE2\xAC\x87down"},
+		{Id: tagSettingArchive, Action: bot_interface.ActionEditTag, Text: "\xF0\x9F\x97\x84archive"},
+		{Id: bot_interface.CommandDefineTags, Action: bot_interface.ActionCommand, Text: "\xE2\xAC\x85back", FullWidth: true},
+	}
+	return []bot_interface.Message{{Text: text, Options: options, Layout: bot_interface.Layout{Columns: 2, WithFinishOption: true}}}, nil
+}
+
+// EditTagSetting reacts to a button in tag settings. The tag itself is remembered in state
+func (env MessagingPlatform) EditTagSetting(user bot_interface.BotRecipient, userState string, setting string) ([]bot_interface.Message, error) {
+	name := trimStringFromFirstSpace(userState)
+	var nextState string
+	var reply bot_interface.Message
+	switch setting {
+	case tagSettingEmoji:
+		nextState = bot_interface.StateTagEmoji
+		reply = bot_interface.Message{Text: fmt.Sprintf("Send an emoji for '%s' or '%s' to remove it", name, clearTagSetting)}
+	case tagSettingColor:
+		nextState = bot_interface.StateTagColor
+		reply = bot_interface.Message{Text: fmt.Sprintf("Select a color for '%s' charts or type it like #1e88e5 ('%s' to remove it)", name, clearTagSetting), Options: tagColors, Layout: bot_interface.Layout{WithFinishOption: true}}
+	case tagSettingUp:
+		return env.moveTag(user, name, -1)
+	case tagSettingDown:
+		return env.moveTag(user, name, 1)
+	case tagSettingArchive:
+		return env.ArchiveTag(user, name)
+	default:
+		log.Print("ERROR unrecognized tag setting: " + setting)
+		return []bot_interface.Message{{Text: "I didn't recognize the command. Sorry"}}, nil
+	}
+	err := env.Storage.SetState(user.UserID, fmt.Sprintf("%s %s", nextState, name))
+	if err != nil {
+		log.Print(fmt.Errorf("error setting state in EditTagSetting: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	return []bot_interface.Message{reply}, nil
+}
+
+// updateTag loads the tag remembered in state, applies the change and saves its appearance
+func (env MessagingPlatform) updateTag(user bot_interface.BotRecipient, userState string, change func(tag *storage_interface.Tag)) ([]bot_interface.Message, error) {
+	name := trimStringFromFirstSpace(userState)
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in updateTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	tag, ok := storage_interface.FindTag(tags, name)
+	if !ok {
+		return []bot_interface.Message{{Text: "I didn't find tag '" + name + "'. Sorry"}}, nil
+	}
+	change(&tag)
+	err = env.Storage.UpdateTagAppearance(tag.Name, tag.Emoji, tag.Color, tag.SortOrder, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error updating tag in updateTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	return env.ShowTagSettings(user, tag.Name)
+}
+
+func (env MessagingPlatform) SetTagEmoji(user bot_interface.BotRecipient, userState string, emoji string) ([]bot_interface.Message, error) {
+	emoji = strings.TrimSpace(emoji)
+	if emoji == clearTagSetting {
+		emoji = ""
+	} else if !isEmoji(emoji) {
+		return []bot_interface.Message{{Text: fmt.Sprintf("Please send a single emoji or '%s' to remove it", clearTagSetting)}}, nil
+	}
+	return env.updateTag(user, userState, func(tag *storage_interface.Tag) {
+		tag.Emoji = emoji
+	})
+}
+
+func (env MessagingPlatform) SetTagColor(user bot_interface.BotRecipient, userState string, color string) ([]bot_interface.Message, error) {
+	color = strings.ToLower(strings.TrimSpace(color))
+	if color == clearTagSetting {
+		color = ""
+	} else if !colorPattern.MatchString(color) {
+		return []bot_interface.Message{{Text: fmt.Sprintf("Please select a color or type it like #1e88e5 ('%s' to remove it)", clearTagSetting)}}, nil
+	}
+	return env.updateTag(user, userState, func(tag *storage_interface.Tag) {
+		tag.Color = color
+	})
+}
+
+// moveTag swaps the tag with its neighbour on the same level and saves new positions of all the tags
+func (env MessagingPlatform) moveTag(user bot_interface.BotRecipient, name string, shift int) ([]bot_interface.Message, error) {
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in moveTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	tag, ok := storage_interface.FindTag(tags, name)
+	if !ok {
+		return []bot_interface.Message{{Text: "I didn't find tag '" + name + "'. Sorry"}}, nil
+	}
+	siblings := siblingTags(activeTags(tags), tag)
+	for i, sibling := range siblings {
+		if sibling.ID == tag.ID && i+shift >= 0 && i+shift < len(siblings) {
+			swapTags(tags, sibling.ID, siblings[i+shift].ID)
+			break
+		}
+	}
+	for position, current := range tags {
+		if current.SortOrder == position {
+			continue
+		}
+		err = env.Storage.UpdateTagAppearance(current.Name, current.Emoji, current.Color, position, user.UserID)
+		if err != nil {
+			log.Print(fmt.Errorf("error updating tag position in moveTag: %v", err))
+			return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+		}
+	}
+	return env.ShowTagSettings(user, name)
+}
+
+func swapTags(tags []storage_interface.Tag, firstID int, secondID int) {
+	first, second := -1, -1
+	for i, tag := range tags {
+		if tag.ID == firstID {
+			first = i
+		}
+		if tag.ID == secondID {
+			second = i
+		}
+	}
+	if first != -1 && second != -1 {
+		tags[first], tags[second] = tags[second], tags[first]
+	}
+}
+
+// siblingTags are tags shown on the same keyboard level as the tag
+func siblingTags(tags []storage_interface.Tag, tag storage_interface.Tag) []storage_interface.Tag {
+	var result []storage_interface.Tag
+	parentID := visibleParentID(tags, tag)
+	for _, current := range tags {
+		if visibleParentID(tags, current) == parentID {
+			result = append(result, current)
+		}
+	}
+	return result
+}
+
+func isEmoji(text string) bool {
+	if text == "" || len(text) > 16 {
+		return false
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// giveEmoji puts the emoji to the user's tag if the tag has no emoji yet. Without the emoji the one of the default tag
+// with the same name is used
+func (env MessagingPlatform) giveEmoji(user bot_interface.BotRecipient, name string, emoji string) {
+	if emoji == "" {
+		emoji = defaultEmoji(name)
+	}
+	if emoji == "" {
+		return
+	}
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in giveEmoji: %v", err))
+		return
+	}
+	if tag, ok := storage_interface.FindTag(tags, name); ok && tag.Emoji == "" {
+		err = env.Storage.UpdateTagAppearance(tag.Name, emoji, tag.Color, tag.SortOrder, user.UserID)
+		if err != nil {
+			log.Print(fmt.Errorf("error updating tag emoji in giveEmoji: %v", err))
+		}
+	}
+}
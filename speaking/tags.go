@@ -0,0 +1,257 @@
+package speaking
+
+import (
+	"fmt"
+	"ingresos_gastos/bot_interface"
+	"ingresos_gastos/storage_interface"
+	"ingresos_gastos/tagpolicy"
+	"log"
+	"strings"
+)
+
+// chooseTag shows user's active tags as a keyboard and remembers what to do with the selected one in state
+func (env MessagingPlatform) chooseTag(user bot_interface.BotRecipient, state string, text string, excludedTag string) ([]bot_interface.Message, error) {
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting user tags in chooseTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	var options []bot_interface.Option
+	for _, tag := range activeTags(tags) {
+		if tag.Name != excludedTag {
+			options = append(options, bot_interface.Option{Id: tag.Name, Action: bot_interface.ActionTag, Text: tagLabel(tag)})
+		}
+	}
+	if len(options) == 0 {
+		return []bot_interface.Message{{Text: fmt.Sprintf("You have no tags for this. Create them with /%s", bot_interface.CommandDefineTags)}, provideMainOptions()}, nil
+	}
+	errSavingState := env.Storage.SetState(user.UserID, state)
+	if errSavingState != nil {
+		log.Print(fmt.Errorf("error saving user state in chooseTag: %v", errSavingState))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, errSavingState
+	}
+	return []bot_interface.Message{{Text: text, Options: options, Layout: tagChoiceLayout}}, nil
+}
+
+func (env MessagingPlatform) tagExists(user bot_interface.BotRecipient, name string) (bool, error) {
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		return false, err
+	}
+	for _, tag := range tags {
+		if strings.EqualFold(tag.Name, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (env MessagingPlatform) StartRenamingTag(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
+	return env.chooseTag(user, bot_interface.StateRenameTag, "Select a tag to rename", "")
+}
+
+func (env MessagingPlatform) SelectTagToRename(user bot_interface.BotRecipient, tag string) ([]bot_interface.Message, error) {
+	err := env.Storage.SetState(user.UserID, fmt.Sprintf("%s %s", bot_interface.StateRenameTag, tag))
+	if err != nil {
+		log.Print(fmt.Errorf("error setting state in SelectTagToRename: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	return []bot_interface.Message{{Text: "Enter a new name for '" + tag + "'. All its expenses and budgets will follow"}}, nil
+}
+
+// RenameTag gives the tag remembered in state a new name typed by user
+func (env MessagingPlatform) RenameTag(user bot_interface.BotRecipient, userState string, newName string) ([]bot_interface.Message, error) {
+	oldName := trimStringFromFirstSpace(userState)
+	if oldName == userState {
+		return []bot_interface.Message{{Text: "Please select a tag to rename first"}}, nil
+	}
+	newName, _, errNormalizing := tagpolicy.Normalize(newName)
+	if errNormalizing != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't use it as a tag: %v. Please try again", errNormalizing)}}, nil
+	}
+	exists, err := env.tagExists(user, newName)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in RenameTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	if exists {
+		return []bot_interface.Message{{Text: fmt.Sprintf("Tag '%s' already exists. Use /%s to join these tags", newName, bot_interface.CommandMergeTags)}}, nil
+	}
+	err = env.Storage.RenameTag(oldName, newName, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error renaming tag in RenameTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	env.forgetSuggestions(user)
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in RenameTag: %v", err))
+	}
+	return []bot_interface.Message{{Text: fmt.Sprintf("Tag '%s' is now '%s'", oldName, newName)}, provideMainOptions()}, nil
+}
+
+func (env MessagingPlatform) StartMergingTags(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
+	return env.chooseTag(user, bot_interface.StateMergeTags, "Select a tag to merge. It will disappear and its history will move to another tag", "")
+}
+
+// SelectTagToMerge is called twice: first for the tag which disappears and then for the tag which stays
+func (env MessagingPlatform) SelectTagToMerge(user bot_interface.BotRecipient, userState string, tag string) ([]bot_interface.Message, error) {
+	fromTag := trimStringFromFirstSpace(userState)
+	if fromTag == userState {
+		return env.chooseTag(user, fmt.Sprintf("%s %s", bot_interface.StateMergeTags, tag), "Select a tag to merge '"+tag+"' into", tag)
+	}
+	if fromTag == tag {
+		return []bot_interface.Message{{Text: fmt.Sprintf("Please select another tag to merge '%s' into", tag)}}, nil
+	}
+	err := env.Storage.MergeTags(fromTag, tag, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error merging tags in SelectTagToMerge: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	env.forgetSuggestions(user)
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in SelectTagToMerge: %v", err))
+	}
+	return []bot_interface.Message{{Text: fmt.Sprintf("Tag '%s' is merged into '%s'", fromTag, tag)}, provideMainOptions()}, nil
+}
+
+func (env MessagingPlatform) StartArchivingTag(user bot_interface.BotRecipient) ([]bot_interface.Message, error) {
+	return env.chooseTag(user, bot_interface.StateArchiveTag, "Select a tag to archive. It won't be offered anymore, but its history stays in your statistics", "")
+}
+
+func (env MessagingPlatform) ArchiveTag(user bot_interface.BotRecipient, tag string) ([]bot_interface.Message, error) {
+	err := env.Storage.ArchiveTagForUser(tag, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error archiving tag in ArchiveTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	env.forgetSuggestions(user)
+	err = env.Storage.SetState(user.UserID, "")
+	if err != nil {
+		log.Print(fmt.Errorf("error updating state in ArchiveTag: %v", err))
+	}
+	reply := fmt.Sprintf("Tag '%s' archived. To bring it back type it in /%s", tag, bot_interface.CommandDefineTags)
+	return []bot_interface.Message{{Text: reply}, provideMainOptions()}, nil
+}
+
+// AddNestedTag creates a tag typed as "Parent>Tag" together with its parent when needed.
+// Typed as ">Tag" it moves the tag to the top level
+func (env MessagingPlatform) AddNestedTag(user bot_interface.BotRecipient, parent string, tag string) ([]bot_interface.Message, error) {
+	if tag == "" || strings.Contains(tag, ">") {
+		return []bot_interface.Message{{Text: "Please type a nested tag like 'Food>Groceries'"}}, nil
+	}
+	tag, emoji, errNormalizing := tagpolicy.Normalize(tag)
+	if errNormalizing != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't use it as a tag: %v", errNormalizing)}}, nil
+	}
+	parentEmoji := ""
+	if parent != "" {
+		parent, parentEmoji, errNormalizing = tagpolicy.Normalize(parent)
+		if errNormalizing != nil {
+			return []bot_interface.Message{{Text: fmt.Sprintf("I can't use it as a parent tag: %v", errNormalizing)}}, nil
+		}
+	}
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in AddNestedTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	if parent == tag || isTagInside(tags, parent, tag) {
+		return []bot_interface.Message{{Text: fmt.Sprintf("'%s' can't be inside '%s' because it already contains it", tag, parent)}}, nil
+	}
+	for _, newTag := range []struct{ name, emoji string }{{parent, parentEmoji}, {tag, emoji}} {
+		if newTag.name == "" {
+			continue
+		}
+		err = env.Storage.AddTagForUser(newTag.name, user.UserID)
+		if err != nil {
+			log.Print(fmt.Errorf("error adding tag in AddNestedTag: %v", err))
+			return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+		}
+		env.giveEmoji(user, newTag.name, newTag.emoji)
+	}
+	err = env.Storage.SetTagParent(tag, parent, user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error setting tag parent in AddNestedTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	env.forgetSuggestions(user)
+	if parent == "" {
+		return []bot_interface.Message{{Text: "Tag '" + tag + "' is on the top level now"}, provideMainOptions()}, nil
+	}
+	return []bot_interface.Message{{Text: fmt.Sprintf("Tag '%s' added inside '%s'", tag, parent)}, provideMainOptions()}, nil
+}
+
+// OpenTagLevel shows children of the parent tag or top level tags for an empty parent
+func (env MessagingPlatform) OpenTagLevel(user bot_interface.BotRecipient, parent string) ([]bot_interface.Message, error) {
+	return []bot_interface.Message{{Text: "Select a category", Options: env.tagLevelOptions(user, parent), Layout: tagChoiceLayout}}, nil
+}
+
+// tagLevelOptions gives keyboard for one level of user's tags: top level tags for an empty parent or children of
+// the parent. Tags having children open their own level instead of being selected
+func (env MessagingPlatform) tagLevelOptions(user bot_interface.BotRecipient, parent string) []bot_interface.Option {
+	tags, err := env.Storage.GetTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in tagLevelOptions: %v", err))
+	}
+	active := activeTags(tags)
+	if len(active) == 0 {
+		return defaultTags
+	}
+	levelID := 0
+	var options []bot_interface.Option
+	if parentTag, ok := storage_interface.FindTag(active, parent); ok {
+		levelID = parentTag.ID
+		options = append(options, bot_interface.Option{Id: parentTag.Name, Action: bot_interface.ActionTag, Text: tagLabel(parentTag) + " (general)", FullWidth: true})
+	}
+	for _, tag := range active {
+		if visibleParentID(active, tag) != levelID {
+			continue
+		}
+		if hasChildren(active, tag.ID) {
+			options = append(options, bot_interface.Option{Id: tag.Name, Action: bot_interface.ActionOpenTag, Text: tagLabel(tag) + " \xE2\x80\xBA"})
+		} else {
+			options = append(options, bot_interface.Option{Id: tag.Name, Action: bot_interface.ActionTag, Text: tagLabel(tag)})
+		}
+	}
+	if levelID != 0 {
+		options = append(options, bot_interface.Option{Action: bot_interface.ActionOpenTag, Text: "\xE2\xAC\x85back", FullWidth: true})
+	}
+	return options
+}
+
+// isExpenseTagChoice tells if user is choosing a tag of an expense, then a typed name is taken as the tag
+func isExpenseTagChoice(userState string) bool {
+	for _, state := range []string{bot_interface.StateSpending, bot_interface.StateNotification, bot_interface.StateReceipt, bot_interface.StateChangeTag} {
+		if strings.HasPrefix(userState, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTypedTag takes the name typed while choosing a tag of an expense like a pressed tag button.
+// A tag user doesn't have yet is added first
+func (env MessagingPlatform) SetTypedTag(user bot_interface.BotRecipient, name string) ([]bot_interface.Message, error) {
+	tag, emoji, errNormalizing := tagpolicy.Normalize(name)
+	if errNormalizing != nil {
+		return []bot_interface.Message{{Text: fmt.Sprintf("I can't use it as a tag: %v. Please choose a tag or type another name", errNormalizing)}}, nil
+	}
+	tags, err := env.Storage.GetUserTags(user.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting tags in SetTypedTag: %v", err))
+		return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+	}
+	if existingTag, found := findTag(tag, tags); found {
+		tag = existingTag
+	} else {
+		if err := env.Storage.AddTagForUser(tag, user.UserID); err != nil {
+			log.Print(fmt.Errorf("error adding tag in SetTypedTag: %v", err))
+			return []bot_interface.Message{{Text: "Problem working with your profile in our system. Please try again later"}}, err
+		}
+		env.forgetSuggestions(user)
+		env.giveEmoji(user, tag, emoji)
+	}
+	return env.DetectAppropriateActionForButton(user, bot_interface.Callback{Action: bot_interface.ActionTag, Value: tag})
+}
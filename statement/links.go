@@ -0,0 +1,78 @@
+package statement
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+)
+
+// DownloadPath is where the HTTP server gives statements
+const DownloadPath = "/statement"
+
+// Links makes signed download links, so a user can get only own statements. Without BaseURL there are no links
+type Links struct {
+	BaseURL string
+	Secret  []byte
+}
+
+// URL is the link to download the statement of the user for the period or an empty string
+func (links Links) URL(userID int64, period reports.Period) string {
+	if links.BaseURL == "" || len(links.Secret) == 0 {
+		return ""
+	}
+	query := url.Values{}
+	query.Set("user", strconv.FormatInt(userID, 10))
+	query.Set("period", period.String())
+	query.Set("token", links.token(userID, period.String()))
+	return strings.TrimSuffix(links.BaseURL, "/") + DownloadPath + "?" + query.Encode()
+}
+
+func (links Links) token(userID int64, period string) string {
+	mac := hmac.New(sha256.New, links.Secret)
+	fmt.Fprintf(mac, "statement:%d:%s", userID, period)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Handler gives the statement as a PDF file for a link made by [Links.URL]
+func (links Links) Handler(storage storage_interface.ActualStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		userID, err := strconv.ParseInt(query.Get("user"), 10, 64)
+		if err != nil || len(links.Secret) == 0 ||
+			!hmac.Equal([]byte(links.token(userID, query.Get("period"))), []byte(query.Get("token"))) {
+			http.Error(w, "statement not found", http.StatusNotFound)
+			return
+		}
+		period, err := reports.ParsePeriod(query.Get("period"), time.Now())
+		if err != nil {
+			http.Error(w, "statement not found", http.StatusNotFound)
+			return
+		}
+		document, err := Generate(storage, userID, period, time.Now())
+		if err != nil {
+			log.Print(fmt.Errorf("error generating statement for download: %v", err))
+			http.Error(w, "problem generating the statement", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", FileName(period)))
+		if _, err = w.Write(document); err != nil {
+			log.Print(fmt.Errorf("error writing statement for download: %v", err))
+		}
+	}
+}
+
+// FileName is how the statement file of the period is called
+func FileName(period reports.Period) string {
+	return "statement-" + period.String() + ".pdf"
+}
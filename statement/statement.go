@@ -0,0 +1,182 @@
+// Package statement prints a period of user's spending as a PDF: totals by tag, budget adherence,
+// income vs expenses and the full list of transactions
+package statement
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ingresos_gastos/pdf"
+	"ingresos_gastos/reports"
+	"ingresos_gastos/storage_interface"
+)
+
+const (
+	margin     = 50.0
+	lineHeight = 15.0
+	titleSize  = 18.0
+	headerSize = 12.0
+	textSize   = 9.0
+	// column positions of the tables
+	amountColumn  = pdf.PageWidth - margin
+	budgetColumn  = amountColumn - 90
+	spentColumn   = budgetColumn - 90
+	tagColumn     = margin + 70
+	commentColumn = tagColumn + 110
+	indent        = 12.0
+)
+
+// Generate reads spending of the user for the period from the storage and prints the statement
+func Generate(storage storage_interface.ActualStorage, userID int64, period reports.Period, now time.Time) ([]byte, error) {
+	events, err := storage.GetMoneyEventsByDateInterval(period.Start, period.End, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting money events for statement: %v", err)
+	}
+	targets, err := storage.GetTargets(period.Start, period.End, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting targets for statement: %v", err)
+	}
+	tags, err := storage.GetTags(userID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting tags for statement: %v", err)
+	}
+	return Print(tags, events, targets, period, now), nil
+}
+
+// Print makes the statement. Events with negative amounts are income, like a salary or a refund.
+// The income section is printed only when there is some
+func Print(tags []storage_interface.Tag, events []storage_interface.MoneyEvent, targets []storage_interface.Target, period reports.Period, now time.Time) []byte {
+	writer := &pageWriter{document: pdf.New(), y: pdf.PageHeight - margin}
+	writer.document.Text(margin, writer.y, titleSize, true, "Statement for "+period.Title())
+	writer.y -= lineHeight
+	writer.document.Text(margin, writer.y, textSize, false, "Generated on "+now.Format("2 January 2006 15:04"))
+	writer.y -= 2 * lineHeight
+
+	var expenses []storage_interface.MoneyEvent
+	var income, spent float32
+	for _, event := range events {
+		if !reports.Countable(event) {
+			continue
+		}
+		if event.Amount < 0 {
+			income -= event.Amount
+		} else {
+			expenses = append(expenses, event)
+			spent += event.Amount
+		}
+	}
+	report := reports.NewBudgetReport(tags, expenses, targets, period.Start, period.End, now)
+
+	writer.header("Totals by tag")
+	writer.row(true, margin, "Tag", "Spent", "Budget", "Used")
+	for _, node := range reports.Flatten(report.Tags) {
+		budgetText, used := "", ""
+		if budget, ok := node.Budget(); ok {
+			budgetText, used = amount(budget), reports.PercentUsed(node.Total, budget)
+		}
+		writer.row(false, margin+indent*float64(node.Depth), node.Name, amount(node.Total), budgetText, used)
+	}
+	writer.document.Line(margin, writer.y+lineHeight-3, amountColumn, writer.y+lineHeight-3)
+	if report.HasBudget {
+		writer.row(true, margin, "Total", amount(report.Spent), amount(report.Budget), reports.PercentUsed(report.Spent, report.Budget))
+	} else {
+		writer.row(true, margin, "Total", amount(report.Spent), "", "")
+	}
+	writer.y -= lineHeight
+
+	writer.header("Budget adherence")
+	if !report.HasBudget {
+		writer.line("No budget was set for this period")
+	} else {
+		var over []string
+		for _, node := range reports.Flatten(report.Tags) {
+			if budget, ok := node.Budget(); ok && node.Total > budget {
+				over = append(over, fmt.Sprintf("%s: %s over the budget of %s", node.Name, amount(node.Total-budget), amount(budget)))
+			}
+		}
+		if report.Spent <= report.Budget {
+			writer.line(fmt.Sprintf("Total spending is within the budget, %s left", amount(report.Budget-report.Spent)))
+		} else {
+			writer.line(fmt.Sprintf("Total spending is %s over the budget", amount(report.Spent-report.Budget)))
+		}
+		if len(over) == 0 {
+			writer.line("Every tag is within its budget")
+		}
+		for _, line := range over {
+			writer.line(line)
+		}
+	}
+	writer.y -= lineHeight
+
+	if income > 0 {
+		writer.header("Income vs expenses")
+		writer.row(false, margin, "Income", "", "", amount(income))
+		writer.row(false, margin, "Expenses", "", "", amount(spent))
+		writer.row(true, margin, "Net", "", "", amount(income-spent))
+		writer.y -= lineHeight
+	}
+
+	writer.header(fmt.Sprintf("Transactions (%d)", len(events)))
+	writer.transaction(true, "Date", "Tag", "Comment", "Amount")
+	for _, event := range events {
+		writer.transaction(false, event.Created.Format("2006-01-02"), event.Tag, event.Comment, amount(event.Amount))
+	}
+	return writer.document.Bytes()
+}
+
+func amount(value float32) string {
+	return fmt.Sprintf("%.2f", value)
+}
+
+// pageWriter keeps the position of the next line and starts a new page when the current one is full
+type pageWriter struct {
+	document *pdf.Document
+	y        float64
+}
+
+func (writer *pageWriter) nextLine() {
+	writer.y -= lineHeight
+	if writer.y < margin {
+		writer.document.AddPage()
+		writer.y = pdf.PageHeight - margin
+	}
+}
+
+func (writer *pageWriter) header(text string) {
+	if writer.y < margin+3*lineHeight {
+		writer.document.AddPage()
+		writer.y = pdf.PageHeight - margin
+	}
+	writer.document.Text(margin, writer.y, headerSize, true, text)
+	writer.nextLine()
+}
+
+func (writer *pageWriter) line(text string) {
+	writer.document.Text(margin, writer.y, textSize, false, text)
+	writer.nextLine()
+}
+
+// row is a line of the tags table: the name and three numbers aligned right
+func (writer *pageWriter) row(bold bool, x float64, name, spent, budget, used string) {
+	if bold {
+		writer.document.Box(margin-2, writer.y-4, amountColumn-margin+4, lineHeight, 0.92)
+	}
+	writer.document.Text(x, writer.y, textSize, bold, pdf.Fit(name, textSize, spentColumn-x-60))
+	writer.document.TextRight(spentColumn, writer.y, textSize, bold, spent)
+	writer.document.TextRight(budgetColumn, writer.y, textSize, bold, budget)
+	writer.document.TextRight(amountColumn, writer.y, textSize, bold, used)
+	writer.nextLine()
+}
+
+func (writer *pageWriter) transaction(bold bool, date, tag, comment, value string) {
+	if bold {
+		writer.document.Box(margin-2, writer.y-4, amountColumn-margin+4, lineHeight, 0.92)
+	}
+	comment = strings.Join(strings.Fields(comment), " ")
+	writer.document.Text(margin, writer.y, textSize, bold, date)
+	writer.document.Text(tagColumn, writer.y, textSize, bold, pdf.Fit(tag, textSize, commentColumn-tagColumn-5))
+	writer.document.Text(commentColumn, writer.y, textSize, bold, pdf.Fit(comment, textSize, amountColumn-commentColumn-70))
+	writer.document.TextRight(amountColumn, writer.y, textSize, bold, value)
+	writer.nextLine()
+}
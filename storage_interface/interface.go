@@ -10,26 +10,74 @@ import (
 type ActualStorage interface {
 	CreateUser(userID int64, name string) error
 	UserExists(userID int64) (bool, error)
+	GetUsers() ([]User, error)
 	SetState(userID int64, state string) error
 	GetUserState(userID int64) (string, error)
 
 	CreateTarget(tag string, amount float32, periodStart time.Time, periodEnd time.Time, userID int64) error
 	GetTargets(periodStart time.Time, periodEnd time.Time, userID int64) ([]Target, error)
 
-	CreateMoneyEvent(amount float32, currency, comment, tag string, userID int64) error
+	// CreateMoneyEvents sets IDs of the created events in the slice
+	CreateMoneyEvents(events []MoneyEvent, userID int64) error
+	// CreatePurchase saves the purchase with its installments, IDs are set in the slice
+	CreatePurchase(purchase Purchase, events []MoneyEvent, userID int64) (int, error)
+	GetPurchase(purchaseID int, userID int64) (Purchase, error)
+	// GetPurchaseInstallments gives all installments of the purchase ordered by date
+	GetPurchaseInstallments(purchaseID int, userID int64) ([]MoneyEvent, error)
+	// DeletePurchase deletes the purchase with all its installments
+	DeletePurchase(purchaseID int, userID int64) error
 	GetMoneyEventsByDateInterval(startDate, endDate time.Time, userID int64) ([]MoneyEvent, error)
+	UpdateMoneyEventTag(eventID int, tag string, userID int64) error
+	GetMoneyEvent(eventID int, userID int64) (MoneyEvent, error)
+	UpdateMoneyEvent(eventID int, amount float32, comment string, userID int64) error
+	DeleteMoneyEvent(eventID int, userID int64) error
 
 	AddTagForUser(tag string, userID int64) error
-	RemoveTagForUser(tag string, userID int64) error
+	ArchiveTagForUser(tag string, userID int64) error
+	RenameTag(oldName, newName string, userID int64) error
+	MergeTags(fromTag, intoTag string, userID int64) error
+	SetTagParent(tag, parent string, userID int64) error
+	UpdateTagAppearance(tag, emoji, color string, sortOrder int, userID int64) error
 	GetUserTags(userID int64) ([]string, error)
+	GetTags(userID int64) ([]Tag, error)
+
+	CreateCategorizationRule(expression, tag string, userID int64) error
+	GetCategorizationRules(userID int64) ([]CategorizationRule, error)
+	DeleteCategorizationRule(ruleID int, userID int64) error
 
 	SaveFeedback(userID int64, message string) error
 
 	SaveMessage(message Message) error
 	GetMessages(userId int64) ([]Message, error)
+	GetMessageReference(messageID string, userID int64) (string, error)
 	ClearOutgoingMessagesForUser(userID int64) error
 
 	SaveUsageLog(userId int64, replyType string) error
+
+	SaveCallbackValue(value string) (string, error)
+	GetCallbackValue(key string) (string, error)
+
+	StatementDelivered(userID int64, periodStart time.Time) (bool, error)
+	SaveStatementDelivery(userID int64, periodStart time.Time) error
+
+	GetLedgerMapping(userID int64) (string, error)
+	SaveLedgerMapping(userID int64, mapping string) error
+
+	SavePendingImport(pending PendingImport) error
+	GetPendingImport(userID int64) (PendingImport, error)
+	DeletePendingImport(userID int64) error
+	GetImportProfile(userID int64, signature string) (string, error)
+	SaveImportProfile(userID int64, signature, columns string) error
+
+	CreateAccount(account Account) (int, error)
+	GetAccounts(userID int64) ([]Account, error)
+	CreateTransfer(transfer Transfer) (int, error)
+	GetTransfersByDateInterval(startDate, endDate time.Time, userID int64) ([]Transfer, error)
+
+	SaveAttachment(attachment Attachment) (int, error)
+	GetAttachment(attachmentID int, userID int64) (Attachment, error)
+	GetAttachments(eventID int, userID int64) ([]Attachment, error)
+	CountAttachments(eventIDs []int, userID int64) (map[int]int, error)
 }
 
 // User is a telegram user, who once spoke with the bot_interface
@@ -40,6 +88,41 @@ type User struct {
 	Created time.Time
 }
 
+// Tag is a category of spending. Archived tags are not offered to the [User] anymore,
+// but their [MoneyEvent] and [Target] history stays in reports.
+// Tags can be nested: ParentID points to a broader tag (like Food for Groceries) or is 0 for top level tags.
+// Emoji is shown in keyboards and reports, Color is used in charts and tags are listed by SortOrder
+type Tag struct {
+	ID        int
+	Name      string
+	Archived  bool
+	ParentID  int
+	Emoji     string
+	Color     string
+	SortOrder int
+	UserID    int
+}
+
+// FindTag looks for the tag by its name
+func FindTag(tags []Tag, name string) (Tag, bool) {
+	for _, tag := range tags {
+		if tag.Name == name {
+			return tag, true
+		}
+	}
+	return Tag{}, false
+}
+
+// FindTagByID looks for the tag by its id
+func FindTagByID(tags []Tag, id int) (Tag, bool) {
+	for _, tag := range tags {
+		if tag.ID == id {
+			return tag, true
+		}
+	}
+	return Tag{}, false
+}
+
 // Target describes how much money the [User] wants to spend in the period for a special spending tag.
 // Usually it is about current month
 type Target struct {
@@ -52,19 +135,108 @@ type Target struct {
 }
 
 // MoneyEvent is a spending event. It happens when [User] spends some money in a cafe or buys something
-// and tells this fact to the bot_interface
+// and tells this fact to the bot_interface. ExternalID is the id of the transaction in the bank's file it was imported from.
+// MerchantID is the tax id (CUIT) of the seller when it is known, like from the QR code of a receipt.
+// PurchaseID links an installment with its [Purchase], it is 0 for other events.
+// AccountID is the [Account] the money came from, it is 0 when user didn't tell it
 type MoneyEvent struct {
+	ID         int
+	Amount     float32
+	Currency   string
+	Comment    string
+	Tag        string
+	Created    time.Time
+	UserID     int
+	ExternalID string
+	MerchantID string
+	PurchaseID int
+	AccountID  int
+}
+
+// Purchase is something bought in monthly installments. Every installment is a [MoneyEvent] of its month,
+// the purchase itself keeps the total and isn't counted in statistics
+type Purchase struct {
+	ID           int
+	Amount       float32
+	Currency     string
+	Comment      string
+	Installments int
+	Created      time.Time
+	UserID       int64
+}
+
+// CategorizationRule lets the [User] skip choosing a tag: when a new [MoneyEvent] fits the Expression
+// (like "comment contains subte") it gets the Tag automatically
+type CategorizationRule struct {
+	ID         int
+	Expression string
+	Tag        string
+	UserID     int
+}
+
+// PendingImport is a file the [User] sent to import money events from, it waits for confirmation.
+// Columns tell which columns of the file mean what, they are empty until they are known
+type PendingImport struct {
+	UserID   int64
+	FileName string
+	Content  []byte
+	Columns  string
+	Created  time.Time
+}
+
+// Kinds of [Account]
+const (
+	AccountCard    = "card"
+	AccountCash    = "cash"
+	AccountBank    = "bank"
+	AccountWallet  = "wallet"
+	AccountSavings = "savings"
+)
+
+// Account is where money of a [MoneyEvent] comes from, like cash, a bank account or a credit card. Cards have
+// statements which close on ClosingDay of every month and are paid on DueDay, other accounts have these days 0.
+// Opening is the balance the account had when it was added
+type Account struct {
+	ID         int
+	Name       string
+	Kind       string
+	Currency   string
+	ClosingDay int
+	DueDay     int
+	Opening    float32
+	Created    time.Time
+	UserID     int64
+}
+
+// Transfer moves money between accounts of the [User], like an ATM withdrawal or buying dollars. Amount leaves
+// FromAccountID and Received comes to ToAccountID, they differ when currencies of the accounts differ.
+// Money coming from outside, like a salary, has FromAccountID 0. Transfers are not expenses and are not
+// counted in statistics
+type Transfer struct {
+	ID            int
+	FromAccountID int
+	ToAccountID   int
+	Amount        float32
+	Received      float32
+	Comment       string
+	Created       time.Time
+	UserID        int64
+}
+
+// Attachment is a file kept with a [MoneyEvent], like a photo of the receipt or a PDF invoice.
+// The file itself is in a blob store under BlobKey
+type Attachment struct {
 	ID       int
-	Amount   float32
-	Currency string
-	Comment  string
-	Tag      string
+	EventID  int
+	FileName string
+	BlobKey  string
 	Created  time.Time
-	UserID   int
+	UserID   int64
 }
 
-// Message is
+// Message is a message the bot sent. Reference tells what it is about, like an expense, so a reply to it can use it
 type Message struct {
-	ID     string
-	UserID string
+	ID        string
+	UserID    string
+	Reference string
 }
@@ -0,0 +1,109 @@
+// Package tagpolicy keeps tag names consistent: the same tag typed in different ways gets the same name,
+// and names which don't fit the database or Telegram buttons are rejected
+package tagpolicy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"ingresos_gastos/bot_interface"
+)
+
+// MaxLength is the longest tag name in bytes. It fits tags.name VARCHAR(50) and a button of the tag
+// fits Telegram's 64 bytes of callback data without a lookup in [bot_interface.CallbackStore]
+const MaxLength = 50
+
+var (
+	ErrEmpty      = errors.New("tag name is empty")
+	ErrTooLong    = fmt.Errorf("tag name is longer than %d bytes", MaxLength)
+	ErrCharacters = errors.New("tag name can contain only letters, digits, '-' and '_'")
+	ErrReserved   = errors.New("tag name is reserved by the bot")
+)
+
+// reservedNames can't be tags because they are used for commands and buttons
+var reservedNames = append([]string{"inline", "general", "back"}, bot_interface.Commands...)
+
+// Normalize turns a tag typed by user into its canonical name: spaces around are trimmed, spaces inside become "-",
+// the first letter is capital and the others are small. Emoji are taken out of the name and given back separately,
+// so "🍜 food" becomes "Food" with emoji "🍜"
+func Normalize(raw string) (string, string, error) {
+	var name []rune
+	var emoji []rune
+	for _, word := range strings.Fields(raw) {
+		if len(name) > 0 && !isEmojiWord(word) {
+			name = append(name, '-')
+		}
+		for _, r := range word {
+			switch {
+			case isEmojiRune(r):
+				emoji = append(emoji, r)
+			case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '-' || r == '_':
+				name = append(name, unicode.ToLower(r))
+			default:
+				return "", "", ErrCharacters
+			}
+		}
+	}
+	result := strings.Trim(string(name), "-")
+	if result == "" {
+		return "", "", ErrEmpty
+	}
+	runes := []rune(result)
+	runes[0] = unicode.ToUpper(runes[0])
+	result = string(runes)
+	if len(result) > MaxLength {
+		return "", "", ErrTooLong
+	}
+	for _, reserved := range reservedNames {
+		if strings.EqualFold(result, reserved) {
+			return "", "", ErrReserved
+		}
+	}
+	return result, string(emoji), nil
+}
+
+func isEmojiWord(word string) bool {
+	for _, r := range word {
+		if !isEmojiRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEmojiRune tells if the rune is a part of an emoji: a pictograph, a skin tone, a joiner, a keycap, a variation
+// selector or a tag of a subdivision flag. Other modifier symbols like ^ or ¨ are not emoji
+func isEmojiRune(r rune) bool {
+	return unicode.Is(unicode.So, r) || (r >= '\U0001f3fb' && r <= '\U0001f3ff') ||
+		r == '\u200d' || r == '\u20e3' || (r >= '\ufe00' && r <= '\ufe0f') || (r >= '\U000e0020' && r <= '\U000e007f')
+}
+
+// Canonical gives a name Normalize accepts for a tag saved before names were checked: characters which can't be
+// in a name are dropped, a too long name is cut and a name which is still empty or reserved gets the suffix
+func Canonical(raw, suffix string) (string, string) {
+	kept := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || isEmojiRune(r) || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, raw)
+	suffixed := false
+	for {
+		name, emoji, err := Normalize(kept)
+		switch {
+		case err == nil:
+			return name, emoji
+		case errors.Is(err, ErrTooLong):
+			runes := []rune(kept)
+			kept = string(runes[:len(runes)-1])
+		case suffixed:
+			name, _, _ = Normalize(suffix)
+			return name, ""
+		default:
+			kept += " " + suffix
+			suffixed = true
+		}
+	}
+}
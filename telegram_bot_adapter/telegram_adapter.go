@@ -2,21 +2,47 @@
 package telegram
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"gopkg.in/tucnak/telebot.v2"
 	"ingresos_gastos/bot_interface"
 	"ingresos_gastos/config"
 	"ingresos_gastos/storage_interface"
+	"io"
 	"log"
-	"math"
+	"mime"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// maxDownloadSize is the biggest file users can send to the bot
+const maxDownloadSize = 10 << 20
+
+var errFileTooBig = errors.New("file is too big")
+
 type BotAdapter struct {
 	Bot     *telebot.Bot
 	Storage storage_interface.ActualStorage
+	Codec   bot_interface.CallbackCodec
+	// searchable keeps the last searchable [bot_interface.Keyboard] sent to every user as [searchableKeyboard]
+	searchable *sync.Map
+	// keyboards keeps keyboards of more than one page shown to every user by their ids, page buttons carry
+	// only the id and the page. Old messages are deleted on every send, so only keyboards sent since then are kept
+	keyboards *sync.Map
+	// lastKeyboardID numbers the kept keyboards
+	lastKeyboardID *atomic.Int64
+}
+
+// searchableKeyboard is a keyboard user chooses from with the state user had when it was sent. Typed text is
+// searched among its options only while user is still in that state
+type searchableKeyboard struct {
+	keyboard bot_interface.Keyboard
+	state    string
 }
 
 type TelegramEditable struct {
@@ -32,26 +58,76 @@ func (message TelegramEditable) MessageSig() (messageID string, chatID int64) {
 	return message.Message.ID, message.Recipient.UserID
 }
 
-func convertToOptions(items []bot_interface.Option, withFinishOption bool) *telebot.ReplyMarkup {
-	heightOfArray := int(math.Ceil(float64(len(items)) / float64(3)))
-	if withFinishOption {
-		heightOfArray += 1
+func (adapter BotAdapter) button(text string, callback bot_interface.Callback) (telebot.InlineButton, error) {
+	data, err := adapter.Codec.Encode(callback)
+	if err != nil {
+		return telebot.InlineButton{}, err
 	}
-	options := make([][]telebot.InlineButton, heightOfArray)
-	for i := range options {
-		options[i] = make([]telebot.InlineButton, 3)
+	return telebot.InlineButton{Data: data, Text: text}, nil
+}
+
+// renderKeyboard builds one page of the keyboard with buttons to other pages when there are more of them.
+// The keyboard is kept under the id, see [BotAdapter.keyboards]
+func (adapter BotAdapter) renderKeyboard(keyboard bot_interface.Keyboard, id string, page int) (*telebot.ReplyMarkup, error) {
+	var options [][]telebot.InlineButton
+	for _, row := range keyboard.Rows(page) {
+		var buttons []telebot.InlineButton
+		for _, element := range row {
+			button, err := adapter.button(element.Text, bot_interface.Callback{Action: element.Action, Value: element.Id, State: element.State})
+			if err != nil {
+				return nil, err
+			}
+			buttons = append(buttons, button)
+		}
+		options = append(options, buttons)
 	}
-	for rowIndex, element := range items {
-		options[rowIndex/3][rowIndex%3] = telebot.InlineButton{Unique: "inline_" + element.Id, Text: element.Text}
+	if pages := keyboard.Pages(); pages > 1 {
+		var navigation []telebot.InlineButton
+		if page > 0 {
+			previous, err := adapter.button("\xE2\x97\x80", bot_interface.Callback{Action: bot_interface.ActionPage, Value: id, State: strconv.Itoa(page - 1)})
+			if err != nil {
+				return nil, err
+			}
+			navigation = append(navigation, previous)
+		}
+		if page < pages-1 {
+			next, err := adapter.button("\xE2\x96\xB6", bot_interface.Callback{Action: bot_interface.ActionPage, Value: id, State: strconv.Itoa(page + 1)})
+			if err != nil {
+				return nil, err
+			}
+			navigation = append(navigation, next)
+		}
+		options = append(options, navigation)
+	}
+	if keyboard.Layout.WithFinishOption {
+		finishButton, err := adapter.button("\xE2\x9B\x94Finish action", bot_interface.Callback{Action: bot_interface.ActionCommand, Value: bot_interface.CommandCancel})
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, []telebot.InlineButton{finishButton})
+	}
+	return &telebot.ReplyMarkup{InlineKeyboard: options}, nil
+}
+
+// showPage replaces the keyboard of the message with another page of it. Keyboards of old messages are
+// forgotten, for them user is asked to start again
+func (adapter BotAdapter) showPage(c *telebot.Callback, callback bot_interface.Callback) error {
+	stored, _ := adapter.keyboards.Load(c.Sender.ID)
+	keyboards, _ := stored.(map[string]bot_interface.Keyboard)
+	keyboard, found := keyboards[callback.Value]
+	if !found {
+		return adapter.Bot.Respond(c, &telebot.CallbackResponse{Text: "These buttons are outdated. Please start again"})
+	}
+	page, err := strconv.Atoi(callback.State)
+	if err != nil {
+		return fmt.Errorf("error parsing page number '%s': %v", callback.State, err)
 	}
-	rowIndex := len(items)
-	if rowIndex%3 == 1 {
-		options[rowIndex/3] = []telebot.InlineButton{options[rowIndex/3][0]}
-	} else if rowIndex%3 == 2 {
-		options[rowIndex/3] = []telebot.InlineButton{options[rowIndex/3][0], options[rowIndex/3][1]}
+	markup, err := adapter.renderKeyboard(keyboard, callback.Value, page)
+	if err != nil {
+		return err
 	}
-	options[heightOfArray-1] = []telebot.InlineButton{{Unique: "inline_" + bot_interface.CommandCancel, Text: "\xE2\x9B\x94Finish action"}}
-	return &telebot.ReplyMarkup{InlineKeyboard: options}
+	_, err = adapter.Bot.EditReplyMarkup(c.Message, markup)
+	return err
 }
 
 func NewBotAdapter(cfg config.Config, storage storage_interface.ActualStorage) (BotAdapter, error) {
@@ -64,8 +140,21 @@ func NewBotAdapter(cfg config.Config, storage storage_interface.ActualStorage) (
 		{Text: bot_interface.CommandStart, Description: "Hello"},
 		{Text: bot_interface.CommandHelp, Description: "List of all commands"},
 		{Text: bot_interface.CommandDefineTags, Description: "Define categories of expenses"},
+		{Text: bot_interface.CommandRenameTag, Description: "Rename a tag with all its history"},
+		{Text: bot_interface.CommandMergeTags, Description: "Join two tags into one"},
+		{Text: bot_interface.CommandArchiveTag, Description: "Hide a tag but keep its history"},
 		{Text: bot_interface.CommandDefineBudget, Description: "Set a budget for the current month"},
 		{Text: bot_interface.CommandStatistics, Description: "View your statistics"},
+		{Text: bot_interface.CommandCharts, Description: "Draw charts of your spending"},
+		{Text: bot_interface.CommandStatement, Description: "Get a PDF statement"},
+		{Text: bot_interface.CommandExport, Description: "Download your data as CSV, JSON or XLSX"},
+		{Text: bot_interface.CommandJournal, Description: "Download a ledger, hledger or beancount journal"},
+		{Text: bot_interface.CommandJournalAccounts, Description: "Choose journal accounts for tags"},
+		{Text: bot_interface.CommandCards, Description: "Credit cards and their statements"},
+		{Text: bot_interface.CommandBalances, Description: "Balances of your accounts"},
+		{Text: bot_interface.CommandTransfer, Description: "Move money between accounts"},
+		{Text: bot_interface.CommandReconcile, Description: "Check an account against its real balance"},
+		{Text: bot_interface.CommandRules, Description: "Rules to choose a tag automatically"},
 		{Text: bot_interface.CommandFeedback, Description: "Describe your experience"},
 		{Text: bot_interface.CommandCancel, Description: "Cancel current action"},
 	}
@@ -74,9 +163,14 @@ func NewBotAdapter(cfg config.Config, storage storage_interface.ActualStorage) (
 		log.Print(fmt.Errorf("error setting commands for telegram bot: %v", errSettingCommand))
 	}
 
+	if cfg.CallbackSecret == "" {
+		log.Print("WARNING callback secret is not set, state of buttons can be forged")
+	}
+
 	bot.Start()
 
-	return BotAdapter{Bot: bot, Storage: storage}, err
+	codec := bot_interface.CallbackCodec{Secret: []byte(cfg.CallbackSecret), Store: storage}
+	return BotAdapter{Bot: bot, Storage: storage, Codec: codec, searchable: &sync.Map{}, keyboards: &sync.Map{}, lastKeyboardID: &atomic.Int64{}}, err
 }
 
 func (adapter BotAdapter) Send(recipient bot_interface.BotRecipient, messages []bot_interface.Message) error {
@@ -87,26 +181,72 @@ func (adapter BotAdapter) Send(recipient bot_interface.BotRecipient, messages []
 		log.Print(fmt.Errorf("error getting messages from DB in Send: %v", errorGettingMessages))
 	}
 
+	adapter.searchable.Delete(recipient.UserID)
+	keyboards := make(map[string]bot_interface.Keyboard)
+	defer adapter.keyboards.Store(recipient.UserID, keyboards)
+	return adapter.post(recipient, messages, keyboards)
+}
+
+// Notify sends messages the bot sends on its own, like monthly statements. Earlier messages stay in the chat,
+// so keyboards of a flow user is in keep working
+func (adapter BotAdapter) Notify(recipient bot_interface.BotRecipient, messages []bot_interface.Message) error {
+	keyboards := make(map[string]bot_interface.Keyboard)
+	if stored, ok := adapter.keyboards.Load(recipient.UserID); ok {
+		for id, keyboard := range stored.(map[string]bot_interface.Keyboard) {
+			keyboards[id] = keyboard
+		}
+	}
+	defer adapter.keyboards.Store(recipient.UserID, keyboards)
+	return adapter.post(recipient, messages, keyboards)
+}
+
+// post sends the messages, keyboards of more than one page are added to keyboards
+func (adapter BotAdapter) post(recipient bot_interface.BotRecipient, messages []bot_interface.Message, keyboards map[string]bot_interface.Keyboard) error {
 	for _, message := range messages {
-		optionsLength := len(message.Options)
-		var sentMessage *telebot.Message
-		var err error
-		if optionsLength > 0 {
-			sentMessage, err = adapter.Bot.Send(recipient, message.Text, convertToOptions(message.Options, false))
-			if err != nil {
-				log.Print(fmt.Errorf("error sending message in Send: %v", err))
-				return err
+		var what interface{} = message.Text
+		if message.Photo != nil {
+			what = &telebot.Photo{File: telebot.FromReader(bytes.NewReader(message.Photo.Data)), Caption: message.Text}
+		} else if message.Document != nil {
+			what = &telebot.Document{
+				File:     telebot.FromReader(bytes.NewReader(message.Document.Data)),
+				FileName: message.Document.Name,
+				MIME:     mime.TypeByExtension(filepath.Ext(message.Document.Name)),
+				Caption:  message.Text,
 			}
-		} else {
-			sentMessage, err = adapter.Bot.Send(recipient, message.Text)
-			if err != nil {
-				log.Print(fmt.Errorf("error sending message in Send: %v", err))
-				return err
+		}
+		var sendOptions []interface{}
+		if len(message.Options) > 0 {
+			if message.Layout.Searchable {
+				state, err := adapter.Storage.GetUserState(recipient.UserID)
+				if err == nil && state != "" {
+					adapter.searchable.Store(recipient.UserID, searchableKeyboard{keyboard: message.Keyboard(), state: state})
+				} else if err != nil {
+					log.Print(fmt.Errorf("error getting user state in Send: %v", err))
+				}
 			}
+			var id string
+			if message.Keyboard().Pages() > 1 {
+				id = strconv.FormatInt(adapter.lastKeyboardID.Add(1), 36)
+				keyboards[id] = message.Keyboard()
+			}
+			markup, errConverting := adapter.renderKeyboard(message.Keyboard(), id, 0)
+			if errConverting != nil {
+				log.Print(fmt.Errorf("error converting options in post: %v", errConverting))
+				return errConverting
+			}
+			sendOptions = append(sendOptions, markup)
+		}
+		sentMessage, err := adapter.Bot.Send(recipient, what, sendOptions...)
+		if err != nil {
+			log.Print(fmt.Errorf("error sending message in post: %v", err))
+			return err
+		}
+		if message.Photo != nil || message.Document != nil {
+			continue
 		}
-		errSaving := adapter.Storage.SaveMessage(storage_interface.Message{ID: strconv.Itoa(sentMessage.ID), UserID: recipient.Recipient()})
+		errSaving := adapter.Storage.SaveMessage(storage_interface.Message{ID: strconv.Itoa(sentMessage.ID), UserID: recipient.Recipient(), Reference: message.Reference})
 		if errSaving != nil {
-			log.Print(fmt.Errorf("error saving message in Send: %v", err))
+			log.Print(fmt.Errorf("error saving message in post: %v", errSaving))
 		}
 	}
 	return nil
@@ -126,9 +266,16 @@ func (adapter BotAdapter) delete(recipient bot_interface.BotRecipient, messages
 }
 
 func (adapter BotAdapter) ListenToCommand(command string, action func(recipient bot_interface.BotRecipient) ([]bot_interface.Message, error)) {
+	adapter.ListenToCommandWithArguments(command, func(recipient bot_interface.BotRecipient, _ string) ([]bot_interface.Message, error) {
+		return action(recipient)
+	})
+}
+
+// ListenToCommandWithArguments handles a command giving the action the text after it, like "2024-03" in "/view_statistics 2024-03"
+func (adapter BotAdapter) ListenToCommandWithArguments(command string, action func(recipient bot_interface.BotRecipient, arguments string) ([]bot_interface.Message, error)) {
 	adapter.Bot.Handle(command, func(m *telebot.Message) {
 		recipient := bot_interface.BotRecipient{UserID: m.Sender.ID, Name: m.Sender.Username}
-		messages, err := action(recipient)
+		messages, err := action(recipient, strings.TrimSpace(m.Payload))
 		if err != nil {
 			log.Print(fmt.Errorf("error building messages on command %s: %v", command, err))
 			return
@@ -145,6 +292,9 @@ func (adapter BotAdapter) ListenToCommand(command string, action func(recipient
 func (adapter BotAdapter) ListenToInput(action func(recipient bot_interface.BotRecipient, text string) ([]bot_interface.Message, error)) {
 	adapter.Bot.Handle(telebot.OnText, func(message *telebot.Message) {
 		recipient := bot_interface.BotRecipient{UserID: message.Sender.ID, Name: message.Sender.Username}
+		if adapter.search(recipient, message.Text) {
+			return
+		}
 		messages, err := action(recipient, message.Text)
 		if err != nil {
 			log.Print(fmt.Errorf("error getting messages for user's text input %s: %v", message.Text, err))
@@ -158,26 +308,160 @@ func (adapter BotAdapter) ListenToInput(action func(recipient bot_interface.BotR
 	})
 }
 
+// ListenToDocuments handles files user sends
+func (adapter BotAdapter) ListenToDocuments(action func(recipient bot_interface.BotRecipient, document bot_interface.File, caption string) ([]bot_interface.Message, error)) {
+	adapter.Bot.Handle(telebot.OnDocument, func(message *telebot.Message) {
+		recipient := bot_interface.BotRecipient{UserID: message.Sender.ID, Name: message.Sender.Username}
+		data, err := adapter.download(&message.Document.File)
+		if err != nil {
+			log.Print(fmt.Errorf("error downloading document %s: %v", message.Document.FileName, err))
+			text := "I couldn't get your file. Please try again later"
+			if errors.Is(err, errFileTooBig) {
+				text = fmt.Sprintf("Your file is too big, I can read files up to %d MB", maxDownloadSize>>20)
+			}
+			if errSending := adapter.Send(recipient, []bot_interface.Message{{Text: text}}); errSending != nil {
+				log.Print(fmt.Errorf("error sending messages in reply to document %s: %v", message.Document.FileName, errSending))
+			}
+			return
+		}
+		file := bot_interface.File{Name: message.Document.FileName, Data: data, ReplyTo: adapter.replyReference(recipient, message)}
+		messages, err := action(recipient, file, message.Caption)
+		if err != nil {
+			log.Print(fmt.Errorf("error getting messages for document %s: %v", message.Document.FileName, err))
+			return
+		}
+		errSending := adapter.Send(recipient, messages)
+		if errSending != nil {
+			log.Print(fmt.Errorf("error sending messages in reply to document %s: %v", message.Document.FileName, errSending))
+			return
+		}
+	})
+}
+
+// ListenToPhotos handles pictures user sends. Telegram keeps a few sizes of a photo, the biggest one is taken
+func (adapter BotAdapter) ListenToPhotos(action func(recipient bot_interface.BotRecipient, photo bot_interface.File, caption string) ([]bot_interface.Message, error)) {
+	adapter.Bot.Handle(telebot.OnPhoto, func(message *telebot.Message) {
+		recipient := bot_interface.BotRecipient{UserID: message.Sender.ID, Name: message.Sender.Username}
+		data, err := adapter.download(&message.Photo.File)
+		if err != nil {
+			log.Print(fmt.Errorf("error downloading photo %s: %v", message.Photo.FileID, err))
+			text := "I couldn't get your photo. Please try again later"
+			if errors.Is(err, errFileTooBig) {
+				text = fmt.Sprintf("Your photo is too big, I can read files up to %d MB", maxDownloadSize>>20)
+			}
+			if errSending := adapter.Send(recipient, []bot_interface.Message{{Text: text}}); errSending != nil {
+				log.Print(fmt.Errorf("error sending messages in reply to photo %s: %v", message.Photo.FileID, errSending))
+			}
+			return
+		}
+		file := bot_interface.File{Name: "photo.jpg", Data: data, ReplyTo: adapter.replyReference(recipient, message)}
+		messages, err := action(recipient, file, message.Caption)
+		if err != nil {
+			log.Print(fmt.Errorf("error getting messages for photo %s: %v", message.Photo.FileID, err))
+			return
+		}
+		errSending := adapter.Send(recipient, messages)
+		if errSending != nil {
+			log.Print(fmt.Errorf("error sending messages in reply to photo %s: %v", message.Photo.FileID, errSending))
+			return
+		}
+	})
+}
+
+// replyReference is the reference of the bot's message the user replied to, it is empty for other messages
+func (adapter BotAdapter) replyReference(recipient bot_interface.BotRecipient, message *telebot.Message) string {
+	if message.ReplyTo == nil {
+		return ""
+	}
+	reference, err := adapter.Storage.GetMessageReference(strconv.Itoa(message.ReplyTo.ID), recipient.UserID)
+	if err != nil {
+		log.Print(fmt.Errorf("error getting reference of message %d: %v", message.ReplyTo.ID, err))
+	}
+	return reference
+}
+
+// download reads the file user sent from Telegram servers
+func (adapter BotAdapter) download(file *telebot.File) ([]byte, error) {
+	if file.FileSize > maxDownloadSize {
+		return nil, errFileTooBig
+	}
+	reader, err := adapter.Bot.GetFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDownloadSize {
+		return nil, errFileTooBig
+	}
+	return data, nil
+}
+
+// search looks for the text among options of the last searchable keyboard sent to the user and sends
+// the options found, while user is still choosing from that keyboard. Numbers are never searched, they are amounts.
+// The options found come with a button which takes the text as typed, so a new value like a new tag name is never
+// lost in the search. It tells if something was found
+func (adapter BotAdapter) search(recipient bot_interface.BotRecipient, text string) bool {
+	stored, ok := adapter.searchable.Load(recipient.UserID)
+	if !ok {
+		return false
+	}
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return false
+	}
+	if _, err := strconv.ParseFloat(words[0], 32); err == nil {
+		return false
+	}
+	searchable := stored.(searchableKeyboard)
+	state, err := adapter.Storage.GetUserState(recipient.UserID)
+	if err != nil || state != searchable.state {
+		if err != nil {
+			log.Print(fmt.Errorf("error getting user state in search: %v", err))
+		}
+		adapter.searchable.Delete(recipient.UserID)
+		return false
+	}
+	found := searchable.keyboard.Search(text)
+	if len(found.Options) == 0 {
+		return false
+	}
+	typed := bot_interface.Option{Id: text, Action: bot_interface.ActionInput, Text: "\xE2\x9C\x8Fuse '" + text + "'", FullWidth: true}
+	errSending := adapter.Send(recipient, []bot_interface.Message{{Text: "Found for '" + text + "':", Options: append(found.Options, typed), Layout: found.Layout}})
+	if errSending != nil {
+		log.Print(fmt.Errorf("error sending search results for %s: %v", text, errSending))
+	}
+	adapter.searchable.Store(recipient.UserID, searchable)
+	return true
+}
+
 // ListenToInlineActions handles inline buttons
-func (adapter BotAdapter) ListenToInlineActions(action func(recipient bot_interface.BotRecipient, inlineAction string) ([]bot_interface.Message, error)) {
+func (adapter BotAdapter) ListenToInlineActions(action func(recipient bot_interface.BotRecipient, callback bot_interface.Callback) ([]bot_interface.Message, error)) {
 	adapter.Bot.Handle(telebot.OnCallback, func(c *telebot.Callback) {
 		inlineCommand := strings.TrimSpace(c.Data)
 		recipient := bot_interface.BotRecipient{UserID: c.Sender.ID, Name: c.Sender.Username}
-		if strings.HasPrefix(inlineCommand, "inline_") {
-			tagName := strings.TrimPrefix(inlineCommand, "inline_")
-			messages, err := action(recipient, tagName)
+		callback, errDecoding := adapter.Codec.Decode(inlineCommand)
+		if errDecoding == nil && callback.Action == bot_interface.ActionPage {
+			if err := adapter.showPage(c, callback); err != nil {
+				log.Print(fmt.Errorf("error showing another page of keyboard: %v", err))
+			}
+		} else if errDecoding == nil {
+			messages, err := action(recipient, callback)
 			if err != nil {
 				log.Print(fmt.Errorf("error getting messages for inlineAction %s: %v", inlineCommand, err))
 				return
 			}
 			errSending := adapter.Send(recipient, messages)
 			if errSending != nil {
-				log.Print(fmt.Errorf("error sending messages in reply to inlineAction: %v", inlineCommand, errSending))
+				log.Print(fmt.Errorf("error sending messages in reply to inlineAction %s: %v", inlineCommand, errSending))
 				return
 			}
 		} else {
 			//there is strange input. Log it!
-			log.Print("Strange input " + inlineCommand + " from " + c.Sender.Username)
+			log.Print(fmt.Errorf("strange input %s from %s: %v", inlineCommand, c.Sender.Username, errDecoding))
 		}
 	})
 }